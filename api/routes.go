@@ -4,6 +4,7 @@ import (
 	"github.com/Romain-GUILLEMOT/WhispyrBack/handlers"
 	"github.com/Romain-GUILLEMOT/WhispyrBack/handlers/auth"
 	middlewares "github.com/Romain-GUILLEMOT/WhispyrBack/middleware"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/websocket/v2"
 )
@@ -14,6 +15,9 @@ func SetupRoutes(app *fiber.App) {
 		return c.SendString("✅ API en bonne santé !")
 	})
 	router.Get("/me", middlewares.RequireAuth(), handlers.Me)
+	router.Post("/me/avatar/upload", middlewares.RequireAuth(), handlers.CreateAvatarUpload)
+	router.Get("/me/mentions", middlewares.RequireAuth(), handlers.GetRecentMentions)
+	router.Post("/uploads/:uploadId/finalize", middlewares.RequireAuth(), handlers.FinalizeUpload)
 
 	auth := router.Group("/auth")
 	AuthRoutes(auth)
@@ -21,6 +25,12 @@ func SetupRoutes(app *fiber.App) {
 	ServersRoutes(servers)
 	server := router.Group("/server/:serverId", middlewares.RequireAuth())
 	ServerRoutes(server)
+	invites := router.Group("/invites", middlewares.RequireAuth())
+	InviteRoutes(invites)
+	dms := router.Group("/dms", middlewares.RequireAuth())
+	DMRoutes(dms)
+	relationships := router.Group("/relationships", middlewares.RequireAuth())
+	RelationshipRoutes(relationships)
 	debug := router.Group("/debug")
 	DebugRoutes(debug)
 	router.Use("/ws", middlewares.WebSocketAuth(), handlers.WebSocketHandler)
@@ -44,20 +54,100 @@ func ServersRoutes(router fiber.Router) {
 }
 
 func ServerRoutes(router fiber.Router) {
-	router.Post("/join", handlers.JoinServer) // POST   /servers/:id/join
-	router.Get("/", handlers.GetServer)       // GET    /servers/:id
-	router.Patch("/", handlers.UpdateServer)  // PATCH  /servers/:id
-	router.Delete("/", handlers.DeleteServer) // DELETE /servers/:id
+	router.Post("/join", handlers.JoinServer)                                                        // POST   /servers/:id/join
+	router.Get("/", handlers.GetServer)                                                              // GET    /servers/:id
+	router.Patch("/", middlewares.RequirePermission(models.PermManageServer), handlers.UpdateServer) // PATCH  /servers/:id
+	router.Delete("/", middlewares.RequirePermission(), handlers.DeleteServer)                       // DELETE /servers/:id (propriétaire uniquement)
+	router.Post("/transfer", middlewares.RequirePermission(), handlers.TransferServerOwnership)
+	router.Post("/leave", middlewares.RequirePermission(), handlers.LeaveServer)                                  // POST   /server/:id/leave
+	router.Delete("/members/:userId", middlewares.RequirePermission(models.PermKickMembers), handlers.KickMember) // DELETE /server/:id/members/:userId
+	router.Get("/search", middlewares.RequirePermission(), handlers.SearchServerMessages)                         // GET    /server/:id/search
+	bans := router.Group("/bans")
+	BanRoutes(bans)
 	channels := router.Group("/channels", middlewares.RequireAuth())
 	ChannelRoutes(channels)
+	categories := router.Group("/categories")
+	CategoryRoutes(categories)
+	roles := router.Group("/roles")
+	RoleRoutes(roles)
+	serverInvites := router.Group("/invites")
+	ServerInviteRoutes(serverInvites)
+}
+
+func CategoryRoutes(router fiber.Router) {
+	router.Post("/", middlewares.RequirePermission(models.PermManageChannels), handlers.CreateCategory)
+	router.Patch("/", middlewares.RequirePermission(models.PermManageChannels), handlers.ReorderCategories)
+	router.Patch("/:categoryId", middlewares.RequirePermission(models.PermManageChannels), handlers.UpdateCategory)
+	router.Delete("/:categoryId", middlewares.RequirePermission(models.PermManageChannels), handlers.DeleteCategory)
+}
+
+func RoleRoutes(router fiber.Router) {
+	router.Get("/", middlewares.RequirePermission(), handlers.GetServerRoles)
+	router.Post("/", middlewares.RequirePermission(models.PermManageRoles), handlers.CreateServerRole)
+	router.Patch("/:role", middlewares.RequirePermission(models.PermManageRoles), handlers.UpdateServerRole)
+	router.Delete("/:role", middlewares.RequirePermission(models.PermManageRoles), handlers.DeleteServerRole)
+	router.Put("/:role/members/:userId", middlewares.RequirePermission(models.PermManageRoles), handlers.AssignServerRole)
+	router.Delete("/:role/members/:userId", middlewares.RequirePermission(models.PermManageRoles), handlers.UnassignServerRole)
 }
 
 func ChannelRoutes(router fiber.Router) {
 	router.Get("/:id/messages", handlers.GetChannelMessages)
+	router.Post("/:id/messages", middlewares.RequirePermission(), handlers.CreateChannelMessage)
+	router.Post("/:id/uploads", middlewares.RequirePermission(), handlers.CreateAttachmentUpload)
+	router.Patch("/:id/messages/:messageId", middlewares.RequirePermission(), handlers.UpdateChannelMessage)
+	router.Delete("/:id/messages/:messageId", middlewares.RequirePermission(), handlers.DeleteChannelMessage)
+	router.Put("/:id/messages/:messageId/reactions/:emoji", middlewares.RequirePermission(), handlers.AddMessageReaction)
+	router.Delete("/:id/messages/:messageId/reactions/:emoji", middlewares.RequirePermission(), handlers.RemoveMessageReaction)
+	router.Post("/:id/messages/:messageId/threads", middlewares.RequirePermission(), handlers.CreateThread)
+	router.Get("/:id/threads", middlewares.RequirePermission(), handlers.GetChannelThreads)
+	router.Post("/:id/messages/:messageId/ack", middlewares.RequirePermission(), handlers.AckChannelMessage)
+	router.Get("/:id/pins", middlewares.RequirePermission(), handlers.GetChannelPins)
+	router.Put("/:id/pins/:messageId", middlewares.RequirePermission(), handlers.PinChannelMessage)
+	router.Delete("/:id/pins/:messageId", middlewares.RequirePermission(), handlers.UnpinChannelMessage)
+	router.Get("/:id/permissions", middlewares.RequirePermission(), handlers.GetChannelOverwrites)
+	router.Put("/:id/permissions/:targetType/:target", middlewares.RequirePermission(), handlers.PutChannelOverwrite)
+	router.Delete("/:id/permissions/:targetType/:target", middlewares.RequirePermission(), handlers.DeleteChannelOverwrite)
 	router.Get("/", handlers.GetServerChannelsAndCategories)
-	router.Post("/", handlers.CreateChannel)
-	router.Patch("/:id", handlers.UpdateChannel)
-	router.Delete("/:id", handlers.DeleteChannel)
+	router.Post("/", middlewares.RequirePermission(models.PermManageChannels), handlers.CreateChannel)
+	router.Patch("/", middlewares.RequirePermission(models.PermManageChannels), handlers.ReorderChannels)
+	router.Patch("/:id", middlewares.RequirePermission(), handlers.UpdateChannel)
+	router.Delete("/:id", middlewares.RequirePermission(), handlers.DeleteChannel)
+}
+
+func BanRoutes(router fiber.Router) {
+	router.Get("/", middlewares.RequirePermission(models.PermBanMembers), handlers.GetServerBans)
+	router.Put("/:userId", middlewares.RequirePermission(models.PermBanMembers), handlers.BanMember)
+	router.Delete("/:userId", middlewares.RequirePermission(models.PermBanMembers), handlers.UnbanMember)
+}
+
+func ServerInviteRoutes(router fiber.Router) {
+	router.Post("/", middlewares.RequirePermission(models.PermCreateInvite), handlers.CreateInvite)
+	router.Get("/", middlewares.RequirePermission(models.PermManageServer), handlers.GetServerInvites)
+	router.Delete("/:code", middlewares.RequirePermission(models.PermManageServer), handlers.DeleteInvite)
+}
+
+func RelationshipRoutes(router fiber.Router) {
+	router.Get("/", handlers.GetRelationships)
+	router.Post("/", handlers.SendFriendRequest) // Demande d'ami par nom d'utilisateur
+	router.Post("/:userId/accept", handlers.AcceptFriendRequest)
+	router.Post("/:userId/decline", handlers.DeclineFriendRequest)
+	router.Put("/:userId/block", handlers.BlockUser)
+	router.Delete("/:userId", handlers.DeleteRelationship) // Retirer un ami, annuler une demande ou débloquer
+}
+
+func DMRoutes(router fiber.Router) {
+	router.Get("/", handlers.GetPrivateChannels)
+	router.Post("/", handlers.OpenDirectMessage)
+	router.Post("/groups", handlers.CreateGroupDM)
+	router.Get("/:channelId/messages", handlers.GetPrivateChannelMessages)
+	router.Post("/:channelId/messages/:messageId/ack", handlers.AckPrivateChannelMessage)
+	router.Put("/:channelId/members/:userId", handlers.AddGroupDMMember)
+	router.Delete("/:channelId/members/:userId", handlers.RemoveGroupDMMember)
+}
+
+func InviteRoutes(router fiber.Router) {
+	router.Get("/:code", handlers.PreviewInvite)
+	router.Post("/:code/accept", handlers.AcceptInvite)
 }
 
 // --- NOUVEAU : Fonction pour les routes de debug ---
@@ -29,6 +29,7 @@ type Config struct {
 	MinioSecretKey   string
 	MinioBucket      string
 	MinioURL         string
+	SearchIndexPath  string
 }
 
 func LoadConfig() {
@@ -58,6 +59,7 @@ func LoadConfig() {
 		MinioSecretKey:   os.Getenv("MINIO_SECRET_KEY"),
 		MinioBucket:      os.Getenv("MINIO_BUCKET"),
 		MinioURL:         os.Getenv("MINIO_URL"),
+		SearchIndexPath:  os.Getenv("SEARCH_INDEX_PATH"),
 	}
 }
 
@@ -0,0 +1,35 @@
+package migration
+
+import "github.com/gocql/gocql"
+
+// EighthMigration ajoute un index des day_buckets non vides par salon afin de
+// paginer l'historique bucket par bucket, quelle que soit son ancienneté.
+type EighthMigration struct{}
+
+// Name retourne un nom unique pour cette migration.
+func (m EighthMigration) Name() string {
+	return "17_10_2026_Add_Channel_Buckets"
+}
+
+// Up crée la table puis la remplit à partir des partitions existantes.
+func (m EighthMigration) Up(session *gocql.Session) error {
+	if err := session.Query(`CREATE TABLE IF NOT EXISTS channel_buckets (
+            channel_id UUID,
+            day_bucket DATE,
+            PRIMARY KEY ((channel_id), day_bucket)
+        ) WITH CLUSTERING ORDER BY (day_bucket DESC);`).Exec(); err != nil {
+		return err
+	}
+
+	// Backfill : SELECT DISTINCT ne lit que les clés de partition, pas les messages.
+	iter := session.Query(`SELECT DISTINCT channel_id, day_bucket FROM messages_by_channel`).Iter()
+	var channelID gocql.UUID
+	var dayBucket string
+	for iter.Scan(&channelID, &dayBucket) {
+		if err := session.Query(`INSERT INTO channel_buckets (channel_id, day_bucket) VALUES (?, ?)`, channelID, dayBucket).Exec(); err != nil {
+			_ = iter.Close()
+			return err
+		}
+	}
+	return iter.Close()
+}
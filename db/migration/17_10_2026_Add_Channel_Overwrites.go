@@ -0,0 +1,35 @@
+package migration
+
+import "github.com/gocql/gocql"
+
+// SeventeenthMigration ajoute les surcharges de permissions par salon, regroupées par
+// serveur pour résoudre la visibilité de tous les salons en une seule lecture.
+type SeventeenthMigration struct{}
+
+// Name retourne un nom unique pour cette migration.
+func (m SeventeenthMigration) Name() string {
+	return "17_10_2026_Add_Channel_Overwrites"
+}
+
+// Up exécute les commandes CQL pour appliquer la migration.
+func (m SeventeenthMigration) Up(session *gocql.Session) error {
+	cqlCommands := []string{
+		`CREATE TABLE IF NOT EXISTS channel_permission_overwrites (
+            server_id    UUID,
+            channel_id   UUID,
+            target_type  TEXT,
+            target       TEXT,
+            allow        SET<TEXT>,
+            deny         SET<TEXT>,
+            PRIMARY KEY ((server_id), channel_id, target_type, target)
+        );`,
+	}
+
+	for _, command := range cqlCommands {
+		if err := session.Query(command).Exec(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package migration
+
+import "github.com/gocql/gocql"
+
+// FifthMigration ajoute les invitations de serveur (code court, expiration,
+// nombre d'utilisations) et rend la jointure par UUID brut optionnelle.
+type FifthMigration struct{}
+
+// Name retourne un nom unique pour cette migration.
+func (m FifthMigration) Name() string {
+	return "17_10_2026_Add_Invites"
+}
+
+// Up exécute les commandes CQL pour appliquer la migration.
+func (m FifthMigration) Up(session *gocql.Session) error {
+	cqlCommands := []string{
+		// ------------------------------------------------------------
+		// 1. Invitations, lookup direct par code
+		// ------------------------------------------------------------
+		`CREATE TABLE IF NOT EXISTS invites (
+            code        TEXT PRIMARY KEY,
+            server_id   UUID,
+            inviter_id  UUID,
+            max_uses    INT,        /* 0 = illimité        */
+            uses        INT,
+            expires_at  TIMESTAMP,  /* NULL = n'expire pas */
+            temporary   BOOLEAN,
+            created_at  TIMESTAMP
+        );`,
+
+		// Liste des invitations d'un serveur
+		`CREATE TABLE IF NOT EXISTS invites_by_server (
+            server_id   UUID,
+            code        TEXT,
+            PRIMARY KEY ((server_id), code)
+        );`,
+
+		// ------------------------------------------------------------
+		// 2. Jointure par UUID brut : désactivée par défaut (NULL = false)
+		// ------------------------------------------------------------
+		`ALTER TABLE servers ADD allow_uuid_join BOOLEAN;`,
+
+		// ------------------------------------------------------------
+		// 3. Adhésion temporaire : le membre est retiré à sa déconnexion
+		//    tant qu'aucun rôle ne lui a été attribué.
+		// ------------------------------------------------------------
+		`ALTER TABLE user_servers ADD temporary BOOLEAN;`,
+		`ALTER TABLE server_members ADD temporary BOOLEAN;`,
+	}
+
+	for _, command := range cqlCommands {
+		if err := session.Query(command).Exec(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
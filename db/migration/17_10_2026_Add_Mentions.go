@@ -0,0 +1,38 @@
+package migration
+
+import "github.com/gocql/gocql"
+
+// FifteenthMigration stocke les mentions résolues sur les messages et ajoute la
+// boîte de réception des mentions récentes de chaque utilisateur.
+type FifteenthMigration struct{}
+
+// Name retourne un nom unique pour cette migration.
+func (m FifteenthMigration) Name() string {
+	return "17_10_2026_Add_Mentions"
+}
+
+// Up exécute les commandes CQL pour appliquer la migration.
+func (m FifteenthMigration) Up(session *gocql.Session) error {
+	cqlCommands := []string{
+		`ALTER TABLE messages_by_channel ADD mentions SET<UUID>;`,
+		`ALTER TABLE messages_by_channel ADD mention_roles SET<TEXT>;`,
+		`ALTER TABLE messages_by_channel ADD mention_everyone BOOLEAN;`,
+		// Les mentions expirent au bout de 30 jours
+		`CREATE TABLE IF NOT EXISTS mentions_by_user (
+            user_id     UUID,
+            message_id  TIMEUUID,
+            channel_id  UUID,
+            server_id   UUID,
+            PRIMARY KEY ((user_id), message_id)
+        ) WITH CLUSTERING ORDER BY (message_id DESC)
+          AND default_time_to_live = 2592000;`,
+	}
+
+	for _, command := range cqlCommands {
+		if err := session.Query(command).Exec(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
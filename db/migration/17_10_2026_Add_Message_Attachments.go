@@ -0,0 +1,49 @@
+package migration
+
+import "github.com/gocql/gocql"
+
+// EleventhMigration ajoute les pièces jointes aux messages et la permission ATTACH_FILES.
+type EleventhMigration struct{}
+
+// Name retourne un nom unique pour cette migration.
+func (m EleventhMigration) Name() string {
+	return "17_10_2026_Add_Message_Attachments"
+}
+
+// Up exécute les commandes CQL pour appliquer la migration.
+func (m EleventhMigration) Up(session *gocql.Session) error {
+	cqlCommands := []string{
+		`CREATE TYPE IF NOT EXISTS attachment (
+            id            UUID,
+            object_key    TEXT,
+            filename      TEXT,
+            content_type  TEXT,
+            size          BIGINT,
+            width         INT,
+            height        INT,
+            url           TEXT
+        );`,
+		`ALTER TABLE messages_by_channel ADD attachments LIST<FROZEN<attachment>>;`,
+	}
+
+	for _, command := range cqlCommands {
+		if err := session.Query(command).Exec(); err != nil {
+			return err
+		}
+	}
+
+	// Les serveurs existants gardent le droit d'envoyer des fichiers : ATTACH_FILES est ajouté à leur rôle @everyone.
+	iter := session.Query(`SELECT server_id, role FROM server_roles`).Iter()
+	var serverID gocql.UUID
+	var role string
+	for iter.Scan(&serverID, &role) {
+		if role != "@everyone" {
+			continue
+		}
+		if err := session.Query(`UPDATE server_roles SET permissions = permissions + {'ATTACH_FILES'} WHERE server_id = ? AND role = ?`, serverID, role).Exec(); err != nil {
+			_ = iter.Close()
+			return err
+		}
+	}
+	return iter.Close()
+}
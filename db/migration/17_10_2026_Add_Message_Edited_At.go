@@ -0,0 +1,26 @@
+package migration
+
+import "github.com/gocql/gocql"
+
+// SeventhMigration ajoute la date de dernière modification des messages.
+type SeventhMigration struct{}
+
+// Name retourne un nom unique pour cette migration.
+func (m SeventhMigration) Name() string {
+	return "17_10_2026_Add_Message_Edited_At"
+}
+
+// Up exécute la commande CQL pour appliquer la migration.
+func (m SeventhMigration) Up(session *gocql.Session) error {
+	cqlCommands := []string{
+		`ALTER TABLE messages_by_channel ADD edited_at TIMESTAMP;`,
+	}
+
+	for _, command := range cqlCommands {
+		if err := session.Query(command).Exec(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
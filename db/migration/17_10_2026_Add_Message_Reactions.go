@@ -0,0 +1,40 @@
+package migration
+
+import "github.com/gocql/gocql"
+
+// NinthMigration ajoute les réactions aux messages et leurs compteurs.
+type NinthMigration struct{}
+
+// Name retourne un nom unique pour cette migration.
+func (m NinthMigration) Name() string {
+	return "17_10_2026_Add_Message_Reactions"
+}
+
+// Up exécute les commandes CQL pour appliquer la migration.
+func (m NinthMigration) Up(session *gocql.Session) error {
+	cqlCommands := []string{
+		`CREATE TABLE IF NOT EXISTS message_reactions (
+            channel_id  UUID,
+            message_id  TIMEUUID,
+            emoji       TEXT,
+            user_id     UUID,
+            reacted_at  TIMESTAMP,
+            PRIMARY KEY ((channel_id, message_id), emoji, user_id)
+        );`,
+		`CREATE TABLE IF NOT EXISTS message_reaction_counts (
+            channel_id  UUID,
+            message_id  TIMEUUID,
+            emoji       TEXT,
+            count       COUNTER,
+            PRIMARY KEY ((channel_id, message_id), emoji)
+        );`,
+	}
+
+	for _, command := range cqlCommands {
+		if err := session.Query(command).Exec(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,30 @@
+package migration
+
+import "github.com/gocql/gocql"
+
+// EighteenthMigration ajoute le compteur d'épingles de chaque salon, mis à jour par LWT
+// pour respecter la limite d'épingles en cas d'épinglages concurrents.
+type EighteenthMigration struct{}
+
+// Name retourne un nom unique pour cette migration.
+func (m EighteenthMigration) Name() string {
+	return "17_10_2026_Add_Pin_Counts"
+}
+
+// Up exécute les commandes CQL pour appliquer la migration.
+func (m EighteenthMigration) Up(session *gocql.Session) error {
+	cqlCommands := []string{
+		`CREATE TABLE IF NOT EXISTS pin_counts (
+            channel_id  UUID PRIMARY KEY,
+            pins        INT
+        );`,
+	}
+
+	for _, command := range cqlCommands {
+		if err := session.Query(command).Exec(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
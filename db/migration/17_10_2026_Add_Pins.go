@@ -0,0 +1,32 @@
+package migration
+
+import "github.com/gocql/gocql"
+
+// SixteenthMigration ajoute les messages épinglés de chaque salon.
+type SixteenthMigration struct{}
+
+// Name retourne un nom unique pour cette migration.
+func (m SixteenthMigration) Name() string {
+	return "17_10_2026_Add_Pins"
+}
+
+// Up exécute les commandes CQL pour appliquer la migration.
+func (m SixteenthMigration) Up(session *gocql.Session) error {
+	cqlCommands := []string{
+		`CREATE TABLE IF NOT EXISTS pins_by_channel (
+            channel_id  UUID,
+            message_id  TIMEUUID,
+            pinned_by   UUID,
+            pinned_at   TIMESTAMP,
+            PRIMARY KEY ((channel_id), message_id)
+        ) WITH CLUSTERING ORDER BY (message_id DESC);`,
+	}
+
+	for _, command := range cqlCommands {
+		if err := session.Query(command).Exec(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
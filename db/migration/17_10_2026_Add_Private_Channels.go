@@ -0,0 +1,34 @@
+package migration
+
+import "github.com/gocql/gocql"
+
+// TwelfthMigration prépare les messages privés : propriétaire et dernier message des
+// groupes, et index d'unicité des conversations 1:1 par paire d'utilisateurs.
+type TwelfthMigration struct{}
+
+// Name retourne un nom unique pour cette migration.
+func (m TwelfthMigration) Name() string {
+	return "17_10_2026_Add_Private_Channels"
+}
+
+// Up exécute les commandes CQL pour appliquer la migration.
+func (m TwelfthMigration) Up(session *gocql.Session) error {
+	cqlCommands := []string{
+		`ALTER TABLE channels ADD owner_id UUID;`,            // Créateur d'un groupe privé
+		`ALTER TABLE channels ADD last_message_id TIMEUUID;`, // Clé last_msg_at courante dans private_channels_by_user
+		`CREATE TABLE IF NOT EXISTS dm_by_pair (
+            user_low    UUID,  /* Le plus petit des deux IDs */
+            user_high   UUID,
+            channel_id  UUID,
+            PRIMARY KEY ((user_low, user_high))
+        );`,
+	}
+
+	for _, command := range cqlCommands {
+		if err := session.Query(command).Exec(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package migration
+
+import "github.com/gocql/gocql"
+
+// FourteenthMigration ajoute les états de lecture par utilisateur et le dernier
+// message de chaque salon de serveur, pour calculer les non-lus.
+type FourteenthMigration struct{}
+
+// Name retourne un nom unique pour cette migration.
+func (m FourteenthMigration) Name() string {
+	return "17_10_2026_Add_Read_States"
+}
+
+// Up exécute les commandes CQL pour appliquer la migration.
+func (m FourteenthMigration) Up(session *gocql.Session) error {
+	cqlCommands := []string{
+		`CREATE TABLE IF NOT EXISTS read_states (
+            user_id               UUID,
+            channel_id            UUID,
+            server_id             UUID,      /* NULL pour un salon privé */
+            last_read_message_id  TIMEUUID,
+            mention_count         INT,       /* Mentions reçues depuis le dernier acquittement */
+            PRIMARY KEY ((user_id), channel_id)
+        );`,
+		// Dernier message de chaque salon, regroupé par serveur pour une lecture en une requête
+		`CREATE TABLE IF NOT EXISTS channel_last_messages (
+            server_id        UUID,
+            channel_id       UUID,
+            last_message_id  TIMEUUID,
+            PRIMARY KEY ((server_id), channel_id)
+        );`,
+	}
+
+	for _, command := range cqlCommands {
+		if err := session.Query(command).Exec(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
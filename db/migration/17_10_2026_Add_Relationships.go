@@ -0,0 +1,34 @@
+package migration
+
+import "github.com/gocql/gocql"
+
+// ThirteenthMigration ajoute les relations entre utilisateurs (amis, demandes, blocages).
+type ThirteenthMigration struct{}
+
+// Name retourne un nom unique pour cette migration.
+func (m ThirteenthMigration) Name() string {
+	return "17_10_2026_Add_Relationships"
+}
+
+// Up exécute les commandes CQL pour appliquer la migration.
+func (m ThirteenthMigration) Up(session *gocql.Session) error {
+	cqlCommands := []string{
+		// Une ligne par côté de la relation : user_id voit target_id comme "friend",
+		// "incoming", "outgoing" ou "blocked".
+		`CREATE TABLE IF NOT EXISTS relationships (
+            user_id     UUID,
+            target_id   UUID,
+            type        TEXT,
+            created_at  TIMESTAMP,
+            PRIMARY KEY ((user_id), target_id)
+        );`,
+	}
+
+	for _, command := range cqlCommands {
+		if err := session.Query(command).Exec(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package migration
+
+import "github.com/gocql/gocql"
+
+// TenthMigration ajoute les réponses aux messages et les fils de discussion (threads).
+// Un thread est un salon de la table channels rattaché à un salon parent et à un message.
+type TenthMigration struct{}
+
+// Name retourne un nom unique pour cette migration.
+func (m TenthMigration) Name() string {
+	return "17_10_2026_Add_Replies_And_Threads"
+}
+
+// Up exécute les commandes CQL pour appliquer la migration.
+func (m TenthMigration) Up(session *gocql.Session) error {
+	cqlCommands := []string{
+		`ALTER TABLE messages_by_channel ADD reply_to TIMEUUID;`,
+		`ALTER TABLE messages_by_channel ADD thread_id UUID;`,
+		`ALTER TABLE channels ADD parent_channel_id UUID;`,
+		`ALTER TABLE channels ADD parent_message_id TIMEUUID;`,
+		`ALTER TABLE channels ADD archived BOOLEAN;`,
+		`ALTER TABLE channels ADD auto_archive_after INT;`, // En secondes
+		`ALTER TABLE channels ADD last_activity_at TIMESTAMP;`,
+		`CREATE TABLE IF NOT EXISTS threads_by_channel (
+            parent_channel_id   UUID,
+            thread_id           TIMEUUID,
+            parent_message_id   TIMEUUID,
+            name                TEXT,
+            creator_id          UUID,
+            archived            BOOLEAN,
+            auto_archive_after  INT,
+            PRIMARY KEY ((parent_channel_id), thread_id)
+        ) WITH CLUSTERING ORDER BY (thread_id DESC);`,
+	}
+
+	for _, command := range cqlCommands {
+		if err := session.Query(command).Exec(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,29 @@
+package migration
+
+import "github.com/gocql/gocql"
+
+// FourthMigration ajoute la couleur et la position (hiérarchie) aux rôles de serveur.
+type FourthMigration struct{}
+
+// Name retourne un nom unique pour cette migration.
+func (m FourthMigration) Name() string {
+	return "17_10_2026_Add_Role_Metadata"
+}
+
+// Up exécute les commandes CQL pour appliquer la migration.
+func (m FourthMigration) Up(session *gocql.Session) error {
+	// La position définit la hiérarchie : un rôle ne peut gérer que les rôles
+	// strictement inférieurs au sien. @everyone reste à 0.
+	cqlCommands := []string{
+		`ALTER TABLE server_roles ADD color TEXT;`,
+		`ALTER TABLE server_roles ADD position INT;`,
+	}
+
+	for _, command := range cqlCommands {
+		if err := session.Query(command).Exec(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,34 @@
+package migration
+
+import "github.com/gocql/gocql"
+
+// SixthMigration ajoute la table des bannissements de serveur.
+type SixthMigration struct{}
+
+// Name retourne un nom unique pour cette migration.
+func (m SixthMigration) Name() string {
+	return "17_10_2026_Add_Server_Bans"
+}
+
+// Up exécute les commandes CQL pour appliquer la migration.
+func (m SixthMigration) Up(session *gocql.Session) error {
+	cqlCommands := []string{
+		`CREATE TABLE IF NOT EXISTS server_bans (
+            server_id   UUID,
+            user_id     UUID,
+            reason      TEXT,
+            banned_by   UUID,
+            banned_at   TIMESTAMP,
+            expires_at  TIMESTAMP,  /* NULL = définitif */
+            PRIMARY KEY ((server_id), user_id)
+        );`,
+	}
+
+	for _, command := range cqlCommands {
+		if err := session.Query(command).Exec(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
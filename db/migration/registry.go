@@ -4,4 +4,19 @@ var AllMigrations = []Migration{
 	FirstMigration{},
 	SecondMigration{},
 	ThirdMigration{},
+	FourthMigration{},
+	FifthMigration{},
+	SixthMigration{},
+	SeventhMigration{},
+	EighthMigration{},
+	NinthMigration{},
+	TenthMigration{},
+	EleventhMigration{},
+	TwelfthMigration{},
+	ThirteenthMigration{},
+	FourteenthMigration{},
+	FifteenthMigration{},
+	SixteenthMigration{},
+	SeventeenthMigration{},
+	EighteenthMigration{},
 }
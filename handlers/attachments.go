@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	_ "image/gif" // Enregistre le décodeur GIF pour image.DecodeConfig
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/Romain-GUILLEMOT/WhispyrBack/config"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils"
+	_ "github.com/chai2010/webp" // Enregistre le décodeur WebP pour image.DecodeConfig
+	"github.com/gocql/gocql"
+	"github.com/minio/minio-go/v7"
+)
+
+const (
+	maxAttachmentsPerMessage = 5
+	maxAttachmentSize        = 8 * 1024 * 1024 // 8 MB, sous la BodyLimit de Fiber
+)
+
+// allowedAttachmentTypes liste les types MIME acceptés tels quels. Les types image/*, video/*
+// et audio/* sont acceptés en plus via leur préfixe.
+var allowedAttachmentTypes = map[string]bool{
+	"application/pdf":  true,
+	"application/zip":  true,
+	"application/json": true,
+	"text/plain":       true,
+	"text/markdown":    true,
+	"text/csv":         true,
+}
+
+// attachmentTypeAllowed indique si un type MIME peut être envoyé en pièce jointe.
+func attachmentTypeAllowed(contentType string) bool {
+	for _, prefix := range []string{"image/", "video/", "audio/"} {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return allowedAttachmentTypes[contentType]
+}
+
+// sanitizeFilename ne garde que le nom de base du fichier, sans caractère problématique pour une clé d'objet.
+func sanitizeFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`/"?#%*:<>|`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "" || name == "." {
+		return "fichier"
+	}
+	if len(name) > 128 {
+		ext := filepath.Ext(name)
+		name = name[:128-len(ext)] + ext
+	}
+	return name
+}
+
+// processAndUploadAttachment stocke une pièce jointe dans MinIO. Les images JPEG et PNG
+// sont converties en WebP ; les autres fichiers sont stockés tels quels. Les dimensions
+// sont renseignées pour toutes les images.
+func processAndUploadAttachment(channelID gocql.UUID, file *multipart.FileHeader) (*models.Attachment, error) {
+	if file.Size > maxAttachmentSize {
+		return nil, fmt.Errorf("le fichier %s dépasse la taille maximale de %d Mo", file.Filename, maxAttachmentSize/(1024*1024))
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("fichier %s illisible", file.Filename)
+	}
+	defer src.Close()
+
+	attachment := &models.Attachment{
+		ID:          gocql.TimeUUID(),
+		Filename:    sanitizeFilename(file.Filename),
+		ContentType: strings.ToLower(strings.TrimSpace(strings.Split(file.Header.Get("Content-Type"), ";")[0])),
+	}
+
+	var data *bytes.Buffer
+	switch attachment.ContentType {
+	case "image/jpeg", "image/jpg", "image/png":
+		data, err = utils.ConvertToWebP(src, attachment.ContentType)
+		if err != nil {
+			utils.Error("Attachment conversion failed", "err", err, "file", file.Filename)
+			return nil, fmt.Errorf("image %s invalide", file.Filename)
+		}
+		attachment.ContentType = "image/webp"
+		attachment.Filename = strings.TrimSuffix(attachment.Filename, filepath.Ext(attachment.Filename)) + ".webp"
+	default:
+		data = new(bytes.Buffer)
+		if _, err := io.Copy(data, src); err != nil {
+			return nil, fmt.Errorf("fichier %s illisible", file.Filename)
+		}
+		if attachment.ContentType == "" || attachment.ContentType == "application/octet-stream" {
+			attachment.ContentType = strings.Split(http.DetectContentType(data.Bytes()), ";")[0]
+		}
+	}
+
+	if !attachmentTypeAllowed(attachment.ContentType) {
+		return nil, fmt.Errorf("type de fichier non autorisé: %s", attachment.ContentType)
+	}
+	if strings.HasPrefix(attachment.ContentType, "image/") {
+		if cfg, _, err := image.DecodeConfig(bytes.NewReader(data.Bytes())); err == nil {
+			attachment.Width, attachment.Height = cfg.Width, cfg.Height
+		}
+	}
+
+	cfg := config.GetConfig()
+	attachment.Size = int64(data.Len())
+	attachment.ObjectKey = fmt.Sprintf("attachments/%s/%s/%s", channelID, attachment.ID, attachment.Filename)
+	opts := minio.PutObjectOptions{ContentType: attachment.ContentType}
+	if !strings.HasPrefix(attachment.ContentType, "image/") {
+		opts.ContentDisposition = fmt.Sprintf("attachment; filename=%q", attachment.Filename)
+	}
+	if _, err := utils.MinioClient.PutObject(context.Background(), cfg.MinioBucket, attachment.ObjectKey, data, attachment.Size, opts); err != nil {
+		utils.Error("MinIO attachment upload failed", "err", err, "object", attachment.ObjectKey)
+		return nil, fmt.Errorf("erreur d'upload du fichier %s", file.Filename)
+	}
+	attachment.URL = fmt.Sprintf("%s/%s", cfg.MinioURL, attachment.ObjectKey)
+	return attachment, nil
+}
+
+// attachmentObjectKeys retourne les clés MinIO des pièces jointes.
+func attachmentObjectKeys(attachments []models.Attachment) []string {
+	keys := make([]string, 0, len(attachments))
+	for _, attachment := range attachments {
+		keys = append(keys, attachment.ObjectKey)
+	}
+	return keys
+}
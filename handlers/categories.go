@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	middlewares "github.com/Romain-GUILLEMOT/WhispyrBack/middleware"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils/dbTools"
+	"github.com/gocql/gocql"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	maxCategoryNameLength = 100
+	maxLayoutMoves        = 100
+)
+
+// ChannelLayout est la disposition des catégories et salons d'un serveur, diffusée
+// dans l'événement channel_layout_update. Les salons sans catégorie ont un category_id nul.
+// Overwrites (salon -> surcharges) transite par Redis pour que le broadcaster filtre les
+// salons de chaque connexion ; il n'est jamais envoyé aux clients.
+type ChannelLayout struct {
+	Categories []models.CategoryByServer               `json:"categories"`
+	Channels   []models.ChannelByServer                `json:"channels"`
+	Overwrites map[string][]models.PermissionOverwrite `json:"overwrites,omitempty"`
+}
+
+// visibleTo retourne la disposition limitée aux salons que le membre peut voir, sans les surcharges.
+func (l *ChannelLayout) visibleTo(member *models.MemberPermissions) *ChannelLayout {
+	visible := &ChannelLayout{Categories: l.Categories, Channels: make([]models.ChannelByServer, 0, len(l.Channels))}
+	for _, channel := range l.Channels {
+		if member.ForChannel(channel.IsPrivate, l.Overwrites[channel.ChannelID.String()]).Has(models.PermViewChannel) {
+			visible.Channels = append(visible.Channels, channel)
+		}
+	}
+	return visible
+}
+
+// publishLayoutUpdate relit la disposition du serveur et la diffuse à ses membres connectés.
+func publishLayoutUpdate(serverID gocql.UUID) {
+	categories, err := dbTools.GetServerCategories(serverID)
+	if err != nil {
+		utils.Error("Lecture des catégories impossible", "serverId", serverID, "err", err)
+		return
+	}
+	channels, err := dbTools.GetServerChannels(serverID)
+	if err != nil {
+		utils.Error("Lecture des salons impossible", "serverId", serverID, "err", err)
+		return
+	}
+	overwrites, err := dbTools.GetServerOverwrites(serverID)
+	if err != nil {
+		utils.Error("Lecture des surcharges impossible", "serverId", serverID, "err", err)
+		return
+	}
+	layout := &ChannelLayout{Categories: categories, Channels: channels, Overwrites: make(map[string][]models.PermissionOverwrite, len(overwrites))}
+	for channelID, channelOverwrites := range overwrites {
+		layout.Overwrites[channelID.String()] = channelOverwrites
+	}
+	publishServerEvent(Message{
+		Type:      "channel_layout_update",
+		ServerID:  serverID.String(),
+		Layout:    layout,
+		Timestamp: time.Now().UnixNano() / int64(time.Millisecond),
+	})
+}
+
+// parseCategoryName valide le nom d'une catégorie.
+func parseCategoryName(raw string) (string, bool) {
+	name := strings.TrimSpace(raw)
+	return name, name != "" && len(name) <= maxCategoryNameLength
+}
+
+// ----------------------
+// 📌 Créer une catégorie
+// ----------------------
+func CreateCategory(c *fiber.Ctx) error {
+	member := middlewares.GetMember(c)
+
+	var reqBody struct {
+		Name string `json:"name"`
+	}
+	if err := c.BodyParser(&reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Données invalides."})
+	}
+	name, ok := parseCategoryName(reqBody.Name)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Nom de catégorie invalide."})
+	}
+
+	category, err := dbTools.CreateCategory(member.ServerID, name)
+	if err != nil {
+		utils.Error("Création de la catégorie impossible", "serverId", member.ServerID, "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de la création de la catégorie."})
+	}
+
+	publishLayoutUpdate(member.ServerID)
+	return c.Status(fiber.StatusCreated).JSON(category)
+}
+
+// ----------------------
+// 📌 Renommer une catégorie
+// ----------------------
+func UpdateCategory(c *fiber.Ctx) error {
+	member := middlewares.GetMember(c)
+
+	categoryID, err := gocql.ParseUUID(c.Params("categoryId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID de catégorie invalide."})
+	}
+	var reqBody struct {
+		Name string `json:"name"`
+	}
+	if err := c.BodyParser(&reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Données invalides."})
+	}
+	name, ok := parseCategoryName(reqBody.Name)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Nom de catégorie invalide."})
+	}
+
+	category, err := dbTools.GetCategory(member.ServerID, categoryID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Catégorie introuvable."})
+	}
+	if err := dbTools.RenameCategory(member.ServerID, categoryID, name); err != nil {
+		utils.Error("Renommage de la catégorie impossible", "categoryId", categoryID, "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de la mise à jour de la catégorie."})
+	}
+	category.Name = name
+
+	publishLayoutUpdate(member.ServerID)
+	return c.JSON(category)
+}
+
+// ----------------------
+// 📌 Supprimer une catégorie (ses salons deviennent non catégorisés)
+// ----------------------
+func DeleteCategory(c *fiber.Ctx) error {
+	member := middlewares.GetMember(c)
+
+	categoryID, err := gocql.ParseUUID(c.Params("categoryId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID de catégorie invalide."})
+	}
+	if _, err := dbTools.GetCategory(member.ServerID, categoryID); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Catégorie introuvable."})
+	}
+
+	if err := dbTools.DeleteCategory(member.ServerID, categoryID); err != nil {
+		utils.Error("Suppression de la catégorie impossible", "categoryId", categoryID, "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de la suppression de la catégorie."})
+	}
+
+	publishLayoutUpdate(member.ServerID)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Catégorie supprimée."})
+}
+
+// ----------------------
+// 📌 Réordonner les catégories ([{category_id, position}])
+// ----------------------
+func ReorderCategories(c *fiber.Ctx) error {
+	member := middlewares.GetMember(c)
+
+	var moves []struct {
+		CategoryID string `json:"category_id"`
+		Position   int    `json:"position"`
+	}
+	if err := c.BodyParser(&moves); err != nil || len(moves) == 0 || len(moves) > maxLayoutMoves {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Données invalides."})
+	}
+
+	categories, err := dbTools.GetServerCategories(member.ServerID)
+	if err != nil {
+		utils.Error("Lecture des catégories impossible", "serverId", member.ServerID, "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors du réordonnancement."})
+	}
+	index := make(map[gocql.UUID]int, len(categories))
+	for i, category := range categories {
+		index[category.CategoryID] = i
+	}
+
+	moved := make(map[gocql.UUID]bool, len(moves))
+	for _, move := range moves {
+		categoryID, err := gocql.ParseUUID(move.CategoryID)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID de catégorie invalide."})
+		}
+		i, ok := index[categoryID]
+		if !ok {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Catégorie introuvable."})
+		}
+		categories[i].Position = move.Position
+		moved[categoryID] = true
+	}
+
+	// À position égale, la catégorie déplacée passe devant : les positions sont ensuite renumérotées.
+	sort.SliceStable(categories, func(i, j int) bool {
+		if categories[i].Position != categories[j].Position {
+			return categories[i].Position < categories[j].Position
+		}
+		return moved[categories[i].CategoryID] && !moved[categories[j].CategoryID]
+	})
+	positions := make(map[gocql.UUID]int, len(categories))
+	for i, category := range categories {
+		positions[category.CategoryID] = i
+	}
+
+	if err := dbTools.SetCategoryPositions(member.ServerID, positions); err != nil {
+		utils.Error("Réordonnancement des catégories impossible", "serverId", member.ServerID, "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors du réordonnancement."})
+	}
+
+	publishLayoutUpdate(member.ServerID)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// ----------------------
+// 📌 Déplacer des salons ([{channel_id, category_id, position}], category_id vide = catégorie inchangée)
+// ----------------------
+func ReorderChannels(c *fiber.Ctx) error {
+	member := middlewares.GetMember(c)
+
+	var moves []struct {
+		ChannelID  string `json:"channel_id"`
+		CategoryID string `json:"category_id"`
+		Position   int    `json:"position"`
+	}
+	if err := c.BodyParser(&moves); err != nil || len(moves) == 0 || len(moves) > maxLayoutMoves {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Données invalides."})
+	}
+
+	channels, err := dbTools.GetServerChannels(member.ServerID)
+	if err != nil {
+		utils.Error("Lecture des salons impossible", "serverId", member.ServerID, "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors du déplacement des salons."})
+	}
+	categories, err := dbTools.GetServerCategories(member.ServerID)
+	if err != nil {
+		utils.Error("Lecture des catégories impossible", "serverId", member.ServerID, "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors du déplacement des salons."})
+	}
+	knownCategories := map[gocql.UUID]bool{{}: true} // La catégorie nulle regroupe les salons non catégorisés
+	for _, category := range categories {
+		knownCategories[category.CategoryID] = true
+	}
+
+	layout := make([]models.ChannelByServer, len(channels))
+	copy(layout, channels)
+	index := make(map[gocql.UUID]int, len(layout))
+	for i, channel := range layout {
+		index[channel.ChannelID] = i
+	}
+
+	moved := make(map[gocql.UUID]bool, len(moves))
+	touched := make(map[gocql.UUID]bool) // Catégories à renuméroter
+	for _, move := range moves {
+		channelID, err := gocql.ParseUUID(move.ChannelID)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID de salon invalide."})
+		}
+		i, ok := index[channelID]
+		if !ok {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Salon introuvable."})
+		}
+		touched[layout[i].CategoryID] = true
+		if move.CategoryID != "" {
+			categoryID, err := gocql.ParseUUID(move.CategoryID)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID de catégorie invalide."})
+			}
+			if !knownCategories[categoryID] {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Catégorie introuvable."})
+			}
+			layout[i].CategoryID = categoryID
+		}
+		layout[i].Position = move.Position
+		touched[layout[i].CategoryID] = true
+		moved[channelID] = true
+	}
+
+	// Renumérote chaque catégorie concernée de 0 à n-1 ; à position égale, le salon déplacé passe devant.
+	sort.SliceStable(layout, func(i, j int) bool {
+		if layout[i].Position != layout[j].Position {
+			return layout[i].Position < layout[j].Position
+		}
+		return moved[layout[i].ChannelID] && !moved[layout[j].ChannelID]
+	})
+	next := make(map[gocql.UUID]int)
+	previous := make(map[gocql.UUID]models.ChannelByServer, len(channels))
+	for _, channel := range channels {
+		previous[channel.ChannelID] = channel
+	}
+	changed := make([]models.ChannelByServer, 0)
+	for _, channel := range layout {
+		if !touched[channel.CategoryID] {
+			continue
+		}
+		channel.Position = next[channel.CategoryID]
+		next[channel.CategoryID]++
+		if old := previous[channel.ChannelID]; old.CategoryID != channel.CategoryID || old.Position != channel.Position {
+			changed = append(changed, channel)
+		}
+	}
+
+	if err := dbTools.MoveChannels(member.ServerID, channels, changed); err != nil {
+		utils.Error("Déplacement des salons impossible", "serverId", member.ServerID, "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors du déplacement des salons."})
+	}
+
+	if len(changed) > 0 {
+		publishLayoutUpdate(member.ServerID)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
+	"github.com/gocql/gocql"
+)
+
+func TestChannelLayoutVisibleTo(t *testing.T) {
+	userID := gocql.MustRandomUUID()
+	general := models.ChannelByServer{ChannelID: gocql.MustRandomUUID(), Name: "général"}
+	staff := models.ChannelByServer{ChannelID: gocql.MustRandomUUID(), Name: "staff", Position: 1, IsPrivate: true}
+	annonces := models.ChannelByServer{ChannelID: gocql.MustRandomUUID(), Name: "annonces", Position: 2}
+
+	layout := &ChannelLayout{
+		Categories: []models.CategoryByServer{{CategoryID: gocql.MustRandomUUID(), Name: "Texte"}},
+		Channels:   []models.ChannelByServer{general, staff, annonces},
+		Overwrites: map[string][]models.PermissionOverwrite{
+			staff.ChannelID.String(): {
+				{TargetType: models.OverwriteRole, Target: "modos", Allow: []string{models.PermViewChannel}},
+			},
+			annonces.ChannelID.String(): {
+				{TargetType: models.OverwriteMember, Target: userID.String(), Deny: []string{models.PermViewChannel}},
+			},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		member *models.MemberPermissions
+		want   []models.ChannelByServer
+	}{
+		{
+			name:   "membre sans rôle",
+			member: &models.MemberPermissions{UserID: gocql.MustRandomUUID(), Role: models.RoleMember},
+			want:   []models.ChannelByServer{general, annonces},
+		},
+		{
+			name:   "rôle autorisé sur le salon privé",
+			member: &models.MemberPermissions{UserID: gocql.MustRandomUUID(), Role: "modos"},
+			want:   []models.ChannelByServer{general, staff, annonces},
+		},
+		{
+			name:   "membre exclu d'un salon public",
+			member: &models.MemberPermissions{UserID: userID, Role: models.RoleMember},
+			want:   []models.ChannelByServer{general},
+		},
+		{
+			name:   "propriétaire",
+			member: &models.MemberPermissions{UserID: userID, Role: models.RoleOwner, IsOwner: true},
+			want:   []models.ChannelByServer{general, staff, annonces},
+		},
+		{
+			name:   "membre inconnu",
+			member: nil,
+			want:   []models.ChannelByServer{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			visible := layout.visibleTo(tt.member)
+			if !reflect.DeepEqual(visible.Channels, tt.want) {
+				t.Errorf("salons visibles = %v, attendu %v", visible.Channels, tt.want)
+			}
+			if !reflect.DeepEqual(visible.Categories, layout.Categories) {
+				t.Errorf("catégories = %v, attendu %v", visible.Categories, layout.Categories)
+			}
+			if visible.Overwrites != nil {
+				t.Errorf("les surcharges ne doivent pas être envoyées aux clients : %v", visible.Overwrites)
+			}
+		})
+	}
+}
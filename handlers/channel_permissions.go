@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"net/url"
+
+	middlewares "github.com/Romain-GUILLEMOT/WhispyrBack/middleware"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils/dbTools"
+	"github.com/gocql/gocql"
+	"github.com/gofiber/fiber/v2"
+)
+
+// loadServerChannel vérifie que le salon appartient au serveur du membre et qu'il peut le voir,
+// puis retourne le salon et les permissions du membre sur ce salon. Un salon invisible est
+// signalé comme introuvable.
+func loadServerChannel(member *models.MemberPermissions, channelID gocql.UUID) (*models.Channel, *models.MemberPermissions, int, string) {
+	if member == nil {
+		return nil, nil, fiber.StatusForbidden, "Vous n'êtes pas membre de ce serveur."
+	}
+	channel, err := dbTools.GetChannelByID(channelID.String())
+	if err != nil || channel.ServerID != member.ServerID {
+		return nil, nil, fiber.StatusNotFound, "Salon introuvable."
+	}
+
+	permissions, err := dbTools.GetChannelPermissions(member, channel)
+	if err != nil {
+		utils.Error("Résolution des permissions du salon impossible", "channelId", channelID, "err", err)
+		return nil, nil, fiber.StatusInternalServerError, "Erreur interne."
+	}
+	if !permissions.Has(models.PermViewChannel) {
+		return nil, nil, fiber.StatusNotFound, "Salon introuvable."
+	}
+	return channel, permissions, 0, ""
+}
+
+// canViewServerChannel indique si un utilisateur est membre du serveur du salon et peut le voir.
+func canViewServerChannel(userID gocql.UUID, channel *models.Channel) (bool, error) {
+	member, err := dbTools.GetMemberPermissions(channel.ServerID, userID)
+	if err == gocql.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	permissions, err := dbTools.GetChannelPermissions(member, channel)
+	if err != nil {
+		return false, err
+	}
+	return permissions.Has(models.PermViewChannel), nil
+}
+
+// visibleChannels indique, pour chaque salon du serveur, si le membre peut le voir.
+func visibleChannels(member *models.MemberPermissions, channels []models.ChannelByServer) (map[gocql.UUID]bool, error) {
+	overwrites, err := dbTools.GetServerOverwrites(member.ServerID)
+	if err != nil {
+		return nil, err
+	}
+	visible := make(map[gocql.UUID]bool, len(channels))
+	for _, channel := range channels {
+		visible[channel.ChannelID] = member.ForChannel(channel.IsPrivate, overwrites[channel.ChannelID]).Has(models.PermViewChannel)
+	}
+	return visible, nil
+}
+
+// filterChannelViewers ne garde que les utilisateurs pouvant voir le salon. memberRoles
+// associe chaque membre du serveur à son rôle.
+func filterChannelViewers(serverID, channelID gocql.UUID, userIDs []gocql.UUID, memberRoles map[gocql.UUID]string) ([]gocql.UUID, error) {
+	if len(userIDs) == 0 {
+		return userIDs, nil
+	}
+	channel, err := dbTools.GetChannelByID(channelID.String())
+	if err != nil {
+		return nil, err
+	}
+	if channel.IsThread() {
+		if channel, err = dbTools.GetChannelByID(channel.ParentChannelID.String()); err != nil {
+			return nil, err
+		}
+	}
+	overwrites, err := dbTools.GetChannelOverwrites(serverID, channel.ChannelID)
+	if err != nil {
+		return nil, err
+	}
+	if !channel.IsPrivate && len(overwrites) == 0 {
+		return userIDs, nil
+	}
+
+	candidates := make(map[gocql.UUID]string, len(userIDs))
+	for _, userID := range userIDs {
+		candidates[userID] = memberRoles[userID]
+	}
+	permissions, err := dbTools.GetMembersPermissions(serverID, candidates)
+	if err != nil {
+		return nil, err
+	}
+	viewers := make([]gocql.UUID, 0, len(userIDs))
+	for _, userID := range userIDs {
+		if permissions[userID].ForChannel(channel.IsPrivate, overwrites).Has(models.PermViewChannel) {
+			viewers = append(viewers, userID)
+		}
+	}
+	return viewers, nil
+}
+
+// overwriteTargetParam décode :target, qui peut être un nom de rôle encodé dans l'URL.
+func overwriteTargetParam(c *fiber.Ctx) string {
+	target, err := url.PathUnescape(c.Params("target"))
+	if err != nil {
+		return c.Params("target")
+	}
+	return target
+}
+
+// parseOverwriteTarget valide la cible d'une surcharge (:targetType, :target) : un rôle
+// existant du serveur (ou @everyone), ou un membre du serveur.
+func parseOverwriteTarget(c *fiber.Ctx, serverID gocql.UUID) (string, string, int, string) {
+	targetType, target := c.Params("targetType"), overwriteTargetParam(c)
+	switch targetType {
+	case models.OverwriteRole:
+		if target == models.RoleEveryone {
+			return targetType, target, 0, ""
+		}
+		if _, err := dbTools.GetServerRole(serverID, target); err != nil {
+			return "", "", fiber.StatusNotFound, "Rôle introuvable."
+		}
+	case models.OverwriteMember:
+		userID, err := gocql.ParseUUID(target)
+		if err != nil {
+			return "", "", fiber.StatusBadRequest, "ID de membre invalide."
+		}
+		isMember, err := dbTools.IsServerMember(serverID, userID)
+		if err != nil {
+			return "", "", fiber.StatusInternalServerError, "Erreur interne."
+		}
+		if !isMember {
+			return "", "", fiber.StatusNotFound, "Membre introuvable."
+		}
+		target = userID.String()
+	default:
+		return "", "", fiber.StatusBadRequest, "Type de cible invalide."
+	}
+	return targetType, target, 0, ""
+}
+
+// checkOverwriteTarget vérifie que l'appelant est au-dessus de la cible d'une surcharge : un
+// rôle qu'il ne dépasse pas, ou un membre de rang égal ou supérieur, ne peut pas être restreint.
+// Une cible disparue (rôle supprimé, membre parti) peut toujours être nettoyée.
+func checkOverwriteTarget(member *models.MemberPermissions, targetType, target string) (int, string) {
+	switch targetType {
+	case models.OverwriteRole:
+		role, err := dbTools.GetServerRole(member.ServerID, target)
+		if err == gocql.ErrNotFound {
+			return 0, ""
+		}
+		if err != nil {
+			return fiber.StatusInternalServerError, "Erreur interne."
+		}
+		if !member.Outranks(role.Position) {
+			return fiber.StatusForbidden, "Vous ne pouvez pas modifier les permissions d'un rôle égal ou supérieur au vôtre."
+		}
+	case models.OverwriteMember:
+		userID, err := gocql.ParseUUID(target)
+		if err != nil {
+			return fiber.StatusBadRequest, "ID de membre invalide."
+		}
+		targetMember, err := dbTools.GetMemberPermissions(member.ServerID, userID)
+		if err == gocql.ErrNotFound {
+			return 0, ""
+		}
+		if err != nil {
+			return fiber.StatusInternalServerError, "Erreur interne."
+		}
+		if targetMember.IsOwner || (targetMember.UserID != member.UserID && !member.Outranks(targetMember.Position)) {
+			return fiber.StatusForbidden, "Vous ne pouvez pas modifier les permissions d'un membre égal ou supérieur à vous."
+		}
+	}
+	return 0, ""
+}
+
+// loadManagedChannel charge le salon :id si l'appelant peut le gérer (MANAGE_CHANNELS sur le salon).
+func loadManagedChannel(c *fiber.Ctx) (*models.MemberPermissions, *models.Channel, int, string) {
+	member := middlewares.GetMember(c)
+	channelID, err := gocql.ParseUUID(c.Params("id"))
+	if err != nil {
+		return nil, nil, fiber.StatusBadRequest, "ID de salon invalide."
+	}
+	channel, permissions, status, msg := loadServerChannel(member, channelID)
+	if channel == nil {
+		return nil, nil, status, msg
+	}
+	if !permissions.Has(models.PermManageChannels) {
+		return nil, nil, fiber.StatusForbidden, "Permission manquante."
+	}
+	return member, channel, 0, ""
+}
+
+// ----------------------
+// 📌 Lister les surcharges de permissions d'un salon
+// ----------------------
+func GetChannelOverwrites(c *fiber.Ctx) error {
+	member, channel, status, msg := loadManagedChannel(c)
+	if channel == nil {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+	if channel.IsThread() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Un thread hérite des permissions de son salon parent."})
+	}
+
+	overwrites, err := dbTools.GetChannelOverwrites(member.ServerID, channel.ChannelID)
+	if err != nil {
+		utils.Error("Lecture des surcharges impossible", "channelId", channel.ChannelID, "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de la lecture des permissions du salon."})
+	}
+	return c.JSON(fiber.Map{"is_private": channel.IsPrivate, "overwrites": overwrites})
+}
+
+// ----------------------
+// 📌 Définir la surcharge d'un rôle ou d'un membre ({allow: [], deny: []})
+// ----------------------
+func PutChannelOverwrite(c *fiber.Ctx) error {
+	member, channel, status, msg := loadManagedChannel(c)
+	if channel == nil {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+	if channel.IsThread() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Un thread hérite des permissions de son salon parent."})
+	}
+	targetType, target, status, msg := parseOverwriteTarget(c, member.ServerID)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+	if status, msg := checkOverwriteTarget(member, targetType, target); status != 0 {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+
+	var reqBody struct {
+		Allow []string `json:"allow"`
+		Deny  []string `json:"deny"`
+	}
+	if err := c.BodyParser(&reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Données invalides."})
+	}
+	denied := make(map[string]bool, len(reqBody.Deny))
+	for _, permission := range reqBody.Deny {
+		if !models.IsOverwritablePermission(permission) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Permission invalide: " + permission})
+		}
+		denied[permission] = true
+	}
+	for _, permission := range reqBody.Allow {
+		if !models.IsOverwritablePermission(permission) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Permission invalide: " + permission})
+		}
+		if denied[permission] {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Une permission ne peut pas être à la fois autorisée et refusée."})
+		}
+		// On ne peut pas accorder sur un salon ce que l'on ne possède pas soi-même.
+		if !member.Has(permission) && permission != models.PermViewChannel {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Vous ne pouvez pas accorder une permission que vous ne possédez pas.", "permission": permission})
+		}
+	}
+
+	overwrite := models.PermissionOverwrite{
+		ServerID:   member.ServerID,
+		ChannelID:  channel.ChannelID,
+		TargetType: targetType,
+		Target:     target,
+		Allow:      reqBody.Allow,
+		Deny:       reqBody.Deny,
+	}
+	if err := dbTools.SaveChannelOverwrite(overwrite); err != nil {
+		utils.Error("Enregistrement de la surcharge impossible", "channelId", channel.ChannelID, "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de la mise à jour des permissions du salon."})
+	}
+
+	publishLayoutUpdate(member.ServerID)
+	publishPermissionsUpdate(member.ServerID, "")
+	return c.JSON(overwrite)
+}
+
+// ----------------------
+// 📌 Supprimer la surcharge d'un rôle ou d'un membre
+// ----------------------
+func DeleteChannelOverwrite(c *fiber.Ctx) error {
+	member, channel, status, msg := loadManagedChannel(c)
+	if channel == nil {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+	if channel.IsThread() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Un thread hérite des permissions de son salon parent."})
+	}
+	targetType, target := c.Params("targetType"), overwriteTargetParam(c)
+	if targetType != models.OverwriteRole && targetType != models.OverwriteMember {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Type de cible invalide."})
+	}
+	if status, msg := checkOverwriteTarget(member, targetType, target); status != 0 {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+
+	if err := dbTools.DeleteChannelOverwrite(member.ServerID, channel.ChannelID, targetType, target); err != nil {
+		utils.Error("Suppression de la surcharge impossible", "channelId", channel.ChannelID, "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de la mise à jour des permissions du salon."})
+	}
+
+	publishLayoutUpdate(member.ServerID)
+	publishPermissionsUpdate(member.ServerID, "")
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -3,14 +3,13 @@ package handlers
 import (
 	"fmt"
 	"github.com/Romain-GUILLEMOT/WhispyrBack/db"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
 	"github.com/Romain-GUILLEMOT/WhispyrBack/utils"
 	"github.com/Romain-GUILLEMOT/WhispyrBack/utils/dbTools"
 	"github.com/gocql/gocql"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"sort"
-	"strconv"
-	"strings"
 	"time"
 )
 
@@ -23,6 +22,9 @@ type ChannelInfo struct {
 	IsPrivate  bool       `json:"is_private"`
 	Position   int        `json:"position"`
 	CategoryID gocql.UUID `json:"category_id"`
+	// État de lecture de l'utilisateur courant
+	Unread       bool `json:"unread"`
+	MentionCount int  `json:"mention_count"`
 }
 
 type CategoryWithChannels struct {
@@ -40,12 +42,29 @@ type MessageInfo struct {
 }
 
 type MessageResponse struct {
-	ID             gocql.UUID `json:"id"`
-	Content        string     `json:"content"`
-	Timestamp      time.Time  `json:"timestamp"`
-	SenderID       gocql.UUID `json:"sender_id"`
-	SenderUsername string     `json:"username"`
-	SenderAvatar   string     `json:"avatar"`
+	ID              gocql.UUID             `json:"id"`
+	Content         string                 `json:"content"`
+	Timestamp       time.Time              `json:"timestamp"`
+	SenderID        gocql.UUID             `json:"sender_id"`
+	SenderUsername  string                 `json:"username"`
+	SenderAvatar    string                 `json:"avatar"`
+	EditedAt        *time.Time             `json:"edited_at,omitempty"`
+	Reactions       []models.ReactionCount `json:"reactions,omitempty"`
+	ReplyTo         *ReplyPreview          `json:"reply_to,omitempty"`
+	ThreadID        *gocql.UUID            `json:"thread_id,omitempty"`
+	Attachments     []models.Attachment    `json:"attachments,omitempty"`
+	Mentions        []gocql.UUID           `json:"mentions,omitempty"`
+	MentionRoles    []string               `json:"mention_roles,omitempty"`
+	MentionEveryone bool                   `json:"mention_everyone,omitempty"`
+}
+
+// ReplyPreview résume le message cité par une réponse. Deleted est vrai si le message a été supprimé.
+type ReplyPreview struct {
+	ID       gocql.UUID `json:"id"`
+	SenderID gocql.UUID `json:"sender_id,omitempty"`
+	Username string     `json:"username,omitempty"`
+	Snippet  string     `json:"snippet,omitempty"`
+	Deleted  bool       `json:"deleted"`
 }
 
 // --- Handlers ---
@@ -61,6 +80,32 @@ func GetServerChannelsAndCategories(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID de serveur invalide."})
 	}
 	utils.Info(fmt.Sprintf("Récupération des données pour le serveur: %s", serverID))
+	rawUserID := c.Locals("user_id").(*uuid.UUID)
+
+	member, err := dbTools.GetMemberPermissions(serverID, gocql.UUID(*rawUserID))
+	if err != nil {
+		if err == gocql.ErrNotFound {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Vous n'êtes pas membre de ce serveur."})
+		}
+		utils.Error("Erreur lors de la résolution des permissions", "error", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Erreur lors de la lecture des salons."})
+	}
+	overwrites, err := dbTools.GetServerOverwrites(serverID)
+	if err != nil {
+		utils.Error("Erreur lors de la lecture des permissions des salons", "error", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Erreur lors de la lecture des salons."})
+	}
+
+	readStates, err := dbTools.GetReadStates(gocql.UUID(*rawUserID))
+	if err != nil {
+		utils.Error("Erreur lors de la lecture des états de lecture", "error", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Erreur lors de la lecture des salons."})
+	}
+	lastMessages, err := dbTools.GetChannelLastMessages(serverID)
+	if err != nil {
+		utils.Error("Erreur lors de la lecture des derniers messages", "error", err)
+		return c.Status(500).JSON(fiber.Map{"message": "Erreur lors de la lecture des salons."})
+	}
 
 	// --- ÉTAPE 1: Récupérer les catégories ---
 	categoriesMap := make(map[gocql.UUID]*CategoryWithChannels)
@@ -97,6 +142,10 @@ func GetServerChannelsAndCategories(c *fiber.Ctx) error {
 	var chanPos int
 
 	for chanIter.Scan(&catID, &chanID, &chanName, &chanType, &isPrivate, &chanPos) {
+		// Les salons que le membre ne peut pas voir sont omis.
+		if !member.ForChannel(isPrivate, overwrites[chanID]).Has(models.PermViewChannel) {
+			continue
+		}
 		channel := ChannelInfo{
 			ChannelID:  chanID,
 			Name:       chanName,
@@ -105,6 +154,10 @@ func GetServerChannelsAndCategories(c *fiber.Ctx) error {
 			Position:   chanPos,
 			CategoryID: catID,
 		}
+		if state := readStates[chanID]; state != nil {
+			channel.MentionCount = state.MentionCount
+		}
+		channel.Unread = readStates[chanID].IsUnread(lastMessages[chanID])
 
 		if category, ok := categoriesMap[catID]; ok {
 			// Le salon a une catégorie valide, on l'ajoute.
@@ -121,7 +174,10 @@ func GetServerChannelsAndCategories(c *fiber.Ctx) error {
 	}
 	utils.Info(fmt.Sprintf("Lecture de %d salons terminée. %d sont non-catégorisés.", len(orderedCategories)+len(uncategorizedChannels), len(uncategorizedChannels)))
 
-	// --- ÉTAPE 3: Trier les canaux au sein de chaque catégorie ---
+	// --- ÉTAPE 3: Trier les catégories, puis les canaux au sein de chaque catégorie ---
+	sort.SliceStable(orderedCategories, func(i, j int) bool {
+		return orderedCategories[i].Position < orderedCategories[j].Position
+	})
 	for _, category := range orderedCategories {
 		sort.Slice(category.Channels, func(i, j int) bool {
 			return category.Channels[i].Position < category.Channels[j].Position
@@ -136,13 +192,13 @@ func GetServerChannelsAndCategories(c *fiber.Ctx) error {
 }
 
 // CreateChannel crée un nouveau salon dans une catégorie.
+// La permission MANAGE_CHANNELS est vérifiée par le middleware RequirePermission.
 func CreateChannel(c *fiber.Ctx) error {
-	// TODO: Ajouter une vérification des permissions (seul un admin peut créer un salon)
-
 	var reqBody struct {
 		CategoryID string `json:"category_id"`
 		Name       string `json:"name"`
 		Type       string `json:"type"` // "text" ou "voice"
+		IsPrivate  bool   `json:"is_private"`
 	}
 
 	if err := c.BodyParser(&reqBody); err != nil {
@@ -153,89 +209,70 @@ func CreateChannel(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID invalide."})
 	}
-
-	rawUserID := c.Locals("user_id").(*uuid.UUID)
-	userID := gocql.UUID(*rawUserID)
-
-	var ownerID gocql.UUID
-	var avatarURL string
-	if err := db.Session.Query(`SELECT owner_id, avatar FROM servers WHERE server_id = ?`, serverID).Scan(&ownerID, &avatarURL); err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Serveur introuvable."})
+	categoryID, err := gocql.ParseUUID(reqBody.CategoryID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID de catégorie invalide."})
 	}
-	if ownerID != userID {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Action non autorisée."})
+	if _, err := dbTools.GetCategory(serverID, categoryID); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Catégorie introuvable."})
 	}
 
-	if err := dbTools.CreateChannelInDB(serverIDStr, reqBody.CategoryID, reqBody.Name, reqBody.Type); err != nil {
+	if err := dbTools.CreateChannelInDB(serverIDStr, reqBody.CategoryID, reqBody.Name, reqBody.Type, reqBody.IsPrivate); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de la création du salon."})
 	}
+	publishLayoutUpdate(serverID)
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"message": "Salon créé avec succès."})
 }
 
-// UpdateChannel modifie un salon existant.
+// UpdateChannel modifie le nom ou la confidentialité d'un salon.
+// La permission MANAGE_CHANNELS est vérifiée sur le salon, surcharges comprises.
 func UpdateChannel(c *fiber.Ctx) error {
-	// TODO: Ajouter une vérification des permissions
-
 	channelID := c.Params("id")
 	var reqBody struct {
-		Name string `json:"name"`
-		// On pourrait ajouter la position, etc.
+		Name      string `json:"name"`
+		IsPrivate *bool  `json:"is_private"`
 	}
 	if err := c.BodyParser(&reqBody); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Données invalides."})
 	}
-	serverIDStr := c.Params("serverId")
-	serverID, err := gocql.ParseUUID(serverIDStr)
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID invalide."})
+	member, channel, status, msg := loadManagedChannel(c)
+	if channel == nil {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
 	}
-
-	rawUserID := c.Locals("user_id").(*uuid.UUID)
-	userID := gocql.UUID(*rawUserID)
-
-	var ownerID gocql.UUID
-	var avatarURL string
-	if err := db.Session.Query(`SELECT owner_id, avatar FROM servers WHERE server_id = ?`, serverID).Scan(&ownerID, &avatarURL); err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Serveur introuvable."})
+	serverID := member.ServerID
+	if reqBody.Name == "" {
+		reqBody.Name = channel.Name
 	}
-	if ownerID != userID {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Action non autorisée."})
+	isPrivate := channel.IsPrivate
+	if reqBody.IsPrivate != nil {
+		isPrivate = *reqBody.IsPrivate
 	}
 
-	if err := dbTools.UpdateChannelInDB(channelID, reqBody.Name); err != nil {
+	if err := dbTools.UpdateChannelInDB(channelID, reqBody.Name, isPrivate); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de la mise à jour du salon."})
 	}
+	publishLayoutUpdate(serverID)
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Salon mis à jour."})
 }
 
 // DeleteChannel supprime un salon.
+// La permission MANAGE_CHANNELS est vérifiée sur le salon, surcharges comprises.
 func DeleteChannel(c *fiber.Ctx) error {
-	// TODO: Ajouter une vérification des permissions
-
 	channelID := c.Params("id")
-	serverIDStr := c.Params("serverId")
-	serverID, err := gocql.ParseUUID(serverIDStr)
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID invalide."})
-	}
-
-	rawUserID := c.Locals("user_id").(*uuid.UUID)
-	userID := gocql.UUID(*rawUserID)
-
-	var ownerID gocql.UUID
-	var avatarURL string
-	if err := db.Session.Query(`SELECT owner_id, avatar FROM servers WHERE server_id = ?`, serverID).Scan(&ownerID, &avatarURL); err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Serveur introuvable."})
-	}
-	if ownerID != userID {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Action non autorisée."})
+	member, channel, status, msg := loadManagedChannel(c)
+	if channel == nil {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
 	}
+	serverID := member.ServerID
 
-	if err := dbTools.DeleteChannelFromDB(channelID); err != nil {
+	threadIDs, err := dbTools.DeleteChannelFromDB(channelID)
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de la suppression du salon."})
 	}
+	unscheduleThreadArchives(threadIDs)
+	publishLayoutUpdate(serverID)
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Salon supprimé."})
 }
@@ -278,8 +315,8 @@ func GetChannelMessages(c *fiber.Ctx) error {
 		}
 	}
 
-	var foundServer gocql.UUID
-	if err := db.Session.Query(`SELECT server_id FROM server_members WHERE server_id = ? AND user_id = ? LIMIT 1`, serverID, userID).Scan(&foundServer); err != nil {
+	member, err := dbTools.GetMemberPermissions(serverID, userID)
+	if err != nil {
 		if err == gocql.ErrNotFound {
 			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Vous n'êtes pas membre de ce serveur."})
 		}
@@ -287,103 +324,222 @@ func GetChannelMessages(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur interne."})
 	}
 
+	// Le salon doit appartenir au serveur et être visible : les messages privés ne sont lisibles que via /api/dms.
+	if channel, _, status, msg := loadServerChannel(member, channelID); channel == nil {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+
+	return respondWithChannelMessages(c, channelID, userID)
+}
+
+// respondWithChannelMessages lit une page de messages d'un salon (serveur ou message privé)
+// selon les paramètres limit, before/cursor, after et around. L'accès au salon doit avoir
+// été vérifié par l'appelant ; userID sert au drapeau "me" des réactions.
+func respondWithChannelMessages(c *fiber.Ctx, channelID, userID gocql.UUID) error {
 	// --- Pagination et Limite ---
-	limitStr := c.Query("limit", "50")
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil || limit <= 0 || limit > 100 {
+	limit := c.QueryInt("limit", 50)
+	if limit <= 0 || limit > 100 {
 		limit = 50
 	}
-	cursorStr := c.Query("cursor")
-	// On fetch beaucoup plus de messages pour pouvoir filtrer et avoir assez de messages pour une page.
-	fetchLimit := limit * 5
 
-	// --- Logique de Day Bucket ---
-	const daysToScan = 30 // Nombre de jours à scanner en arrière
-	dayBuckets := make([]string, 0, daysToScan)
-	startDate := time.Now().UTC()
-	for i := 0; i < daysToScan; i++ {
-		dayBuckets = append(dayBuckets, startDate.AddDate(0, 0, -i).Format("2006-01-02"))
+	// Modes : before (par défaut, "cursor" en alias), after et around.
+	mode, cursorStr := "before", c.Query("before", c.Query("cursor"))
+	if after := c.Query("after"); after != "" {
+		mode, cursorStr = "after", after
+	} else if around := c.Query("around"); around != "" {
+		mode, cursorStr = "around", around
+	}
+
+	var cursor *gocql.UUID
+	if cursorStr != "" {
+		parsed, err := gocql.ParseUUID(cursorStr)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Curseur invalide."})
+		}
+		cursor = &parsed
+	}
+	if mode != "before" && cursor == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Curseur requis pour ce mode."})
 	}
 
-	// --- Construction de la requête ---
-	placeholders := strings.Repeat("?,", len(dayBuckets)-1) + "?"
-	query := fmt.Sprintf(`SELECT sent_at, sender_id, content, sender_username, sender_avatar 
-                          FROM messages_by_channel 
-                          WHERE channel_id = ? AND day_bucket IN (%s) 
-                          LIMIT ?`, placeholders)
+	// --- Lecture bucket par bucket (du plus récent au plus ancien) ---
+	var messages []models.MessageByChannel
+	var hasOlder, hasNewer bool
+	switch mode {
+	case "after":
+		// On lit un message de plus pour savoir s'il reste des messages plus récents.
+		newer, err := dbTools.GetMessagesAfter(channelID, *cursor, limit+1)
+		if err != nil {
+			return messagesReadError(c, err)
+		}
+		hasNewer = len(newer) > limit
+		if hasNewer {
+			newer = newer[:limit]
+		}
+		messages = reverseMessages(newer)
+		hasOlder = true
+	case "around":
+		// Le message visé occupe une place de la page : au plus half messages plus anciens,
+		// les places restantes allant aux plus récents.
+		target, err := dbTools.GetMessage(channelID, *cursor)
+		if err == gocql.ErrNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Message introuvable."})
+		}
+		if err != nil {
+			return messagesReadError(c, err)
+		}
+		half := limit / 2
+		newerLimit := limit - half - 1
+		older, err := dbTools.GetMessagesBefore(channelID, cursor, half+1)
+		if err != nil {
+			return messagesReadError(c, err)
+		}
+		newer, err := dbTools.GetMessagesAfter(channelID, *cursor, newerLimit+1)
+		if err != nil {
+			return messagesReadError(c, err)
+		}
+		hasOlder = len(older) > half
+		if hasOlder {
+			older = older[:half]
+		}
+		hasNewer = len(newer) > newerLimit
+		if hasNewer {
+			newer = newer[:newerLimit]
+		}
+		messages = append(reverseMessages(newer), *target)
+		messages = append(messages, older...)
+	default:
+		older, err := dbTools.GetMessagesBefore(channelID, cursor, limit+1)
+		if err != nil {
+			return messagesReadError(c, err)
+		}
+		hasOlder = len(older) > limit
+		if hasOlder {
+			older = older[:limit]
+		}
+		messages = older
+		hasNewer = cursor != nil
+	}
 
-	args := make([]interface{}, 1+len(dayBuckets)+1)
-	args[0] = channelID
-	for i, bucket := range dayBuckets {
-		args[i+1] = bucket
+	messageIDs := make([]gocql.UUID, 0, len(messages))
+	for _, m := range messages {
+		messageIDs = append(messageIDs, m.SentAt)
+	}
+	reactions, err := dbTools.GetReactions(channelID, messageIDs, userID)
+	if err != nil {
+		return messagesReadError(c, err)
 	}
-	args[len(args)-1] = fetchLimit
 
-	iter := db.Session.Query(query, args...).Iter()
+	replies, err := buildReplyPreviews(channelID, messages)
+	if err != nil {
+		return messagesReadError(c, err)
+	}
 
-	// --- Scan des résultats ---
-	allMessages := make([]MessageResponse, 0, fetchLimit)
-	var msgID, senderID gocql.UUID
-	var content string
-	var senderUsername, senderAvatar *string
+	finalMessages := make([]MessageResponse, 0, len(messages))
+	for _, m := range messages {
+		response := toMessageResponse(m)
+		response.Reactions = reactions[m.SentAt]
+		response.ReplyTo = replies[m.ReplyTo]
+		finalMessages = append(finalMessages, response)
+	}
 
-	for iter.Scan(&msgID, &senderID, &content, &senderUsername, &senderAvatar) {
-		var finalUsername, finalAvatar string
-		if senderUsername != nil {
-			finalUsername = *senderUsername
+	// next_cursor : page plus ancienne (?before=), prev_cursor : page plus récente (?after=).
+	var nextCursor, prevCursor string
+	if len(finalMessages) > 0 {
+		if hasOlder {
+			nextCursor = finalMessages[len(finalMessages)-1].ID.String()
 		}
-		if senderAvatar != nil {
-			finalAvatar = *senderAvatar
+		if hasNewer {
+			prevCursor = finalMessages[0].ID.String()
 		}
-		allMessages = append(allMessages, MessageResponse{
-			ID:             msgID,
-			Content:        content,
-			Timestamp:      msgID.Time(),
-			SenderID:       senderID,
-			SenderUsername: finalUsername,
-			SenderAvatar:   finalAvatar,
-		})
 	}
 
-	if err := iter.Close(); err != nil {
-		utils.Error("Erreur lors de la lecture des messages", "error", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de la récupération des messages."})
+	return c.JSON(fiber.Map{
+		"data":        finalMessages,
+		"next_cursor": nextCursor,
+		"prev_cursor": prevCursor,
+	})
+}
+
+// toMessageResponse convertit une ligne de messages_by_channel au format de l'API.
+func toMessageResponse(m models.MessageByChannel) MessageResponse {
+	response := MessageResponse{
+		ID:              m.SentAt,
+		Content:         m.Content,
+		Timestamp:       m.SentAt.Time(),
+		SenderID:        m.SenderID,
+		SenderUsername:  m.SenderUsername,
+		SenderAvatar:    m.SenderAvatar,
+		Attachments:     m.Attachments,
+		Mentions:        m.Mentions,
+		MentionRoles:    m.MentionRoles,
+		MentionEveryone: m.MentionEveryone,
+	}
+	if !m.EditedAt.IsZero() {
+		editedAt := m.EditedAt
+		response.EditedAt = &editedAt
+	}
+	if m.ThreadID != (gocql.UUID{}) {
+		threadID := m.ThreadID
+		response.ThreadID = &threadID
+	}
+	return response
+}
+
+const replySnippetLength = 100
+
+// buildReplyPreviews construit l'aperçu des messages cités par une page de messages.
+// Les messages cités absents de la page sont lus individuellement.
+func buildReplyPreviews(channelID gocql.UUID, messages []models.MessageByChannel) (map[gocql.UUID]*ReplyPreview, error) {
+	page := make(map[gocql.UUID]*models.MessageByChannel, len(messages))
+	for i := range messages {
+		page[messages[i].SentAt] = &messages[i]
 	}
 
-	// --- Tri et Filtrage en mémoire ---
-	sort.Slice(allMessages, func(i, j int) bool {
-		return allMessages[i].Timestamp.After(allMessages[j].Timestamp)
-	})
+	previews := make(map[gocql.UUID]*ReplyPreview)
+	for _, m := range messages {
+		if m.ReplyTo == (gocql.UUID{}) || previews[m.ReplyTo] != nil {
+			continue
+		}
 
-	var messagesToConsider []MessageResponse
-	if cursorStr != "" {
-		cursorUUID, err := gocql.ParseUUID(cursorStr)
-		if err == nil {
-			cursorTime := cursorUUID.Time()
-			for _, msg := range allMessages {
-				if msg.Timestamp.Before(cursorTime) {
-					messagesToConsider = append(messagesToConsider, msg)
-				}
+		preview := &ReplyPreview{ID: m.ReplyTo}
+		parent, ok := page[m.ReplyTo]
+		if !ok {
+			var err error
+			parent, err = dbTools.GetMessage(channelID, m.ReplyTo)
+			if err != nil && err != gocql.ErrNotFound {
+				return nil, err
 			}
+		}
+		if parent == nil {
+			preview.Deleted = true
 		} else {
-			messagesToConsider = allMessages
+			preview.SenderID = parent.SenderID
+			preview.Username = parent.SenderUsername
+			preview.Snippet = snippet(parent.Content, replySnippetLength)
 		}
-	} else {
-		messagesToConsider = allMessages
+		previews[m.ReplyTo] = preview
 	}
+	return previews, nil
+}
 
-	// --- Détermination de la page finale et du prochain curseur ---
-	var finalMessages []MessageResponse
-	var nextCursor string
-	if len(messagesToConsider) > limit {
-		finalMessages = messagesToConsider[:limit]
-		nextCursor = finalMessages[len(finalMessages)-1].ID.String()
-	} else {
-		finalMessages = messagesToConsider
+// snippet tronque un texte à max caractères (runes) en ajoutant une ellipse.
+func snippet(content string, max int) string {
+	runes := []rune(content)
+	if len(runes) <= max {
+		return content
 	}
+	return string(runes[:max]) + "…"
+}
 
-	return c.JSON(fiber.Map{
-		"data":        finalMessages,
-		"next_cursor": nextCursor,
-	})
+func reverseMessages(messages []models.MessageByChannel) []models.MessageByChannel {
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages
+}
+
+func messagesReadError(c *fiber.Ctx, err error) error {
+	utils.Error("Erreur lors de la lecture des messages", "error", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de la récupération des messages."})
 }
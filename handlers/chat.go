@@ -4,11 +4,14 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
 	"github.com/Romain-GUILLEMOT/WhispyrBack/utils"
 	"github.com/Romain-GUILLEMOT/WhispyrBack/utils/dbTools" // Assurez-vous que ce chemin est correct
 	"github.com/goccy/go-json"
+	"github.com/gocql/gocql"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/websocket/v2"
 	"github.com/google/uuid"
@@ -18,31 +21,75 @@ type Client struct {
 	UserID           uuid.UUID
 	Username         string
 	Avatar           string
-	Conn             *websocket.Conn
 	CurrentServerID  string // Le serveur actuellement "sélectionné" par le client (contexte principal)
 	CurrentChannelID string // Le canal actuellement "actif" par le client pour la communication
+	InThread         bool   // CurrentChannelID est un thread (suivi d'activité pour l'archivage)
+	// Permissions résolues sur CurrentServerID lors du join_server, puis à chaque permissions_update
+	Permissions *models.MemberPermissions
+	// Serveurs dont l'utilisateur est membre (cache de la connexion, nil = à recharger depuis Redis)
+	Memberships map[string]bool
+	// Dernier typing_start accepté (limitation de débit, lu et écrit par la boucle de lecture uniquement)
+	LastTypingAt time.Time
+	// Dernier heartbeat reçu (UnixNano), surveillé par le reaper
+	lastHeartbeat atomic.Int64
+	// La session a été ouverte par identify (l'utilisateur est annoncé en ligne)
+	identified atomic.Bool
+
+	// Session du gateway : elle survit à la connexion pendant resumeTimeout pour permettre un resume.
+	SessionID string
+	// Connexion attachée à la session (nil si détachée), protégée par connMu
+	Conn   *websocket.Conn
+	connMu sync.Mutex
+	// Dernier numéro attribué (seqMu) et dernier numéro conservé dans le tampon de reprise (connMu)
+	seq       int64
+	seqMu     sync.Mutex
+	delivered int64
+	// Tampon de reprise en mémoire, ou recopié dans Redis depuis le détachement (persisted), protégé par connMu
+	replay    []queuedEvent
+	persisted bool
+	// Fin de la fenêtre de reprise d'une session détachée (connMu)
+	resumeTimer *time.Timer
+	ended       bool
+
+	send      chan queuedEvent // File d'envoi bornée, vidée par pump
+	done      chan struct{}    // Fermé à la fermeture de la session
+	pumpDone  chan struct{}    // Fermé quand pump s'est arrêté
+	closeOnce sync.Once
 }
 
 type Message struct {
-	Type        string `json:"type"`
-	ServerID    string `json:"serverId,omitempty"`
-	ChannelID   string `json:"channelId,omitempty"`
-	ChannelName string `json:"channelName,omitempty"`
-	ServerName  string `json:"serverName,omitempty"`
-	UserID      string `json:"userId,omitempty"`
-	Username    string `json:"username,omitempty"`
-	Avatar      string `json:"avatar,omitempty"`
-	Content     string `json:"content,omitempty"`
-	Timestamp   int64  `json:"timestamp,omitempty"`
-	Status      string `json:"status,omitempty"`
-	// RecipientID est retiré car les messages privés ne sont pas gérés pour le moment.
+	Type      string `json:"type"`
+	Op        string `json:"op,omitempty"`        // Opération refusée (trame error)
+	SessionID string `json:"sessionId,omitempty"` // Session du gateway (ready, resume, resumed)
+	Seq       int64  `json:"seq,omitempty"`       // Dernier numéro reçu par le client (resume)
+	// Intervalle attendu entre deux heartbeats, en millisecondes (hello, ready)
+	HeartbeatInterval int64               `json:"heartbeatInterval,omitempty"`
+	Code              string              `json:"code,omitempty"` // Code du refus (trame error)
+	ServerID          string              `json:"serverId,omitempty"`
+	ChannelID         string              `json:"channelId,omitempty"`
+	ChannelName       string              `json:"channelName,omitempty"`
+	MessageID         string              `json:"messageId,omitempty"`
+	ReplyTo           string              `json:"replyTo,omitempty"`  // ID du message auquel on répond
+	ThreadID          string              `json:"threadId,omitempty"` // Thread concerné (thread_create, thread_update)
+	Nonce             string              `json:"nonce,omitempty"`    // Fourni par le client, renvoyé tel quel pour l'UI optimiste
+	ServerName        string              `json:"serverName,omitempty"`
+	UserID            string              `json:"userId,omitempty"`
+	Username          string              `json:"username,omitempty"`
+	Avatar            string              `json:"avatar,omitempty"`
+	Content           string              `json:"content,omitempty"`
+	Attachments       []models.Attachment `json:"attachments,omitempty"`
+	Mentions          []string            `json:"mentions,omitempty"` // Utilisateurs mentionnés explicitement (chat)
+	Typing            []string            `json:"typing,omitempty"`   // Utilisateurs en train d'écrire (join_channel_success)
+	Emoji             string              `json:"emoji,omitempty"`
+	Timestamp         int64               `json:"timestamp,omitempty"`
+	Status            string              `json:"status,omitempty"`
+	// RecipientIDs cible les membres d'un salon privé : l'événement leur est livré quel que soit leur CurrentServerID.
+	// Transmis par Redis, il est retiré par dispatchEvent avant l'envoi aux clients.
+	RecipientIDs []string `json:"recipientIds,omitempty"`
+	// Layout porte la nouvelle disposition des salons (channel_layout_update).
+	Layout *ChannelLayout `json:"layout,omitempty"`
 }
 
-var (
-	clients      = make(map[*websocket.Conn]*Client)
-	clientsMutex = &sync.RWMutex{}
-)
-
 func WebSocketHandler(c *fiber.Ctx) error {
 	if websocket.IsWebSocketUpgrade(c) {
 		return c.Next()
@@ -73,45 +120,17 @@ func HandleWebSocket(c *websocket.Conn) {
 		Conn:     c,
 	}
 
-	clientsMutex.Lock()
-	clients[c] = currentClient
-	clientsMutex.Unlock()
-
-	go func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		if err := utils.RedisSAdd(ctx, "online_users", currentClient.UserID.String()); err != nil {
-			utils.Error("Erreur RedisSAdd online_users pour " + currentClient.UserID.String() + ": " + err.Error())
-		}
-		presenceOnlineMsg, _ := json.Marshal(Message{
-			Type: "presence", UserID: currentClient.UserID.String(), Username: currentClient.Username,
-			Avatar: currentClient.Avatar, Content: "s'est connecté", Status: "online", Timestamp: time.Now().UnixNano() / int64(time.Millisecond),
-		})
-		if err := utils.RedisPublish(ctx, "user:presence:updates", presenceOnlineMsg); err != nil {
-			utils.Error("Erreur publication présence online: " + err.Error())
-		}
-	}()
+	hub.register(currentClient)
+	// Le client doit répondre par identify ou resume.
+	sendHello(currentClient)
 
 	utils.Info("🎉 Utilisateur connecté: " + currentClient.Username + " (" + currentClient.UserID.String() + ")")
 
+	// La session survit à la connexion pendant sa fenêtre de reprise.
 	defer func() {
 		utils.Info("🧹 Déconnexion détectée pour: " + currentClient.Username)
-		clientsMutex.Lock()
-		delete(clients, c)
-		clientsMutex.Unlock()
-		c.Close()
-
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		if err := utils.RedisSRem(ctx, "online_users", currentClient.UserID.String()); err != nil {
-			utils.Error("Erreur SRem online_users pour " + currentClient.UserID.String() + ": " + err.Error())
-		}
-		presenceOfflineMsg, _ := json.Marshal(Message{
-			Type: "presence", UserID: currentClient.UserID.String(), Username: currentClient.Username,
-			Avatar: currentClient.Avatar, Content: "s'est déconnecté", Status: "offline", Timestamp: time.Now().UnixNano() / int64(time.Millisecond),
-		})
-		if err := utils.RedisPublish(ctx, "user:presence:updates", presenceOfflineMsg); err != nil {
-			utils.Error("Erreur publication présence offline: " + err.Error())
+		if currentClient.detach(c) {
+			endSession(currentClient)
 		}
 	}()
 
@@ -127,73 +146,156 @@ func HandleWebSocket(c *websocket.Conn) {
 		var incomingMessage Message
 		if err := json.Unmarshal(rawMsg, &incomingMessage); err != nil {
 			utils.Error("Erreur unmarshalling message entrant JSON: " + err.Error())
+			sendGatewayError(currentClient, incomingMessage, newGatewayError(gatewayInvalidRequest, "Trame JSON invalide."))
+			continue
+		}
+
+		// Avant identify ou resume, seul le heartbeat est accepté.
+		if !currentClient.identified.Load() && incomingMessage.Type != "identify" && incomingMessage.Type != "resume" && incomingMessage.Type != "heartbeat" {
+			sendGatewayError(currentClient, incomingMessage, newGatewayError(gatewayNotIdentified, "Envoyez identify ou resume avant toute autre opération."))
 			continue
 		}
 
 		switch incomingMessage.Type {
+		case "identify":
+			if err := handleIdentify(currentClient); err != nil {
+				utils.Warn("identify refusé pour " + currentClient.Username + ": " + err.Error())
+				sendGatewayError(currentClient, incomingMessage, err)
+			}
+		case "resume":
+			if currentClient.identified.Load() {
+				sendGatewayError(currentClient, incomingMessage, newGatewayError(gatewayInvalidRequest, "Session déjà identifiée."))
+				break
+			}
+			resumed, err := handleResume(currentClient, incomingMessage)
+			if err != nil {
+				utils.Warn("resume refusé pour " + currentClient.Username + ": " + err.Error())
+				sendGatewayError(currentClient, incomingMessage, err)
+				break
+			}
+			currentClient = resumed
 		case "chat":
 			handleChatMessage(currentClient, incomingMessage)
 		case "join_server":
-			if err := handleJoinServer(c, currentClient, incomingMessage); err != nil {
-				utils.Error("Erreur lors de la jointure du serveur pour " + currentClient.Username + ": " + err.Error())
+			if err := handleJoinServer(currentClient, incomingMessage); err != nil {
+				utils.Warn("join_server refusé pour " + currentClient.Username + ": " + err.Error())
+				sendGatewayError(currentClient, incomingMessage, err)
 			}
 		case "leave_server":
-			handleLeaveServer(c, currentClient, incomingMessage)
+			handleLeaveServer(currentClient, incomingMessage)
 		case "join_channel":
-			if err := handleJoinChannel(c, currentClient, incomingMessage); err != nil {
-				utils.Error("Erreur lors de la jointure du canal pour " + currentClient.Username + ": " + err.Error())
+			if err := handleJoinChannel(currentClient, incomingMessage); err != nil {
+				utils.Warn("join_channel refusé pour " + currentClient.Username + ": " + err.Error())
+				sendGatewayError(currentClient, incomingMessage, err)
 			}
 		case "leave_channel":
-			handleLeaveChannel(c, currentClient, incomingMessage)
+			handleLeaveChannel(currentClient, incomingMessage)
+		case "message_edit", "message_delete", "reaction_add", "reaction_remove":
+			if err := handleMessageMutation(currentClient, incomingMessage); err != nil {
+				utils.Warn(incomingMessage.Type + " refusé pour " + currentClient.Username + ": " + err.Error())
+				sendGatewayError(currentClient, incomingMessage, err)
+			}
+		case "typing_start":
+			if err := handleTypingStart(currentClient, incomingMessage); err != nil {
+				utils.Warn("typing_start ignoré pour " + currentClient.Username + ": " + err.Error())
+			}
+		case "message_ack":
+			if err := handleMessageAck(currentClient, incomingMessage); err != nil {
+				utils.Warn("message_ack refusé pour " + currentClient.Username + ": " + err.Error())
+				sendGatewayError(currentClient, incomingMessage, err)
+			}
 		case "heartbeat":
 			if err := handleHeartbeat(currentClient); err != nil {
 				utils.Error("Erreur heartbeat pour " + currentClient.Username + ": " + err.Error())
 			}
 		default:
 			utils.Warn("Type de message inconnu reçu du client: " + incomingMessage.Type)
+			sendGatewayError(currentClient, incomingMessage, newGatewayError(gatewayInvalidRequest, "Type de message inconnu."))
 		}
 	}
 }
 
-func handleJoinServer(c *websocket.Conn, currentClient *Client, incomingMessage Message) error {
-	if incomingMessage.ServerID == "" {
-		return fmt.Errorf("ServerID manquant pour la requête join_server")
+// endSession termine une session : elle quitte le hub et, si c'était la dernière session
+// en ligne de l'utilisateur, celui-ci est annoncé hors ligne.
+func endSession(client *Client) {
+	hub.unregister(client)
+	dropReplayBuffer(client.SessionID)
+	if !client.identified.Load() {
+		return // Jamais annoncée en ligne
 	}
 
-	clientsMutex.Lock()
-	currentClient.CurrentServerID = incomingMessage.ServerID
-	currentClient.CurrentChannelID = "" // Le client devra explicitement rejoindre un canal après
-	clientsMutex.Unlock()
+	wentOffline, err := clearPresence(client)
+	if err != nil {
+		utils.Error("Erreur retrait de la présence pour " + client.UserID.String() + ": " + err.Error())
+	}
+	if wentOffline {
+		announceOffline(gocql.UUID(client.UserID), client.Username, client.Avatar)
+	}
+}
 
-	utils.Info(fmt.Sprintf("Utilisateur %s a rejoint (sélectionné) le serveur [%s]", currentClient.Username, currentClient.CurrentServerID))
+// announceOffline termine la présence d'un utilisateur sans session en ligne, à la fin de
+// sa dernière session ou quand le reaper constate l'expiration de toutes ses sessions.
+func announceOffline(userID gocql.UUID, username, avatar string) {
+	// Les adhésions temporaires (invitation "temporary") prennent fin avec la dernière connexion.
+	if err := dbTools.RemoveTemporaryMemberships(userID); err != nil {
+		utils.Error("Erreur suppression des adhésions temporaires pour " + userID.String() + ": " + err.Error())
+	}
+	dropMembershipCache(userID)
 
-	server, err := dbTools.GetServerByID(incomingMessage.ServerID)
+	publishUserEvent(Message{
+		Type: "presence", UserID: userID.String(), Username: username,
+		Avatar: avatar, Content: "s'est déconnecté", Status: "offline", Timestamp: time.Now().UnixNano() / int64(time.Millisecond),
+		RecipientIDs: presenceAudience(userID),
+	})
+}
+
+func handleJoinServer(currentClient *Client, incomingMessage Message) error {
+	if incomingMessage.ServerID == "" {
+		return newGatewayError(gatewayInvalidRequest, "ServerID manquant.")
+	}
+	serverUUID, err := gocql.ParseUUID(incomingMessage.ServerID)
 	if err != nil {
-		return fmt.Errorf("impossible de récupérer les détails du serveur %s: %w", incomingMessage.ServerID, err)
+		return newGatewayError(gatewayInvalidRequest, "ID de serveur invalide.")
+	}
+	if err := requireMembership(currentClient, serverUUID.String()); err != nil {
+		return err
 	}
 
-	confirmationMsg := Message{
-		Type:       "join_server_success",
-		ServerID:   server.ServerID.String(),
-		ServerName: server.Name,
+	permissions, err := dbTools.GetMemberPermissions(serverUUID, gocql.UUID(currentClient.UserID))
+	if err == gocql.ErrNotFound {
+		// Le cache était périmé : il sera rechargé à la prochaine opération.
+		dropMembershipCache(gocql.UUID(currentClient.UserID))
+		resetMemberships([]*Client{currentClient})
+		return newGatewayError(gatewayNotMember, "Vous n'êtes pas membre de ce serveur.")
 	}
-	marshaledMsg, err := json.Marshal(confirmationMsg)
 	if err != nil {
-		return fmt.Errorf("erreur lors de l'encodage JSON du message de confirmation: %w", err)
+		return fmt.Errorf("permissions introuvables sur le serveur %s: %w", incomingMessage.ServerID, err)
 	}
 
-	if err := c.WriteMessage(websocket.TextMessage, marshaledMsg); err != nil {
-		return fmt.Errorf("erreur envoi confirmation de join à %s: %w", currentClient.Username, err)
+	server, err := dbTools.GetServerByID(serverUUID.String())
+	if err == gocql.ErrNotFound {
+		return newGatewayError(gatewayUnknownServer, "Serveur introuvable.")
+	}
+	if err != nil {
+		return fmt.Errorf("impossible de récupérer les détails du serveur %s: %w", incomingMessage.ServerID, err)
 	}
+
+	// Le client devra explicitement rejoindre un canal après
+	hub.joinServer(currentClient, serverUUID.String(), permissions)
+
+	utils.Info(fmt.Sprintf("Utilisateur %s a rejoint (sélectionné) le serveur [%s]", currentClient.Username, serverUUID.String()))
+
+	sendToClient(currentClient, Message{
+		Type:       "join_server_success",
+		ServerID:   server.ServerID.String(),
+		ServerName: server.Name,
+	})
 	return nil
 }
 
-func handleLeaveServer(c *websocket.Conn, currentClient *Client, incomingMessage Message) {
-	if currentClient.CurrentServerID == incomingMessage.ServerID {
-		clientsMutex.Lock()
-		currentClient.CurrentServerID = ""  // Réinitialise le serveur actuel
-		currentClient.CurrentChannelID = "" // Réinitialise le canal aussi
-		clientsMutex.Unlock()
+func handleLeaveServer(currentClient *Client, incomingMessage Message) {
+	// Réinitialise le serveur actuel et le canal aussi
+	if hub.leaveServer(currentClient, incomingMessage.ServerID) {
 		utils.Info(fmt.Sprintf("Utilisateur %s a quitté le serveur [%s]", currentClient.Username, incomingMessage.ServerID))
 
 		leaveMsg, _ := json.Marshal(Message{
@@ -205,58 +307,55 @@ func handleLeaveServer(c *websocket.Conn, currentClient *Client, incomingMessage
 		defer cancel()
 		utils.RedisPublish(ctx, "server:presence:updates:"+incomingMessage.ServerID, leaveMsg)
 
-		confirmationMsg, _ := json.Marshal(Message{Type: "leave_server_success", ServerID: incomingMessage.ServerID})
-		if err := c.WriteMessage(websocket.TextMessage, confirmationMsg); err != nil {
-			utils.Error("Erreur envoi confirmation de leave à " + currentClient.Username + ": " + err.Error())
-		}
+		sendToClient(currentClient, Message{Type: "leave_server_success", ServerID: incomingMessage.ServerID})
 	} else {
 		utils.Warn(fmt.Sprintf("Utilisateur %s a tenté de quitter le serveur %s mais n'y est pas (actuellement dans %s)",
 			currentClient.Username, incomingMessage.ServerID, currentClient.CurrentServerID))
 	}
 }
 
-func handleJoinChannel(c *websocket.Conn, currentClient *Client, incomingMessage Message) error {
+func handleJoinChannel(currentClient *Client, incomingMessage Message) error {
 	if incomingMessage.ServerID == "" || incomingMessage.ChannelID == "" {
-		return fmt.Errorf("ServerID ou ChannelID manquant pour la requête join_channel")
+		return newGatewayError(gatewayInvalidRequest, "ServerID ou ChannelID manquant.")
 	}
 
-	if currentClient.CurrentServerID != incomingMessage.ServerID {
-		return fmt.Errorf("le client n'est pas actif dans le serveur %s pour rejoindre le canal %s", incomingMessage.ServerID, incomingMessage.ChannelID)
+	hub.mu.RLock()
+	currentServerID, member := currentClient.CurrentServerID, currentClient.Permissions
+	hub.mu.RUnlock()
+	if currentServerID != incomingMessage.ServerID || member == nil {
+		return newGatewayError(gatewayNotInServer, "Rejoignez d'abord le serveur de ce salon.")
 	}
-
-	clientsMutex.Lock()
-	currentClient.CurrentChannelID = incomingMessage.ChannelID
-	clientsMutex.Unlock()
-
-	utils.Info(fmt.Sprintf("Utilisateur %s a rejoint le canal [%s] du serveur [%s]", currentClient.Username, incomingMessage.ChannelID, incomingMessage.ServerID))
-
-	channel, err := dbTools.GetChannelByID(incomingMessage.ChannelID)
-	if err != nil {
-		return fmt.Errorf("impossible de récupérer les détails du serveur %s: %w", incomingMessage.ChannelID, err)
+	if err := requireMembership(currentClient, incomingMessage.ServerID); err != nil {
+		return err
 	}
 
-	confirmationMsg, err := json.Marshal(Message{Type: "join_channel_success", ServerID: incomingMessage.ServerID, ChannelID: incomingMessage.ChannelID, ChannelName: channel.Name})
+	channelID, err := gocql.ParseUUID(incomingMessage.ChannelID)
 	if err != nil {
-		return fmt.Errorf("erreur lors de l'encodage JSON du message de confirmation: %w", err)
+		return newGatewayError(gatewayInvalidRequest, "ID de salon invalide.")
 	}
-
-	if err := c.WriteMessage(websocket.TextMessage, confirmationMsg); err != nil {
-		return fmt.Errorf("erreur envoi confirmation de join channel à %s: %w", currentClient.Username, err)
+	// Le salon doit appartenir au serveur actif et être visible par le membre.
+	channel, _, status, msg := loadServerChannel(member, channelID)
+	if channel == nil {
+		return gatewayErrorFromStatus(status, msg)
 	}
+
+	hub.joinChannel(currentClient, incomingMessage.ChannelID, channel.IsThread())
+
+	utils.Info(fmt.Sprintf("Utilisateur %s a rejoint le canal [%s] du serveur [%s]", currentClient.Username, incomingMessage.ChannelID, incomingMessage.ServerID))
+
+	sendToClient(currentClient, Message{
+		Type: "join_channel_success", ServerID: incomingMessage.ServerID, ChannelID: incomingMessage.ChannelID, ChannelName: channel.Name,
+		Typing: typingSnapshot(incomingMessage.ChannelID, currentClient.UserID.String()),
+	})
 	return nil
 }
 
-func handleLeaveChannel(c *websocket.Conn, currentClient *Client, incomingMessage Message) {
-	if currentClient.CurrentChannelID == incomingMessage.ChannelID {
-		clientsMutex.Lock()
-		currentClient.CurrentChannelID = "" // Réinitialise le canal actif
-		clientsMutex.Unlock()
+func handleLeaveChannel(currentClient *Client, incomingMessage Message) {
+	// Réinitialise le canal actif
+	if hub.leaveChannel(currentClient, incomingMessage.ChannelID) {
 		utils.Info(fmt.Sprintf("Utilisateur %s a quitté le canal [%s] du serveur [%s]", currentClient.Username, incomingMessage.ChannelID, incomingMessage.ServerID))
 
-		confirmationMsg, _ := json.Marshal(Message{Type: "leave_channel_success", ServerID: incomingMessage.ServerID, ChannelID: incomingMessage.ChannelID})
-		if err := c.WriteMessage(websocket.TextMessage, confirmationMsg); err != nil {
-			utils.Error("Erreur envoi confirmation de leave channel à " + currentClient.Username + ": " + err.Error())
-		}
+		sendToClient(currentClient, Message{Type: "leave_channel_success", ServerID: incomingMessage.ServerID, ChannelID: incomingMessage.ChannelID})
 	} else {
 		utils.Warn(fmt.Sprintf("Utilisateur %s a tenté de quitter le canal %s mais n'y est pas (actuellement dans %s)",
 			currentClient.Username, incomingMessage.ChannelID, currentClient.CurrentChannelID))
@@ -264,69 +363,224 @@ func handleLeaveChannel(c *websocket.Conn, currentClient *Client, incomingMessag
 }
 
 func handleChatMessage(currentClient *Client, incomingMessage Message) {
+	// Sans ServerID, le message vise un salon privé (DM ou groupe).
+	if incomingMessage.ServerID == "" && incomingMessage.ChannelID != "" {
+		handleDirectMessage(currentClient, incomingMessage)
+		return
+	}
 	if incomingMessage.ServerID == "" || incomingMessage.ChannelID == "" || incomingMessage.Content == "" {
 		utils.Warn(fmt.Sprintf("Message de chat incomplet de %s.", currentClient.Username))
+		sendChatError(currentClient, incomingMessage, "Message incomplet.")
 		return
 	}
+	if len(incomingMessage.Content) > maxMessageLength {
+		sendChatError(currentClient, incomingMessage, "Message trop long.")
+		return
+	}
+
+	// Les permissions peuvent être rafraîchies par le broadcaster (permissions_update).
+	hub.mu.RLock()
+	currentServerID, currentChannelID := currentClient.CurrentServerID, currentClient.CurrentChannelID
+	member, inThread := currentClient.Permissions, currentClient.InThread
+	hub.mu.RUnlock()
 
-	if currentClient.CurrentServerID != incomingMessage.ServerID || currentClient.CurrentChannelID != incomingMessage.ChannelID {
+	if currentServerID != incomingMessage.ServerID || currentChannelID != incomingMessage.ChannelID {
 		utils.Warn(fmt.Sprintf(
 			"Message rejeté de %s. Le client n'est pas dans le serveur/canal spécifié. Client: S[%s]/C[%s], Msg: S[%s]/C[%s]",
 			currentClient.Username,
-			currentClient.CurrentServerID,
-			currentClient.CurrentChannelID,
+			currentServerID,
+			currentChannelID,
 			incomingMessage.ServerID,
 			incomingMessage.ChannelID,
 		))
+		sendChatError(currentClient, incomingMessage, "Vous n'êtes pas dans ce salon.")
+		return
+	}
+
+	if err := requireMembership(currentClient, incomingMessage.ServerID); err != nil {
+		sendChatError(currentClient, incomingMessage, err.(*gatewayError).Reason)
 		return
 	}
 
-	chatMsg := Message{
-		Type:      "chat",
+	channelID, err := gocql.ParseUUID(incomingMessage.ChannelID)
+	if err != nil {
+		sendChatError(currentClient, incomingMessage, "ID de salon invalide.")
+		return
+	}
+
+	// Les permissions sont résolues à chaque message : une surcharge a pu changer depuis le join_channel.
+	channel, permissions, _, errMsg := loadServerChannel(member, channelID)
+	if channel == nil {
+		sendChatError(currentClient, incomingMessage, errMsg)
+		return
+	}
+	if !permissions.Has(models.PermSendMessages) {
+		utils.Warn(fmt.Sprintf("Message rejeté de %s: permission %s manquante sur le salon %s.", currentClient.Username, models.PermSendMessages, incomingMessage.ChannelID))
+		sendChatError(currentClient, incomingMessage, "Permission manquante.")
+		return
+	}
+
+	replyTo, errMsg := resolveReplyTo(channelID, incomingMessage.ReplyTo)
+	if errMsg != "" {
+		sendChatError(currentClient, incomingMessage, errMsg)
+		return
+	}
+
+	message := &models.MessageByChannel{
+		ChannelID:      channelID,
+		SenderID:       gocql.UUID(currentClient.UserID),
+		SenderUsername: currentClient.Username,
+		SenderAvatar:   currentClient.Avatar,
+		Content:        incomingMessage.Content,
+		ReplyTo:        replyTo,
+	}
+	mentioned, err := resolveMentions(member, message)
+	if err != nil {
+		utils.Error("Résolution des mentions impossible pour " + currentClient.Username + ": " + err.Error())
+	}
+
+	event, err := createChannelMessage(incomingMessage.ServerID, nil, message, incomingMessage.Nonce)
+	if err != nil {
+		sendChatError(currentClient, incomingMessage, "Le message n'a pas pu être enregistré.")
+		return
+	}
+	notifyMentions(event, member.ServerID, message, mentioned)
+	clearTyping(incomingMessage.ChannelID, currentClient.UserID.String())
+
+	if inThread {
+		touchThread(incomingMessage.ServerID, channelID)
+	}
+}
+
+// sendChatError prévient l'auteur qu'un message n'a pas été accepté. Le nonce
+// fourni par le client est renvoyé pour retirer le message optimiste.
+func sendChatError(currentClient *Client, incomingMessage Message, reason string) {
+	sendToClient(currentClient, Message{
+		Type:      "chat_error",
 		ServerID:  incomingMessage.ServerID,
 		ChannelID: incomingMessage.ChannelID,
-		UserID:    currentClient.UserID.String(),
-		Username:  currentClient.Username,
-		Avatar:    currentClient.Avatar,
-		Content:   incomingMessage.Content,
+		Nonce:     incomingMessage.Nonce,
+		Content:   reason,
 		Timestamp: time.Now().UnixNano() / int64(time.Millisecond),
-	}
-	marshaledChatMsg, err := json.Marshal(chatMsg)
+	})
+}
+
+// sendToClient place un message dans la file d'envoi d'un client.
+func sendToClient(client *Client, msg Message) {
+	payload, err := json.Marshal(msg)
 	if err != nil {
-		utils.Error("Erreur encodage JSON du message de chat: " + err.Error())
+		utils.Error("Erreur encodage JSON du message direct: " + err.Error())
 		return
 	}
+	client.enqueue(payload)
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+// handleMessageMutation traite les opérations message_edit, message_delete, reaction_add
+// et reaction_remove du socket avec les mêmes règles que les routes REST.
+func handleMessageMutation(currentClient *Client, incomingMessage Message) error {
+	if incomingMessage.ServerID == "" || incomingMessage.ChannelID == "" || incomingMessage.MessageID == "" {
+		return newGatewayError(gatewayInvalidRequest, "ServerID, ChannelID ou MessageID manquant.")
+	}
 
-	if err := utils.RedisPublish(ctx, "chat:channel:"+incomingMessage.ChannelID, marshaledChatMsg); err != nil {
-		utils.Error("Erreur publication message chat Redis: " + err.Error())
+	hub.mu.RLock()
+	member := currentClient.Permissions
+	currentServerID := currentClient.CurrentServerID
+	hub.mu.RUnlock()
+	if member == nil || currentServerID != incomingMessage.ServerID {
+		return newGatewayError(gatewayNotInServer, "Rejoignez d'abord le serveur de ce salon.")
+	}
+	if err := requireMembership(currentClient, incomingMessage.ServerID); err != nil {
+		return err
 	}
 
-	go dbTools.SaveMessageToScylla(
-		context.Background(),
-		chatMsg.ServerID,
-		chatMsg.ChannelID,
-		chatMsg.UserID,
-		chatMsg.Content,
-		currentClient.Username, // Ajouté
-		currentClient.Avatar,   // Ajouté
-	)
+	channelID, err := gocql.ParseUUID(incomingMessage.ChannelID)
+	if err != nil {
+		return newGatewayError(gatewayInvalidRequest, "ID de salon invalide.")
+	}
+	messageID, err := gocql.ParseUUID(incomingMessage.MessageID)
+	if err != nil {
+		return newGatewayError(gatewayInvalidRequest, "ID de message invalide.")
+	}
+
+	var event *Message
+	var status int
+	var msg string
+	switch incomingMessage.Type {
+	case "message_edit":
+		event, status, msg = editChannelMessage(member, channelID, messageID, incomingMessage.Content)
+	case "message_delete":
+		event, status, msg = deleteChannelMessage(member, channelID, messageID)
+	default:
+		event, status, msg = reactToMessage(member, channelID, messageID, incomingMessage.Emoji, incomingMessage.Type == "reaction_add")
+	}
+	if status != 0 {
+		return gatewayErrorFromStatus(status, msg)
+	}
+
+	// Une réaction déjà présente (ou déjà retirée) ne produit pas d'événement.
+	if event != nil {
+		publishChannelEvent(*event)
+	}
+	return nil
 }
 
-func handleHeartbeat(currentClient *Client) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+// publishServerEvent publie un événement sur server:presence:updates:<serverId>.
+func publishServerEvent(event Message) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		utils.Error("Erreur encodage JSON de l'événement serveur: " + err.Error())
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	if err := utils.RedisSetWithTTL(ctx, "user:last_seen:"+currentClient.UserID.String(), time.Now().Unix(), 30*time.Second); err != nil {
-		return fmt.Errorf("erreur mise à jour heartbeat: %w", err)
+	if err := utils.RedisPublish(ctx, "server:presence:updates:"+event.ServerID, payload); err != nil {
+		utils.Error("Erreur publication événement serveur Redis: " + err.Error())
+	}
+}
+
+// publishChannelEvent publie un événement sur chat:channel:<channelId>.
+func publishChannelEvent(event Message) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		utils.Error("Erreur encodage JSON de l'événement de salon: " + err.Error())
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := utils.RedisPublish(ctx, "chat:channel:"+event.ChannelID, payload); err != nil {
+		utils.Error("Erreur publication événement de salon Redis: " + err.Error())
+	}
+}
+
+// refreshPermissions résout à nouveau les permissions des connexions concernées
+// par un changement de rôle (transfert de propriété, rôle ou surcharge modifié).
+// Les permissions ne sont lues qu'une fois par utilisateur.
+func refreshPermissions(targets []*Client, serverID string) {
+	serverUUID, err := gocql.ParseUUID(serverID)
+	if err != nil {
+		return
+	}
+	resolved := make(map[uuid.UUID]*models.MemberPermissions, len(targets))
+	for _, client := range targets {
+		permissions, ok := resolved[client.UserID]
+		if !ok {
+			permissions, err = dbTools.GetMemberPermissions(serverUUID, gocql.UUID(client.UserID))
+			if err != nil {
+				utils.Warn("Rafraîchissement des permissions impossible pour " + client.Username + ": " + err.Error())
+			}
+			resolved[client.UserID] = permissions
+		}
+		hub.mu.Lock()
+		if client.CurrentServerID == serverID {
+			client.Permissions = permissions
+		}
+		hub.mu.Unlock()
 	}
-	return nil
 }
 
 func StartBroadcaster() {
 	ctx := context.Background()
-	// Suppression de l'abonnement aux messages privés
+	// Les messages privés transitent aussi par chat:channel:*, routés via RecipientIDs
 	pubsub := utils.RedisPSubscribe(ctx, "chat:channel:*", "user:presence:updates", "server:presence:updates:*")
 	if pubsub == nil {
 		utils.Fatal("Broadcaster Redis - pubsub client est nil après PSubscribe.")
@@ -334,69 +588,138 @@ func StartBroadcaster() {
 	ch := pubsub.Channel()
 
 	utils.Info("Broadcaster Redis démarré et abonné aux canaux.")
-	utils.Info("Attente des messages Pub/Sub...")
 
 	go func() {
 		for msg := range ch {
-			utils.Info(fmt.Sprintf("Broadcaster: Message reçu de Redis sur le canal '%s'", msg.Channel))
-
 			var event Message
 			if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
 				utils.Error("Broadcaster: Erreur unmarshalling message Redis (" + msg.Channel + "): " + err.Error())
 				continue
 			}
+			dispatchEvent(event, []byte(msg.Payload))
+		}
+		utils.Info("Broadcaster Redis: Le canal de messages a été fermé, goroutine arrêtée.")
+	}()
+}
 
-			utils.Info(fmt.Sprintf("Broadcaster: Traitement de l'événement '%s' pour ServerID '%s', ChannelID '%s', UserID '%s'", event.Type, event.ServerID, event.ChannelID, event.UserID))
-
-			clientsMutex.RLock()
-			if len(clients) == 0 {
-				utils.Warn("Broadcaster: Aucun client connecté pour la diffusion.")
+// dispatchEvent livre un événement aux seules connexions concernées, trouvées via les
+// index du hub : destinataires explicites, salon actif ou serveur actif selon le type.
+// Les envois passent par les files des connexions et ne bloquent jamais la diffusion.
+func dispatchEvent(event Message, payload []byte) {
+	var evicted, refreshed, stale []*Client
+
+	// Événements de salons privés : livrés à toutes les connexions des membres, quel que soit le serveur actif.
+	if len(event.RecipientIDs) > 0 {
+		// Les destinataires ne servent qu'au routage : ils ne sont jamais transmis aux clients
+		// (liste d'amis, membres des serveurs partagés, membres d'un groupe). Le message est
+		// réencodé avant de prendre le verrou du hub.
+		recipients := event.RecipientIDs
+		event.RecipientIDs = nil
+		payload, err := json.Marshal(event)
+		if err != nil {
+			utils.Error("Broadcaster: Erreur encodage de l'événement ciblé " + event.Type + ": " + err.Error())
+			return
+		}
+		hub.mu.RLock()
+		for _, client := range hub.userClients(recipients...) {
+			// Une mention n'est pas doublée pour les connexions déjà sur le salon : elles reçoivent le chat.
+			if event.Type == "mention" && client.CurrentChannelID == event.ChannelID {
+				continue
 			}
-
-			for conn, client := range clients {
-				utils.Info(fmt.Sprintf("Broadcaster: Vérification du client '%s' (UserID: %s) actuellement dans le serveur '%s', canal '%s'", client.Username, client.UserID, client.CurrentServerID, client.CurrentChannelID))
-
-				switch event.Type {
-				case "chat":
-					if client.CurrentServerID == event.ServerID && client.CurrentChannelID == event.ChannelID {
-						utils.Info(fmt.Sprintf("Broadcaster: CORRESPONDANCE CHAT ! Envoi du message à '%s' dans le serveur '%s', canal '%s'", client.Username, client.CurrentServerID, client.CurrentChannelID))
-						if err := conn.WriteMessage(websocket.TextMessage, []byte(msg.Payload)); err != nil {
-							utils.Error("Broadcaster: Erreur envoi message chat à client (" + client.Username + "): " + err.Error())
-							conn.Close()
-							clientsMutex.Lock()
-							delete(clients, conn)
-							clientsMutex.Unlock()
-						}
-					} else {
-						utils.Warn(fmt.Sprintf("Broadcaster: PAS DE CORRESPONDANCE CHAT. Client S:%s/C:%s, Event S:%s/C:%s. Message non envoyé à %s.",
-							client.CurrentServerID, client.CurrentChannelID, event.ServerID, event.ChannelID, client.Username))
-					}
-				case "presence":
-					utils.Info(fmt.Sprintf("Broadcaster: Envoi de la mise à jour de présence pour user '%s' au client '%s'", event.UserID, client.Username))
-					if err := conn.WriteMessage(websocket.TextMessage, []byte(msg.Payload)); err != nil {
-						utils.Error("Broadcaster: Erreur envoi message présence à client (" + client.Username + "): " + err.Error())
-						conn.Close()
-						clientsMutex.Lock()
-						delete(clients, conn)
-						clientsMutex.Unlock()
-					}
-				case "server:presence:updates": // Exemple de message de présence spécifique au serveur
-					if client.CurrentServerID == event.ServerID {
-						utils.Info(fmt.Sprintf("Broadcaster: Envoi de la mise à jour de présence serveur à '%s' pour serveur '%s'", client.Username, event.ServerID))
-						if err := conn.WriteMessage(websocket.TextMessage, []byte(msg.Payload)); err != nil {
-							utils.Error("Broadcaster: Erreur envoi mise à jour présence serveur à client (" + client.Username + "): " + err.Error())
-							conn.Close()
-							clientsMutex.Lock()
-							delete(clients, conn)
-							clientsMutex.Unlock()
-						}
-					}
-				default:
-					utils.Warn("Broadcaster: Type d'événement inconnu reçu: " + event.Type)
+			client.enqueue(payload)
+			// Adhésion modifiée : le cache de la connexion est vidé, et elle quitte le serveur si elle n'en est plus membre.
+			if event.Type == "membership_update" {
+				stale = append(stale, client)
+				if event.Status == membershipLeft && client.CurrentServerID == event.ServerID {
+					evicted = append(evicted, client)
 				}
 			}
-			clientsMutex.RUnlock()
 		}
-		utils.Info("Broadcaster Redis: Le canal de messages a été fermé, goroutine arrêtée.")
-	}()
+		hub.mu.RUnlock()
+		resetMemberships(stale)
+		hub.evict(evicted, event.ServerID)
+		return
+	}
+
+	hub.mu.RLock()
+	switch event.Type {
+	case "typing_start":
+		// Jamais renvoyé à son auteur, quelle que soit sa connexion.
+		for client := range hub.byChannel[event.ChannelID] {
+			if client.CurrentServerID == event.ServerID && client.UserID.String() != event.UserID {
+				client.enqueue(payload)
+			}
+		}
+	case "chat", "message_update", "message_delete", "reaction_add", "reaction_remove", "thread_create", "thread_update", "channel_pins_update":
+		for client := range hub.byChannel[event.ChannelID] {
+			if client.CurrentServerID == event.ServerID {
+				client.enqueue(payload)
+			}
+		}
+	case "presence", "server:presence:updates":
+		// La présence globale est toujours ciblée (amis et membres des serveurs partagés, via RecipientIDs) :
+		// sans destinataires, seul le serveur concerné la reçoit.
+		for client := range hub.byServer[event.ServerID] {
+			client.enqueue(payload)
+		}
+	case "channel_layout_update":
+		// Chaque connexion ne reçoit que les salons qu'elle peut voir.
+		if event.Layout == nil {
+			break
+		}
+		for client := range hub.byServer[event.ServerID] {
+			personal := event
+			personal.Layout = event.Layout.visibleTo(client.Permissions)
+			personalPayload, err := json.Marshal(personal)
+			if err != nil {
+				utils.Error("Broadcaster: Erreur encodage channel_layout_update: " + err.Error())
+				continue
+			}
+			client.enqueue(personalPayload)
+		}
+	case "member_remove":
+		// Le membre retiré est prévenu sur toutes ses connexions, les autres seulement s'ils sont sur le serveur.
+		for client := range hub.byServer[event.ServerID] {
+			client.enqueue(payload)
+		}
+		for _, client := range hub.userClients(event.UserID) {
+			stale = append(stale, client)
+			if client.CurrentServerID == event.ServerID {
+				evicted = append(evicted, client)
+			} else {
+				client.enqueue(payload)
+			}
+		}
+	case "ownership_transfer":
+		// Le nouveau propriétaire est notifié sur toutes ses connexions ; l'ancien (Content) et lui voient leurs permissions rafraîchies.
+		for client := range hub.byServer[event.ServerID] {
+			client.enqueue(payload)
+			if client.UserID.String() == event.UserID || client.UserID.String() == event.Content {
+				refreshed = append(refreshed, client)
+			}
+		}
+		for _, client := range hub.userClients(event.UserID) {
+			if client.CurrentServerID != event.ServerID {
+				client.enqueue(payload)
+			}
+		}
+	case "permissions_update":
+		// Rôle ou surcharge modifié : les connexions concernées résolvent à nouveau leurs permissions.
+		for client := range hub.byServer[event.ServerID] {
+			if event.UserID == "" || client.UserID.String() == event.UserID {
+				client.enqueue(payload)
+				refreshed = append(refreshed, client)
+			}
+		}
+	default:
+		utils.Warn("Broadcaster: Type d'événement inconnu reçu: " + event.Type)
+	}
+	hub.mu.RUnlock()
+
+	resetMemberships(stale)
+	hub.evict(evicted, event.ServerID)
+	// Les lectures Scylla ne bloquent pas la diffusion des événements suivants.
+	if len(refreshed) > 0 {
+		go refreshPermissions(refreshed, event.ServerID)
+	}
 }
@@ -3,13 +3,16 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"math/rand"
 	"time"
 
 	"github.com/Romain-GUILLEMOT/WhispyrBack/db"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
 	"github.com/Romain-GUILLEMOT/WhispyrBack/utils"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils/dbTools"
 	"github.com/gocql/gocql"
 	"github.com/gofiber/fiber/v2"
 )
@@ -77,14 +80,16 @@ func SeedChannelWithMessages(c *fiber.Ctx) error {
 	// --- ÉTAPE 3: Génération et Insertion par lots (Batching) ---
 	batch := db.Session.NewBatch(gocql.LoggedBatch)
 	const batchSize = 100 // Insérer par paquets de 100
+	buckets := make(map[string]struct{})
 
 	for i := 0; i < count; i++ {
 		// Générer une date aléatoire entre maintenant et X années en arrière
 		randomSeconds := rand.Int63n(int64(years) * 365 * 24 * 60 * 60)
 		randomTime := time.Now().Add(-time.Second * time.Duration(randomSeconds))
 
-		dayBucket := randomTime.UTC().Format("2006-01-02")
 		messageUUID := gocql.UUIDFromTime(randomTime)
+		dayBucket := models.DayBucketOf(messageUUID)
+		buckets[dayBucket] = struct{}{}
 
 		// ✅ Choisir un utilisateur et un message aléatoires
 		sender := sampleUsers[rand.Intn(len(sampleUsers))]
@@ -118,6 +123,14 @@ func SeedChannelWithMessages(c *fiber.Ctx) error {
 		}
 	}
 
+	// Indexe les buckets générés pour que la pagination atteigne tout l'historique.
+	for dayBucket := range buckets {
+		if err := dbTools.RecordChannelBucket(context.Background(), channelID, dayBucket); err != nil {
+			utils.Error("Erreur lors de l'indexation des buckets de seeding", "error", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de l'indexation des buckets."})
+		}
+	}
+
 	utils.Info("Seeding terminé avec succès !")
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": fmt.Sprintf("%d messages ont été créés avec succès dans le salon %s", count, channelID),
@@ -0,0 +1,480 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils/dbTools"
+	"github.com/gocql/gocql"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type privateRecipient struct {
+	ID       gocql.UUID `json:"id"`
+	Username string     `json:"username"`
+	Avatar   string     `json:"avatar"`
+}
+
+type privateChannelResponse struct {
+	ChannelID     gocql.UUID         `json:"channel_id"`
+	Type          string             `json:"type"`
+	Name          string             `json:"name,omitempty"`
+	OwnerID       *gocql.UUID        `json:"owner_id,omitempty"`
+	LastMessageID gocql.UUID         `json:"last_message_id"`
+	Recipients    []privateRecipient `json:"recipients"` // Les autres membres du salon
+}
+
+type openDMInput struct {
+	UserID string `json:"user_id" validate:"required,uuid"`
+}
+
+type createGroupDMInput struct {
+	Name    string   `json:"name" validate:"max=100"`
+	UserIDs []string `json:"user_ids" validate:"required,min=1,dive,uuid"`
+}
+
+// ----------------------
+// 📌 Lister les messages privés (sidebar, du plus récent au plus ancien)
+// ----------------------
+func GetPrivateChannels(c *fiber.Ctx) error {
+	rawUserID := c.Locals("user_id").(*uuid.UUID)
+	userID := gocql.UUID(*rawUserID)
+
+	limit := c.QueryInt("limit", 50)
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+
+	entries, err := dbTools.GetPrivateChannels(userID, limit)
+	if err != nil {
+		utils.Error("Lecture des messages privés impossible", "userId", userID, "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de la récupération des messages privés."})
+	}
+
+	users := make(map[gocql.UUID]privateRecipient)
+	channels := make([]privateChannelResponse, 0, len(entries))
+	for _, entry := range entries {
+		channel, err := dbTools.GetChannelByID(entry.ChannelID.String())
+		if err != nil {
+			continue
+		}
+		members, err := dbTools.GetChannelMembers(entry.ChannelID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de la récupération des messages privés."})
+		}
+		channels = append(channels, toPrivateChannelResponse(channel, members, userID, users))
+	}
+	return c.JSON(channels)
+}
+
+// ----------------------
+// 📌 Ouvrir une conversation 1:1 (idempotent : renvoie la conversation existante)
+// ----------------------
+func OpenDirectMessage(c *fiber.Ctx) error {
+	rawUserID := c.Locals("user_id").(*uuid.UUID)
+	userID := gocql.UUID(*rawUserID)
+
+	var input openDMInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Données invalides."})
+	}
+	if err := validate.Struct(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Champs invalides."})
+	}
+	recipientID, _ := gocql.ParseUUID(input.UserID)
+	if recipientID == userID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Vous ne pouvez pas vous écrire à vous-même."})
+	}
+	if status, msg := checkUsersExist([]gocql.UUID{recipientID}); status != 0 {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+	if status, msg := checkNotBlocked(userID, []gocql.UUID{recipientID}); status != 0 {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+
+	channelID, created, err := dbTools.OpenDirectChannel(userID, recipientID)
+	if err != nil {
+		utils.Error("Ouverture du message privé impossible", "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de l'ouverture de la conversation."})
+	}
+
+	channel, members, status, msg := loadPrivateChannel(channelID, userID)
+	if channel == nil {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+	response := toPrivateChannelResponse(channel, members, userID, nil)
+	if !created {
+		return c.Status(fiber.StatusOK).JSON(response)
+	}
+
+	publishPrivateEvent(Message{Type: "dm_create", ChannelID: channelID.String(), UserID: userID.String()}, members)
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
+
+// ----------------------
+// 📌 Créer un groupe privé
+// ----------------------
+func CreateGroupDM(c *fiber.Ctx) error {
+	rawUserID := c.Locals("user_id").(*uuid.UUID)
+	userID := gocql.UUID(*rawUserID)
+
+	var input createGroupDMInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Données invalides."})
+	}
+	input.Name = strings.TrimSpace(input.Name)
+	if err := validate.Struct(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Champs invalides."})
+	}
+
+	seen := map[gocql.UUID]bool{userID: true}
+	memberIDs := make([]gocql.UUID, 0, len(input.UserIDs))
+	for _, raw := range input.UserIDs {
+		id, _ := gocql.ParseUUID(raw)
+		if !seen[id] {
+			seen[id] = true
+			memberIDs = append(memberIDs, id)
+		}
+	}
+	if len(memberIDs) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Ajoutez au moins un autre membre."})
+	}
+	if len(memberIDs)+1 > models.MaxGroupDMMembers {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": fmt.Sprintf("Un groupe compte au maximum %d membres.", models.MaxGroupDMMembers)})
+	}
+	if status, msg := checkUsersExist(memberIDs); status != 0 {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+	// Un blocage entre deux membres quelconques empêche le groupe, pas seulement avec le créateur.
+	if status, msg := checkGroupNotBlocked(append([]gocql.UUID{userID}, memberIDs...)); status != 0 {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+
+	channelID, err := dbTools.CreateGroupChannel(userID, input.Name, memberIDs)
+	if err != nil {
+		utils.Error("Création du groupe privé impossible", "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de la création du groupe."})
+	}
+
+	channel, members, status, msg := loadPrivateChannel(channelID, userID)
+	if channel == nil {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+	publishPrivateEvent(Message{Type: "dm_create", ChannelID: channelID.String(), UserID: userID.String()}, members)
+	return c.Status(fiber.StatusCreated).JSON(toPrivateChannelResponse(channel, members, userID, nil))
+}
+
+// ----------------------
+// 📌 Ajouter un membre à un groupe privé
+// ----------------------
+func AddGroupDMMember(c *fiber.Ctx) error {
+	rawUserID := c.Locals("user_id").(*uuid.UUID)
+	userID := gocql.UUID(*rawUserID)
+
+	channel, members, status, msg := loadGroupChannelFromParams(c, userID)
+	if channel == nil {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+
+	targetID, err := gocql.ParseUUID(c.Params("userId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID d'utilisateur invalide."})
+	}
+	for _, member := range members {
+		if member.UserID == targetID {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Cet utilisateur fait déjà partie du groupe."})
+		}
+	}
+	if len(members) >= models.MaxGroupDMMembers {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": fmt.Sprintf("Un groupe compte au maximum %d membres.", models.MaxGroupDMMembers)})
+	}
+	if status, msg := checkUsersExist([]gocql.UUID{targetID}); status != 0 {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+	// Le nouveau membre ne doit avoir bloqué aucun membre du groupe, ni être bloqué par l'un d'eux.
+	memberIDs := make([]gocql.UUID, 0, len(members))
+	for _, member := range members {
+		memberIDs = append(memberIDs, member.UserID)
+	}
+	if status, msg := checkNotBlocked(targetID, memberIDs); status != 0 {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+
+	if err := dbTools.AddChannelMember(channel, targetID); err != nil {
+		utils.Error("Ajout au groupe privé impossible", "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de l'ajout du membre."})
+	}
+
+	members = append(members, models.ChannelMember{ChannelID: channel.ChannelID, UserID: targetID})
+	publishPrivateEvent(Message{Type: "dm_member_add", ChannelID: channel.ChannelID.String(), UserID: targetID.String(), Content: userID.String()}, members)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Membre ajouté."})
+}
+
+// ----------------------
+// 📌 Retirer un membre d'un groupe privé (le propriétaire, ou soi-même pour quitter)
+// ----------------------
+func RemoveGroupDMMember(c *fiber.Ctx) error {
+	rawUserID := c.Locals("user_id").(*uuid.UUID)
+	userID := gocql.UUID(*rawUserID)
+
+	channel, members, status, msg := loadGroupChannelFromParams(c, userID)
+	if channel == nil {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+
+	targetID, err := gocql.ParseUUID(c.Params("userId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID d'utilisateur invalide."})
+	}
+	if targetID != userID && channel.OwnerID != userID {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Seul le propriétaire du groupe peut retirer un membre."})
+	}
+
+	isMember := false
+	var newOwnerID gocql.UUID
+	for _, member := range members {
+		if member.UserID == targetID {
+			isMember = true
+		} else if targetID == channel.OwnerID && newOwnerID == (gocql.UUID{}) {
+			// Le propriétaire qui quitte le groupe le transmet au membre suivant.
+			newOwnerID = member.UserID
+		}
+	}
+	if !isMember {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Cet utilisateur ne fait pas partie du groupe."})
+	}
+
+	if err := dbTools.RemoveChannelMember(channel, targetID, newOwnerID); err != nil {
+		utils.Error("Retrait du groupe privé impossible", "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors du retrait du membre."})
+	}
+
+	// Le membre retiré est aussi prévenu, pour fermer la conversation de son côté.
+	event := Message{Type: "dm_member_remove", ChannelID: channel.ChannelID.String(), UserID: targetID.String(), Content: userID.String()}
+	if newOwnerID != (gocql.UUID{}) {
+		event.Status = newOwnerID.String()
+	}
+	publishPrivateEvent(event, members)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Membre retiré."})
+}
+
+// ----------------------
+// 📌 Historique d'un message privé (mêmes paramètres de pagination que les salons)
+// ----------------------
+func GetPrivateChannelMessages(c *fiber.Ctx) error {
+	rawUserID := c.Locals("user_id").(*uuid.UUID)
+	userID := gocql.UUID(*rawUserID)
+
+	channelID, err := gocql.ParseUUID(c.Params("channelId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID de salon invalide."})
+	}
+	if channel, _, status, msg := loadPrivateChannel(channelID, userID); channel == nil {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+	return respondWithChannelMessages(c, channelID, userID)
+}
+
+// handleDirectMessage traite un message "chat" envoyé sur un salon privé. Le client n'a pas
+// besoin d'avoir rejoint le salon : l'appartenance est vérifiée dans channel_members.
+func handleDirectMessage(currentClient *Client, incomingMessage Message) {
+	if incomingMessage.Content == "" {
+		sendChatError(currentClient, incomingMessage, "Message incomplet.")
+		return
+	}
+	if len(incomingMessage.Content) > maxMessageLength {
+		sendChatError(currentClient, incomingMessage, "Message trop long.")
+		return
+	}
+
+	channelID, err := gocql.ParseUUID(incomingMessage.ChannelID)
+	if err != nil {
+		sendChatError(currentClient, incomingMessage, "ID de salon invalide.")
+		return
+	}
+	senderID := gocql.UUID(currentClient.UserID)
+	channel, members, _, msg := loadPrivateChannel(channelID, senderID)
+	if channel == nil {
+		sendChatError(currentClient, incomingMessage, msg)
+		return
+	}
+	if channel.Type == models.ChannelTypeDM {
+		// Un blocage, dans un sens ou dans l'autre, coupe la conversation 1:1.
+		others := make([]gocql.UUID, 0, 1)
+		for _, member := range members {
+			if member.UserID != senderID {
+				others = append(others, member.UserID)
+			}
+		}
+		if _, msg := checkNotBlocked(senderID, others); msg != "" {
+			sendChatError(currentClient, incomingMessage, msg)
+			return
+		}
+	}
+
+	replyTo, errMsg := resolveReplyTo(channelID, incomingMessage.ReplyTo)
+	if errMsg != "" {
+		sendChatError(currentClient, incomingMessage, errMsg)
+		return
+	}
+
+	message := &models.MessageByChannel{
+		ChannelID:      channelID,
+		SenderID:       senderID,
+		SenderUsername: currentClient.Username,
+		SenderAvatar:   currentClient.Avatar,
+		Content:        incomingMessage.Content,
+		ReplyTo:        replyTo,
+	}
+	if _, err := createChannelMessage("", recipientIDs(members), message, incomingMessage.Nonce); err != nil {
+		sendChatError(currentClient, incomingMessage, "Le message n'a pas pu être enregistré.")
+		return
+	}
+
+	memberIDs := make([]gocql.UUID, 0, len(members))
+	for _, member := range members {
+		memberIDs = append(memberIDs, member.UserID)
+	}
+	if err := dbTools.TouchPrivateChannel(channel, memberIDs, message.SentAt); err != nil {
+		utils.Error("Erreur mise à jour de la sidebar des messages privés: " + err.Error())
+	}
+}
+
+// loadPrivateChannel charge un salon privé et ses membres, en vérifiant que userID en fait partie.
+func loadPrivateChannel(channelID, userID gocql.UUID) (*models.Channel, []models.ChannelMember, int, string) {
+	channel, err := dbTools.GetChannelByID(channelID.String())
+	if err != nil || !channel.IsPrivateMessage() {
+		return nil, nil, fiber.StatusNotFound, "Conversation introuvable."
+	}
+	members, err := dbTools.GetChannelMembers(channelID)
+	if err != nil {
+		utils.Error("Lecture des membres du salon privé impossible", "channelId", channelID, "err", err)
+		return nil, nil, fiber.StatusInternalServerError, "Erreur interne."
+	}
+	for _, member := range members {
+		if member.UserID == userID {
+			return channel, members, 0, ""
+		}
+	}
+	return nil, nil, fiber.StatusNotFound, "Conversation introuvable."
+}
+
+// loadGroupChannelFromParams charge le groupe privé :channelId dont l'appelant est membre.
+func loadGroupChannelFromParams(c *fiber.Ctx, userID gocql.UUID) (*models.Channel, []models.ChannelMember, int, string) {
+	channelID, err := gocql.ParseUUID(c.Params("channelId"))
+	if err != nil {
+		return nil, nil, fiber.StatusBadRequest, "ID de salon invalide."
+	}
+	channel, members, status, msg := loadPrivateChannel(channelID, userID)
+	if channel == nil {
+		return nil, nil, status, msg
+	}
+	if channel.Type != models.ChannelTypeGroupDM {
+		return nil, nil, fiber.StatusBadRequest, "Cette conversation n'est pas un groupe."
+	}
+	return channel, members, 0, ""
+}
+
+// checkUsersExist vérifie que tous les utilisateurs existent.
+func checkUsersExist(userIDs []gocql.UUID) (int, string) {
+	for _, id := range userIDs {
+		userID := uuid.UUID(id)
+		if _, err := dbTools.GetUserByID(&userID); err != nil {
+			if err == gocql.ErrNotFound {
+				return fiber.StatusNotFound, "Utilisateur introuvable."
+			}
+			return fiber.StatusInternalServerError, "Erreur interne."
+		}
+	}
+	return 0, ""
+}
+
+// checkNotBlocked vérifie qu'aucun blocage n'existe entre userID et les autres utilisateurs.
+func checkNotBlocked(userID gocql.UUID, others []gocql.UUID) (int, string) {
+	for _, otherID := range others {
+		blocked, err := dbTools.IsBlocked(userID, otherID)
+		if err != nil {
+			return fiber.StatusInternalServerError, "Erreur interne."
+		}
+		if blocked {
+			return fiber.StatusForbidden, "Impossible d'échanger des messages avec cet utilisateur."
+		}
+	}
+	return 0, ""
+}
+
+// checkGroupNotBlocked vérifie qu'aucun des futurs membres d'un groupe n'a bloqué un autre
+// membre. Les relations de chaque membre ne sont lues qu'une fois.
+func checkGroupNotBlocked(memberIDs []gocql.UUID) (int, string) {
+	inGroup := make(map[gocql.UUID]bool, len(memberIDs))
+	for _, memberID := range memberIDs {
+		inGroup[memberID] = true
+	}
+	for _, memberID := range memberIDs {
+		relationships, err := dbTools.GetRelationships(memberID)
+		if err != nil {
+			return fiber.StatusInternalServerError, "Erreur interne."
+		}
+		for _, relationship := range relationships {
+			if relationship.Type == models.RelationshipBlocked && inGroup[relationship.TargetID] {
+				return fiber.StatusForbidden, "Impossible d'échanger des messages avec cet utilisateur."
+			}
+		}
+	}
+	return 0, ""
+}
+
+// toPrivateChannelResponse construit la réponse d'un salon privé vu par viewerID. users sert
+// de cache des profils lorsque plusieurs salons sont construits à la suite (peut être nil).
+func toPrivateChannelResponse(channel *models.Channel, members []models.ChannelMember, viewerID gocql.UUID, users map[gocql.UUID]privateRecipient) privateChannelResponse {
+	response := privateChannelResponse{
+		ChannelID:     channel.ChannelID,
+		Type:          channel.Type,
+		Name:          channel.Name,
+		LastMessageID: channel.LastMessageID,
+		Recipients:    make([]privateRecipient, 0, len(members)),
+	}
+	if channel.OwnerID != (gocql.UUID{}) {
+		ownerID := channel.OwnerID
+		response.OwnerID = &ownerID
+	}
+
+	for _, member := range members {
+		if member.UserID == viewerID {
+			continue
+		}
+		recipient, ok := users[member.UserID]
+		if !ok {
+			recipient = privateRecipient{ID: member.UserID}
+			id := uuid.UUID(member.UserID)
+			if user, err := dbTools.GetUserByID(&id); err == nil {
+				recipient.Username, recipient.Avatar = user.Username, user.Avatar
+			}
+			if users != nil {
+				users[member.UserID] = recipient
+			}
+		}
+		response.Recipients = append(response.Recipients, recipient)
+	}
+	return response
+}
+
+// recipientIDs retourne les IDs des membres sous forme de chaînes, pour Message.RecipientIDs.
+func recipientIDs(members []models.ChannelMember) []string {
+	ids := make([]string, 0, len(members))
+	for _, member := range members {
+		ids = append(ids, member.UserID.String())
+	}
+	return ids
+}
+
+// publishPrivateEvent diffuse un événement de salon privé à tous ses membres.
+func publishPrivateEvent(event Message, members []models.ChannelMember) {
+	event.RecipientIDs = recipientIDs(members)
+	event.Timestamp = time.Now().UnixNano() / int64(time.Millisecond)
+	publishChannelEvent(event)
+}
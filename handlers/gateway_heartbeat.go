@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils/dbTools"
+	"github.com/gocql/gocql"
+	"github.com/google/uuid"
+)
+
+// Poignée de main du gateway : le serveur envoie hello (intervalle de heartbeat), le client
+// répond identify (nouvelle session, réponse ready) ou resume. Chaque heartbeat est acquitté
+// par heartbeat_ack ; une connexion sans heartbeat depuis heartbeatTimeout est fermée par
+// le reaper. La présence repose sur une entrée par session dans presence:<userId>, avec
+// pour score son échéance : les sessions d'un nœud arrêté brutalement expirent seules.
+// presence:expiries garde, par utilisateur, l'échéance de sa dernière session : le reaper
+// y trouve les utilisateurs dont toutes les sessions ont expiré et les annonce hors ligne.
+const (
+	heartbeatInterval = 30 * time.Second
+	// heartbeatTimeout tolère un heartbeat manqué.
+	heartbeatTimeout = 2*heartbeatInterval + 10*time.Second
+	presenceTTL      = heartbeatTimeout
+
+	gatewayNotIdentified = "not_identified"
+)
+
+const presenceExpiriesKey = "presence:expiries"
+
+func presenceKey(userID string) string {
+	return "presence:" + userID
+}
+
+// touchPresence prolonge l'entrée de présence de la session et l'échéance de l'utilisateur.
+func touchPresence(client *Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	userID := client.UserID.String()
+	if err := utils.RedisZAddExpiring(ctx, presenceKey(userID), client.SessionID, presenceTTL); err != nil {
+		return err
+	}
+	return utils.RedisZAddGT(ctx, presenceExpiriesKey, float64(time.Now().Add(presenceTTL).UnixMilli()), userID)
+}
+
+// clearPresence retire l'entrée de présence de la session et indique si l'utilisateur
+// doit être annoncé hors ligne : il n'a plus de session en ligne et n'a pas déjà été
+// annoncé hors ligne par le reaper.
+func clearPresence(client *Client) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	userID := client.UserID.String()
+	key := presenceKey(userID)
+	if _, err := utils.RedisZRem(ctx, key, client.SessionID); err != nil {
+		return false, err
+	}
+	sessions, err := utils.RedisZRangeByMinScore(ctx, key, float64(time.Now().UnixMilli()))
+	if err != nil {
+		return false, err
+	}
+	if len(sessions) > 0 {
+		return false, nil
+	}
+	// Seul le retrait effectif de l'échéance autorise l'annonce : pas de doublon avec le reaper.
+	removed, err := utils.RedisZRem(ctx, presenceExpiriesKey, userID)
+	if err != nil {
+		return false, err
+	}
+	return removed > 0, nil
+}
+
+// isOnline indique si l'utilisateur a au moins une session en ligne.
+func isOnline(userID gocql.UUID) bool {
+	online, err := onlineUsers([]gocql.UUID{userID})
+	if err != nil {
+		utils.Warn("Lecture de la présence impossible pour " + userID.String() + ": " + err.Error())
+		return false
+	}
+	return online[0]
+}
+
+// announceOnline annonce l'utilisateur en ligne à ses amis et aux membres de ses serveurs.
+func announceOnline(client *Client) {
+	go func() {
+		publishUserEvent(Message{
+			Type: "presence", UserID: client.UserID.String(), Username: client.Username,
+			Avatar: client.Avatar, Content: "s'est connecté", Status: "online", Timestamp: time.Now().UnixNano() / int64(time.Millisecond),
+			RecipientIDs: presenceAudience(gocql.UUID(client.UserID)),
+		})
+	}()
+}
+
+// onlineUsers indique, pour chaque utilisateur, s'il a au moins une session en ligne.
+func onlineUsers(userIDs []gocql.UUID) ([]bool, error) {
+	keys := make([]string, len(userIDs))
+	for i, id := range userIDs {
+		keys[i] = presenceKey(id.String())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	counts, err := utils.RedisZCountByMinScore(ctx, keys, float64(time.Now().UnixMilli()))
+	if err != nil {
+		return nil, err
+	}
+	online := make([]bool, len(counts))
+	for i, count := range counts {
+		online[i] = count > 0
+	}
+	return online, nil
+}
+
+// sendHello ouvre la poignée de main d'une nouvelle connexion.
+func sendHello(client *Client) {
+	client.lastHeartbeat.Store(time.Now().UnixNano())
+	sendToClient(client, Message{Type: "hello", HeartbeatInterval: heartbeatInterval.Milliseconds()})
+}
+
+// handleIdentify ouvre la session de la connexion : l'utilisateur est annoncé en ligne.
+func handleIdentify(currentClient *Client) error {
+	if currentClient.identified.Load() {
+		return newGatewayError(gatewayInvalidRequest, "Session déjà identifiée.")
+	}
+	// Un utilisateur déjà en ligne sur une autre session n'est pas annoncé une seconde fois.
+	wasOnline := isOnline(gocql.UUID(currentClient.UserID))
+	if err := touchPresence(currentClient); err != nil {
+		return fmt.Errorf("erreur enregistrement de la présence: %w", err)
+	}
+	currentClient.identified.Store(true)
+	sendToClient(currentClient, Message{Type: "ready", SessionID: currentClient.SessionID, HeartbeatInterval: heartbeatInterval.Milliseconds()})
+
+	if !wasOnline {
+		announceOnline(currentClient)
+	}
+	utils.Info("🎉 Session ouverte pour " + currentClient.Username + " (" + currentClient.SessionID + ")")
+	return nil
+}
+
+func handleHeartbeat(currentClient *Client) error {
+	currentClient.lastHeartbeat.Store(time.Now().UnixNano())
+	sendToClient(currentClient, Message{Type: "heartbeat_ack"})
+	if !currentClient.identified.Load() {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := utils.RedisSetWithTTL(ctx, "user:last_seen:"+currentClient.UserID.String(), time.Now().Unix(), presenceTTL); err != nil {
+		return fmt.Errorf("erreur mise à jour heartbeat: %w", err)
+	}
+	if err := touchPresence(currentClient); err != nil {
+		return fmt.Errorf("erreur mise à jour de la présence: %w", err)
+	}
+	return nil
+}
+
+// StartHeartbeatReaper ferme périodiquement les connexions qui n'envoient plus de heartbeat.
+// Leur session reste ouverte pour un resume pendant resumeTimeout.
+func StartHeartbeatReaper() {
+	go func() {
+		ticker := time.NewTicker(heartbeatInterval / 2)
+		defer ticker.Stop()
+		for range ticker.C {
+			deadline := time.Now().Add(-heartbeatTimeout).UnixNano()
+
+			var dead []*Client
+			hub.mu.RLock()
+			for _, client := range hub.sessions {
+				if client.lastHeartbeat.Load() < deadline {
+					dead = append(dead, client)
+				}
+			}
+			hub.mu.RUnlock()
+
+			for _, client := range dead {
+				if client.dropConnection() {
+					utils.Warn("Heartbeat manquant, connexion fermée pour " + client.Username + " (" + client.SessionID + ")")
+				}
+			}
+
+			sweepPresence()
+		}
+	}()
+	utils.Info("Reaper des heartbeats démarré.")
+}
+
+// sweepPresence annonce hors ligne les utilisateurs dont toutes les sessions ont expiré sans
+// être terminées (nœud arrêté brutalement, session détachée). Chaque nœud exécute le
+// balayage : seul celui qui retire l'échéance publie l'événement.
+func sweepPresence() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	expired, err := utils.RedisZRangeByMaxScore(ctx, presenceExpiriesKey, float64(time.Now().UnixMilli()))
+	if err != nil {
+		utils.Warn("Lecture des présences expirées impossible: " + err.Error())
+		return
+	}
+
+	for _, rawUserID := range expired {
+		removed, err := utils.RedisZRem(ctx, presenceExpiriesKey, rawUserID)
+		if err != nil || removed == 0 {
+			continue
+		}
+		userID, err := gocql.ParseUUID(rawUserID)
+		if err != nil {
+			continue
+		}
+		// Reconnecté entre-temps : son échéance est rétablie au prochain heartbeat.
+		if isOnline(userID) {
+			continue
+		}
+
+		user, err := dbTools.GetUserByID((*uuid.UUID)(&userID))
+		if err != nil {
+			utils.Warn("Lecture de l'utilisateur " + rawUserID + " impossible pour l'annonce hors ligne: " + err.Error())
+			user = &models.User{}
+		}
+		utils.Info("Présence expirée, " + rawUserID + " annoncé hors ligne")
+		announceOffline(userID, user.Username, user.Avatar)
+	}
+}
+
+// dropConnection ferme la connexion attachée à la session, sans terminer la session.
+func (client *Client) dropConnection() bool {
+	client.connMu.Lock()
+	defer client.connMu.Unlock()
+	if client.Conn == nil {
+		return false
+	}
+	client.Conn.Close()
+	client.Conn = nil
+	return true
+}
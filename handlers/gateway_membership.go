@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils/dbTools"
+	"github.com/gocql/gocql"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Les serveurs d'un utilisateur sont mis en cache dans Redis (user:servers:<userId>) et
+// copiés sur chaque connexion. Toute modification des adhésions supprime la clé et publie
+// un membership_update qui vide le cache des connexions concernées.
+const (
+	membershipCacheTTL = 10 * time.Minute
+	// membershipSentinel garde la clé présente pour un utilisateur sans serveur.
+	membershipSentinel = "-"
+
+	membershipJoined = "joined"
+	membershipLeft   = "left"
+)
+
+// Codes des trames error renvoyées par la passerelle.
+const (
+	gatewayInvalidRequest = "invalid_request"
+	gatewayNotMember      = "not_member"
+	gatewayNotInServer    = "not_in_server"
+	gatewayUnknownServer  = "unknown_server"
+	gatewayNotFound       = "not_found"
+	gatewayForbidden      = "forbidden"
+	gatewayInternalError  = "internal_error"
+)
+
+// gatewayError est un refus d'opération du socket, renvoyé au client dans une trame error.
+type gatewayError struct {
+	Code   string
+	Reason string
+}
+
+func (e *gatewayError) Error() string {
+	return e.Code + ": " + e.Reason
+}
+
+func newGatewayError(code, reason string) error {
+	return &gatewayError{Code: code, Reason: reason}
+}
+
+// gatewayErrorFromStatus traduit le triplet (status, message) des helpers REST en refus de la passerelle.
+func gatewayErrorFromStatus(status int, msg string) error {
+	switch status {
+	case fiber.StatusBadRequest:
+		return newGatewayError(gatewayInvalidRequest, msg)
+	case fiber.StatusForbidden:
+		return newGatewayError(gatewayForbidden, msg)
+	case fiber.StatusNotFound:
+		return newGatewayError(gatewayNotFound, msg)
+	default:
+		return newGatewayError(gatewayInternalError, "Erreur interne.")
+	}
+}
+
+// sendGatewayError renvoie une trame error pour une opération refusée. Les erreurs
+// internes ne sont pas détaillées au client.
+func sendGatewayError(currentClient *Client, incomingMessage Message, err error) {
+	code, reason := gatewayInternalError, "Erreur interne."
+	if gatewayErr, ok := err.(*gatewayError); ok {
+		code, reason = gatewayErr.Code, gatewayErr.Reason
+	}
+	sendToClient(currentClient, Message{
+		Type:      "error",
+		Op:        incomingMessage.Type,
+		Code:      code,
+		ServerID:  incomingMessage.ServerID,
+		ChannelID: incomingMessage.ChannelID,
+		MessageID: incomingMessage.MessageID,
+		Nonce:     incomingMessage.Nonce,
+		Content:   reason,
+		Timestamp: time.Now().UnixNano() / int64(time.Millisecond),
+	})
+}
+
+func membershipCacheKey(userID string) string {
+	return "user:servers:" + userID
+}
+
+// loadMemberships retourne les serveurs de l'utilisateur depuis Redis, ou depuis
+// user_servers en remplissant le cache.
+func loadMemberships(userID gocql.UUID) (map[string]bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	key := membershipCacheKey(userID.String())
+	cached, err := utils.RedisSMembers(ctx, key)
+	if err != nil {
+		utils.Warn("Lecture du cache des adhésions impossible pour " + userID.String() + ": " + err.Error())
+	}
+	if len(cached) > 0 {
+		memberships := make(map[string]bool, len(cached))
+		for _, serverID := range cached {
+			if serverID != membershipSentinel {
+				memberships[serverID] = true
+			}
+		}
+		return memberships, nil
+	}
+
+	serverIDs, err := dbTools.GetUserServerIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+	memberships := make(map[string]bool, len(serverIDs))
+	members := []interface{}{membershipSentinel}
+	for _, serverID := range serverIDs {
+		memberships[serverID.String()] = true
+		members = append(members, serverID.String())
+	}
+	if err := utils.RedisSAddWithTTL(ctx, key, membershipCacheTTL, members...); err != nil {
+		utils.Warn("Écriture du cache des adhésions impossible pour " + userID.String() + ": " + err.Error())
+	}
+	return memberships, nil
+}
+
+// isClientMember indique si l'utilisateur de la connexion est membre du serveur, en
+// chargeant le cache de la connexion au besoin.
+func isClientMember(currentClient *Client, serverID string) (bool, error) {
+	hub.mu.RLock()
+	memberships := currentClient.Memberships
+	hub.mu.RUnlock()
+	if memberships == nil {
+		var err error
+		if memberships, err = loadMemberships(gocql.UUID(currentClient.UserID)); err != nil {
+			return false, err
+		}
+		hub.mu.Lock()
+		currentClient.Memberships = memberships
+		hub.mu.Unlock()
+	}
+	return memberships[serverID], nil
+}
+
+// requireMembership refuse l'opération si l'utilisateur n'est pas membre du serveur.
+func requireMembership(currentClient *Client, serverID string) error {
+	isMember, err := isClientMember(currentClient, serverID)
+	if err != nil {
+		utils.Error("Vérification de l'adhésion impossible pour " + currentClient.Username + ": " + err.Error())
+		return newGatewayError(gatewayInternalError, "Erreur interne.")
+	}
+	if !isMember {
+		return newGatewayError(gatewayNotMember, "Vous n'êtes pas membre de ce serveur.")
+	}
+	return nil
+}
+
+// dropMembershipCache supprime le cache Redis des adhésions d'un utilisateur.
+func dropMembershipCache(userID gocql.UUID) {
+	if err := utils.RedisDel(membershipCacheKey(userID.String())); err != nil {
+		utils.Error("Invalidation du cache des adhésions impossible pour " + userID.String() + ": " + err.Error())
+	}
+}
+
+// invalidateMemberships supprime le cache Redis des adhésions des utilisateurs et prévient
+// leurs connexions. status vaut membershipJoined ou membershipLeft : un départ sort aussi
+// les connexions actives sur le serveur. Les départs d'un membre (leave, kick, ban) passent
+// par member_remove, qui a le même effet.
+func invalidateMemberships(serverID gocql.UUID, status string, userIDs ...gocql.UUID) {
+	if len(userIDs) == 0 {
+		return
+	}
+	recipients := make([]string, 0, len(userIDs))
+	for _, userID := range userIDs {
+		dropMembershipCache(userID)
+		recipients = append(recipients, userID.String())
+	}
+	publishServerEvent(Message{
+		Type:         "membership_update",
+		ServerID:     serverID.String(),
+		Status:       status,
+		RecipientIDs: recipients,
+		Timestamp:    time.Now().UnixNano() / int64(time.Millisecond),
+	})
+}
+
+// resetMemberships vide le cache des adhésions des connexions : il sera rechargé à la
+// prochaine opération.
+func resetMemberships(stale []*Client) {
+	if len(stale) == 0 {
+		return
+	}
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	for _, client := range stale {
+		client.Memberships = nil
+	}
+}
@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils"
+	"github.com/gocql/gocql"
+	"github.com/gofiber/websocket/v2"
+)
+
+// Chaque message envoyé sur une session porte un numéro de séquence (seq) et est conservé
+// dans un tampon de reprise borné. Tant qu'une connexion est attachée, le tampon reste en
+// mémoire ; une fois la session détachée, il est recopié dans Redis
+// (gateway:replay:<sessionId>) avec les messages suivants, et libéré de la mémoire. La
+// session reste abonnée pendant resumeTimeout : l'opération resume y rattache une nouvelle
+// connexion et rejoue les messages manqués.
+const (
+	resumeTimeout = 2 * time.Minute
+	// replayBufferSize borne le tampon de chaque session, en mémoire comme dans Redis.
+	replayBufferSize = 200
+
+	gatewayInvalidSession = "invalid_session"
+)
+
+func replayKey(sessionID string) string {
+	return "gateway:replay:" + sessionID
+}
+
+// stampSeq insère le numéro de séquence en tête d'un message JSON.
+func stampSeq(payload []byte, seq int64) []byte {
+	if len(payload) < 2 || payload[0] != '{' {
+		return payload
+	}
+	stamped := make([]byte, 0, len(payload)+24)
+	stamped = append(stamped, `{"seq":`...)
+	stamped = strconv.AppendInt(stamped, seq, 10)
+	if payload[1] != '}' {
+		stamped = append(stamped, ',')
+	}
+	return append(stamped, payload[1:]...)
+}
+
+// appendReplay ajoute un message au tampon en mémoire en ne gardant que les replayBufferSize derniers.
+func appendReplay(buffer []queuedEvent, event queuedEvent) []queuedEvent {
+	if len(buffer) >= replayBufferSize {
+		buffer = buffer[len(buffer)-replayBufferSize+1:]
+	}
+	return append(buffer, event)
+}
+
+// persistReplay conserve un message d'une session détachée dans Redis ("<seq> <payload>").
+// Au premier message après le détachement, le tampon en mémoire y est recopié puis libéré.
+// client.connMu doit être verrouillé.
+func (client *Client) persistReplay(event queuedEvent) {
+	events := []queuedEvent{event}
+	if !client.persisted {
+		events = append(client.replay, event)
+		client.replay = nil
+		client.persisted = true
+	}
+	entries := make([]interface{}, len(events))
+	for i, queued := range events {
+		entries[i] = strconv.FormatInt(queued.seq, 10) + " " + string(queued.payload)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := utils.RedisRPushCapped(ctx, replayKey(client.SessionID), replayBufferSize, resumeTimeout, entries...); err != nil {
+		utils.Warn("Écriture du tampon de reprise impossible pour la session " + client.SessionID + ": " + err.Error())
+	}
+}
+
+// loadReplay relit le tampon de reprise d'une session détachée depuis Redis.
+func loadReplay(sessionID string) ([]queuedEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	entries, err := utils.RedisLRangeAll(ctx, replayKey(sessionID))
+	if err != nil {
+		return nil, err
+	}
+	buffer := make([]queuedEvent, 0, len(entries))
+	for _, entry := range entries {
+		rawSeq, payload, found := strings.Cut(entry, " ")
+		seq, err := strconv.ParseInt(rawSeq, 10, 64)
+		if !found || err != nil {
+			continue
+		}
+		buffer = append(buffer, queuedEvent{seq: seq, payload: []byte(payload)})
+	}
+	return buffer, nil
+}
+
+// missedEvents retourne les messages du tampon numérotés après lastSeq, ou false si le
+// tampon ne les contient plus tous. delivered est le dernier numéro conservé.
+func missedEvents(buffer []queuedEvent, lastSeq, delivered int64) ([][]byte, bool) {
+	if lastSeq == delivered {
+		return nil, true
+	}
+	if lastSeq > delivered || lastSeq < 0 {
+		return nil, false
+	}
+
+	missed := make([][]byte, 0, delivered-lastSeq)
+	for _, event := range buffer {
+		if event.seq <= lastSeq {
+			continue
+		}
+		// Le premier message manqué doit suivre directement le dernier reçu.
+		if len(missed) == 0 && event.seq != lastSeq+1 {
+			return nil, false
+		}
+		missed = append(missed, event.payload)
+	}
+	return missed, int64(len(missed)) == delivered-lastSeq
+}
+
+// attach rattache une connexion à la session après avoir rejoué les messages suivant lastSeq.
+// Une éventuelle connexion encore attachée est fermée.
+func (client *Client) attach(conn *websocket.Conn, lastSeq int64) error {
+	client.connMu.Lock()
+	defer client.connMu.Unlock()
+	if client.ended || client.isClosed() {
+		return newGatewayError(gatewayInvalidSession, "Session expirée.")
+	}
+	buffer := client.replay
+	if client.persisted {
+		var err error
+		if buffer, err = loadReplay(client.SessionID); err != nil {
+			utils.Warn("Lecture du tampon de reprise impossible pour la session " + client.SessionID + ": " + err.Error())
+			return newGatewayError(gatewayInvalidSession, "Les messages manqués ne sont plus disponibles.")
+		}
+	}
+	missed, ok := missedEvents(buffer, lastSeq, client.delivered)
+	if !ok {
+		return newGatewayError(gatewayInvalidSession, "Les messages manqués ne sont plus disponibles.")
+	}
+
+	if client.Conn != nil {
+		client.Conn.Close()
+		client.Conn = nil
+	}
+	for _, payload := range missed {
+		conn.SetWriteDeadline(time.Now().Add(writeWait))
+		if err := conn.WriteMessage(websocket.TextMessage, payload); err != nil {
+			return err
+		}
+	}
+	client.Conn = conn
+	// Le tampon revient en mémoire tant que la connexion reste attachée.
+	client.replay = buffer
+	if client.persisted {
+		client.persisted = false
+		dropReplayBuffer(client.SessionID)
+	}
+	if client.resumeTimer != nil {
+		client.resumeTimer.Stop()
+		client.resumeTimer = nil
+	}
+	return nil
+}
+
+// detach détache la connexion de la session à la fin de sa boucle de lecture. La session
+// reste ouverte pendant resumeTimeout ; true indique qu'elle doit être terminée tout de suite.
+func (client *Client) detach(conn *websocket.Conn) bool {
+	client.connMu.Lock()
+	defer client.connMu.Unlock()
+	if client.Conn == conn {
+		client.Conn = nil
+	}
+	// Reprise par une autre connexion, ou session déjà terminée.
+	if client.Conn != nil || client.ended {
+		return false
+	}
+	if client.isClosed() {
+		client.ended = true
+		return true
+	}
+	client.resumeTimer = time.AfterFunc(resumeTimeout, client.expire)
+	return false
+}
+
+// expire termine une session restée détachée pendant toute sa fenêtre de reprise.
+func (client *Client) expire() {
+	client.connMu.Lock()
+	if client.Conn != nil || client.ended {
+		client.connMu.Unlock()
+		return
+	}
+	client.ended = true
+	client.connMu.Unlock()
+	endSession(client)
+}
+
+// handleResume rattache la connexion de currentClient, tout juste ouverte, à la session
+// demandée et retourne celle-ci. La session ouverte pour la connexion est abandonnée.
+func handleResume(currentClient *Client, incomingMessage Message) (*Client, error) {
+	if incomingMessage.SessionID == "" {
+		return nil, newGatewayError(gatewayInvalidRequest, "SessionID manquant.")
+	}
+	resumed := hub.session(incomingMessage.SessionID)
+	if resumed == nil || resumed == currentClient || resumed.UserID != currentClient.UserID || !resumed.identified.Load() {
+		return nil, newGatewayError(gatewayInvalidSession, "Session inconnue.")
+	}
+
+	// La connexion quitte la session ouverte à la connexion avant d'être rattachée.
+	currentClient.connMu.Lock()
+	conn := currentClient.Conn
+	currentClient.Conn = nil
+	currentClient.connMu.Unlock()
+
+	if err := resumed.attach(conn, incomingMessage.Seq); err != nil {
+		currentClient.connMu.Lock()
+		currentClient.Conn = conn
+		currentClient.connMu.Unlock()
+		return nil, err
+	}
+
+	currentClient.connMu.Lock()
+	currentClient.ended = true
+	currentClient.connMu.Unlock()
+	hub.unregister(currentClient)
+	dropReplayBuffer(currentClient.SessionID)
+
+	// Détachée trop longtemps, la session a pu être annoncée hors ligne par le reaper.
+	wasOnline := isOnline(gocql.UUID(resumed.UserID))
+	resumed.lastHeartbeat.Store(time.Now().UnixNano())
+	if err := touchPresence(resumed); err != nil {
+		utils.Warn("Mise à jour de la présence impossible pour " + resumed.Username + ": " + err.Error())
+	} else if !wasOnline {
+		announceOnline(resumed)
+	}
+	utils.Info("Session " + resumed.SessionID + " reprise par " + resumed.Username)
+	sendToClient(resumed, Message{Type: "resumed", SessionID: resumed.SessionID})
+	return resumed, nil
+}
+
+// dropReplayBuffer supprime le tampon de reprise d'une session terminée.
+func dropReplayBuffer(sessionID string) {
+	if err := utils.RedisDel(replayKey(sessionID)); err != nil {
+		utils.Warn("Suppression du tampon de reprise impossible pour la session " + sessionID + ": " + err.Error())
+	}
+}
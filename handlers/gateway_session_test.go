@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestStampSeq(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		seq     int64
+		want    string
+	}{
+		{name: "objet", payload: `{"type":"chat"}`, seq: 7, want: `{"seq":7,"type":"chat"}`},
+		{name: "objet vide", payload: `{}`, seq: 1, want: `{"seq":1}`},
+		{name: "grand numéro", payload: `{"a":1}`, seq: 9007199254740993, want: `{"seq":9007199254740993,"a":1}`},
+		{name: "tableau inchangé", payload: `[1,2]`, seq: 3, want: `[1,2]`},
+		{name: "chaîne vide inchangée", payload: ``, seq: 3, want: ``},
+		{name: "accolade seule inchangée", payload: `{`, seq: 3, want: `{`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(stampSeq([]byte(tt.payload), tt.seq)); got != tt.want {
+				t.Errorf("stampSeq(%s, %d) = %s, attendu %s", tt.payload, tt.seq, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMissedEvents(t *testing.T) {
+	buffer := func(seqs ...int64) []queuedEvent {
+		events := make([]queuedEvent, len(seqs))
+		for i, seq := range seqs {
+			events[i] = queuedEvent{seq: seq, payload: []byte(strconv.FormatInt(seq, 10))}
+		}
+		return events
+	}
+	payloads := func(seqs ...int64) [][]byte {
+		missed := make([][]byte, len(seqs))
+		for i, seq := range seqs {
+			missed[i] = []byte(strconv.FormatInt(seq, 10))
+		}
+		return missed
+	}
+
+	tests := []struct {
+		name      string
+		buffer    []queuedEvent
+		lastSeq   int64
+		delivered int64
+		want      [][]byte
+		ok        bool
+	}{
+		{name: "rien de manqué", buffer: buffer(1, 2, 3), lastSeq: 3, delivered: 3, ok: true},
+		{name: "rien de manqué sans tampon", lastSeq: 0, delivered: 0, ok: true},
+		{name: "messages manqués", buffer: buffer(1, 2, 3, 4), lastSeq: 2, delivered: 4, want: payloads(3, 4), ok: true},
+		{name: "tout rejouer depuis zéro", buffer: buffer(1, 2), lastSeq: 0, delivered: 2, want: payloads(1, 2), ok: true},
+		{name: "tampon tronqué", buffer: buffer(5, 6, 7), lastSeq: 2, delivered: 7, ok: false},
+		{name: "tampon incomplet", buffer: buffer(1, 2, 3), lastSeq: 1, delivered: 5, ok: false},
+		{name: "trou dans le tampon", buffer: buffer(1, 2, 4), lastSeq: 1, delivered: 4, ok: false},
+		{name: "séquence du client en avance", buffer: buffer(1, 2), lastSeq: 3, delivered: 2, ok: false},
+		{name: "séquence négative", buffer: buffer(1, 2), lastSeq: -1, delivered: 2, ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := missedEvents(tt.buffer, tt.lastSeq, tt.delivered)
+			if ok != tt.ok {
+				t.Fatalf("missedEvents(%d, %d) ok = %v, attendu %v", tt.lastSeq, tt.delivered, ok, tt.ok)
+			}
+			if ok && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("missedEvents(%d, %d) = %q, attendu %q", tt.lastSeq, tt.delivered, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppendReplay(t *testing.T) {
+	var buffer []queuedEvent
+	for seq := int64(1); seq <= replayBufferSize+5; seq++ {
+		buffer = appendReplay(buffer, queuedEvent{seq: seq})
+	}
+	if len(buffer) != replayBufferSize {
+		t.Fatalf("%d messages dans le tampon, attendu %d", len(buffer), replayBufferSize)
+	}
+	if first, last := buffer[0].seq, buffer[len(buffer)-1].seq; first != 6 || last != replayBufferSize+5 {
+		t.Errorf("tampon de %d à %d, attendu de 6 à %d", first, last, replayBufferSize+5)
+	}
+}
@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils"
+	"github.com/gofiber/websocket/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	// sendQueueSize borne la file d'envoi de chaque session : un client qui ne la vide
+	// pas assez vite est déconnecté plutôt que de ralentir la diffusion.
+	sendQueueSize = 256
+	// writeWait borne l'écriture d'un message sur la connexion.
+	writeWait = 10 * time.Second
+)
+
+// queuedEvent est un message numéroté en attente d'envoi.
+type queuedEvent struct {
+	seq     int64
+	payload []byte
+}
+
+// clientSet est un ensemble de connexions.
+type clientSet map[*Client]struct{}
+
+// Hub indexe les sessions par identifiant, utilisateur, serveur actif et salon actif pour
+// que la diffusion d'un événement ne parcoure que ses abonnés. mu protège les index et
+// l'état de navigation des clients (CurrentServerID, CurrentChannelID, Permissions...).
+// Une session reste indexée pendant sa fenêtre de reprise, même sans connexion.
+type Hub struct {
+	mu        sync.RWMutex
+	sessions  map[string]*Client
+	byUser    map[string]clientSet
+	byServer  map[string]clientSet
+	byChannel map[string]clientSet
+}
+
+var hub = &Hub{
+	sessions:  make(map[string]*Client),
+	byUser:    make(map[string]clientSet),
+	byServer:  make(map[string]clientSet),
+	byChannel: make(map[string]clientSet),
+}
+
+func addToIndex(index map[string]clientSet, key string, client *Client) {
+	if key == "" {
+		return
+	}
+	set, ok := index[key]
+	if !ok {
+		set = make(clientSet)
+		index[key] = set
+	}
+	set[client] = struct{}{}
+}
+
+func removeFromIndex(index map[string]clientSet, key string, client *Client) {
+	if set, ok := index[key]; ok {
+		delete(set, client)
+		if len(set) == 0 {
+			delete(index, key)
+		}
+	}
+}
+
+// register ouvre une session pour la connexion du client et démarre son goroutine d'envoi.
+func (h *Hub) register(client *Client) {
+	client.SessionID = uuid.NewString()
+	client.send = make(chan queuedEvent, sendQueueSize)
+	client.done = make(chan struct{})
+	client.pumpDone = make(chan struct{})
+	go client.pump()
+
+	h.mu.Lock()
+	h.sessions[client.SessionID] = client
+	addToIndex(h.byUser, client.UserID.String(), client)
+	h.mu.Unlock()
+}
+
+// unregister retire une session de tous les index et arrête son goroutine d'envoi.
+func (h *Hub) unregister(client *Client) {
+	h.mu.Lock()
+	delete(h.sessions, client.SessionID)
+	removeFromIndex(h.byUser, client.UserID.String(), client)
+	removeFromIndex(h.byServer, client.CurrentServerID, client)
+	removeFromIndex(h.byChannel, client.CurrentChannelID, client)
+	h.mu.Unlock()
+
+	client.close()
+	<-client.pumpDone
+}
+
+// session retourne une session encore ouverte.
+func (h *Hub) session(sessionID string) *Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.sessions[sessionID]
+}
+
+// joinServer sélectionne le serveur actif d'une connexion. Le salon actif est réinitialisé.
+func (h *Hub) joinServer(client *Client, serverID string, permissions *models.MemberPermissions) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.clearServer(client)
+	client.CurrentServerID = serverID
+	client.Permissions = permissions
+	addToIndex(h.byServer, serverID, client)
+}
+
+// leaveServer quitte le serveur actif s'il s'agit de serverID.
+func (h *Hub) leaveServer(client *Client, serverID string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if client.CurrentServerID != serverID {
+		return false
+	}
+	h.clearServer(client)
+	return true
+}
+
+// joinChannel sélectionne le salon actif d'une connexion.
+func (h *Hub) joinChannel(client *Client, channelID string, inThread bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	removeFromIndex(h.byChannel, client.CurrentChannelID, client)
+	client.CurrentChannelID = channelID
+	client.InThread = inThread
+	addToIndex(h.byChannel, channelID, client)
+}
+
+// leaveChannel quitte le salon actif s'il s'agit de channelID.
+func (h *Hub) leaveChannel(client *Client, channelID string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if client.CurrentChannelID != channelID {
+		return false
+	}
+	removeFromIndex(h.byChannel, channelID, client)
+	client.CurrentChannelID = ""
+	client.InThread = false
+	return true
+}
+
+// evict sort du serveur les connexions qui y sont encore actives (départ, expulsion,
+// bannissement ou suppression du serveur).
+func (h *Hub) evict(targets []*Client, serverID string) {
+	if len(targets) == 0 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, client := range targets {
+		if client.CurrentServerID == serverID {
+			h.clearServer(client)
+		}
+	}
+}
+
+// clearServer réinitialise le serveur et le salon actifs. h.mu doit être verrouillé en écriture.
+func (h *Hub) clearServer(client *Client) {
+	removeFromIndex(h.byServer, client.CurrentServerID, client)
+	removeFromIndex(h.byChannel, client.CurrentChannelID, client)
+	client.CurrentServerID = ""
+	client.CurrentChannelID = ""
+	client.InThread = false
+	client.Permissions = nil
+}
+
+// userClients retourne les connexions des utilisateurs. h.mu doit être verrouillé.
+func (h *Hub) userClients(userIDs ...string) []*Client {
+	targets := make([]*Client, 0, len(userIDs))
+	for _, userID := range userIDs {
+		for client := range h.byUser[userID] {
+			targets = append(targets, client)
+		}
+	}
+	return targets
+}
+
+// enqueue numérote un message et le place dans la file d'envoi de la session. Si la file
+// est pleine, le client est trop lent : sa session est fermée et le message abandonné.
+func (client *Client) enqueue(payload []byte) {
+	client.seqMu.Lock()
+	defer client.seqMu.Unlock()
+	select {
+	case <-client.done:
+		return
+	default:
+	}
+	client.seq++
+	select {
+	case client.send <- queuedEvent{seq: client.seq, payload: stampSeq(payload, client.seq)}:
+	default:
+		utils.Warn("File d'envoi pleine, fermeture de la session du client lent " + client.Username + " (" + client.UserID.String() + ")")
+		client.close()
+	}
+}
+
+// close termine la session. Le goroutine d'envoi s'arrête et ferme la connexion
+// éventuelle, ce qui termine sa boucle de lecture.
+func (client *Client) close() {
+	client.closeOnce.Do(func() {
+		close(client.done)
+	})
+}
+
+// isClosed indique si la session a été fermée.
+func (client *Client) isClosed() bool {
+	select {
+	case <-client.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// pump est le seul goroutine qui écrit sur la connexion de la session. Chaque message est
+// conservé dans le tampon de reprise (en mémoire, ou dans Redis si la session est détachée),
+// puis envoyé si une connexion est attachée.
+func (client *Client) pump() {
+	defer close(client.pumpDone)
+	defer func() {
+		client.connMu.Lock()
+		if client.Conn != nil {
+			client.Conn.Close()
+		}
+		client.connMu.Unlock()
+	}()
+	for {
+		select {
+		case <-client.done:
+			return
+		case event := <-client.send:
+			client.deliver(event)
+		}
+	}
+}
+
+func (client *Client) deliver(event queuedEvent) {
+	client.connMu.Lock()
+	defer client.connMu.Unlock()
+	client.delivered = event.seq
+	if client.Conn == nil {
+		client.persistReplay(event)
+		return
+	}
+	client.replay = appendReplay(client.replay, event)
+	client.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+	if err := client.Conn.WriteMessage(websocket.TextMessage, event.payload); err != nil {
+		// La boucle de lecture de cette connexion détache la session.
+		utils.Warn("Erreur envoi au client " + client.Username + ": " + err.Error())
+		client.Conn.Close()
+		client.Conn = nil
+	}
+}
@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/Romain-GUILLEMOT/WhispyrBack/db"
+	middlewares "github.com/Romain-GUILLEMOT/WhispyrBack/middleware"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils/dbTools"
+	"github.com/gocql/gocql"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type createInviteInput struct {
+	MaxAge    *int `json:"max_age" validate:"omitempty,min=0,max=604800"` // En secondes, 0 = n'expire jamais
+	MaxUses   int  `json:"max_uses" validate:"min=0,max=100"`             // 0 = illimité
+	Temporary bool `json:"temporary"`
+}
+
+type invitePreview struct {
+	Code           string     `json:"code"`
+	ServerID       gocql.UUID `json:"server_id"`
+	ServerName     string     `json:"server_name"`
+	ServerAvatar   string     `json:"server_avatar,omitempty"`
+	MemberCount    int        `json:"member_count"`
+	InviterID      gocql.UUID `json:"inviter_id"`
+	InviterName    string     `json:"inviter_username"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	Temporary      bool       `json:"temporary"`
+	AlreadyAMember bool       `json:"already_member"`
+}
+
+const defaultInviteMaxAge = 24 * 60 * 60 // 24h
+
+// ----------------------
+// 📌 Créer une invitation
+// ----------------------
+func CreateInvite(c *fiber.Ctx) error {
+	member := middlewares.GetMember(c)
+
+	var input createInviteInput
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Données invalides."})
+		}
+	}
+	if err := validate.Struct(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Champs invalides."})
+	}
+
+	maxAge := defaultInviteMaxAge
+	if input.MaxAge != nil {
+		maxAge = *input.MaxAge
+	}
+
+	now := time.Now()
+	invite := &models.Invite{
+		ServerID:  member.ServerID,
+		InviterID: member.UserID,
+		MaxUses:   input.MaxUses,
+		Temporary: input.Temporary,
+		CreatedAt: now,
+	}
+	if maxAge > 0 {
+		invite.ExpiresAt = now.Add(time.Duration(maxAge) * time.Second)
+	}
+
+	if err := dbTools.CreateInvite(invite); err != nil {
+		utils.Error("Création de l'invitation impossible", "serverId", member.ServerID, "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de la création de l'invitation."})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(invite)
+}
+
+// ----------------------
+// 📌 Lister les invitations d'un serveur
+// ----------------------
+func GetServerInvites(c *fiber.Ctx) error {
+	member := middlewares.GetMember(c)
+
+	invites, err := dbTools.GetServerInvites(member.ServerID)
+	if err != nil {
+		utils.Error("Lecture des invitations impossible", "serverId", member.ServerID, "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de la lecture des invitations."})
+	}
+	return c.JSON(invites)
+}
+
+// ----------------------
+// 📌 Révoquer une invitation
+// ----------------------
+func DeleteInvite(c *fiber.Ctx) error {
+	member := middlewares.GetMember(c)
+	code := c.Params("code")
+
+	invite, err := dbTools.GetInvite(code)
+	if err != nil || invite.ServerID != member.ServerID {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Invitation introuvable."})
+	}
+
+	if err := dbTools.DeleteInvite(member.ServerID, code); err != nil {
+		utils.Error("Suppression de l'invitation impossible", "code", code, "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de la suppression de l'invitation."})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Invitation révoquée."})
+}
+
+// ----------------------
+// 📌 Aperçu d'une invitation (nom, avatar et nombre de membres du serveur)
+// ----------------------
+func PreviewInvite(c *fiber.Ctx) error {
+	rawUserID := c.Locals("user_id").(*uuid.UUID)
+	userID := gocql.UUID(*rawUserID)
+
+	invite, status, msg := loadValidInvite(c.Params("code"))
+	if invite == nil {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+
+	preview := invitePreview{
+		Code:      invite.Code,
+		ServerID:  invite.ServerID,
+		InviterID: invite.InviterID,
+		Temporary: invite.Temporary,
+	}
+	if !invite.ExpiresAt.IsZero() {
+		preview.ExpiresAt = &invite.ExpiresAt
+	}
+
+	if err := db.Session.Query(`SELECT name, avatar FROM servers WHERE server_id = ?`, invite.ServerID).Scan(&preview.ServerName, &preview.ServerAvatar); err != nil {
+		if err == gocql.ErrNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Ce serveur n'existe plus."})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur de récupération du serveur."})
+	}
+
+	count, err := dbTools.CountServerMembers(invite.ServerID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur de récupération des membres."})
+	}
+	preview.MemberCount = count
+
+	inviterID := uuid.UUID(invite.InviterID)
+	if inviter, err := dbTools.GetUserByID(&inviterID); err == nil {
+		preview.InviterName = inviter.Username
+	}
+
+	if isMember, err := dbTools.IsServerMember(invite.ServerID, userID); err == nil {
+		preview.AlreadyAMember = isMember
+	}
+
+	return c.JSON(preview)
+}
+
+// ----------------------
+// 📌 Accepter une invitation
+// ----------------------
+func AcceptInvite(c *fiber.Ctx) error {
+	rawUserID := c.Locals("user_id").(*uuid.UUID)
+	userID := gocql.UUID(*rawUserID)
+
+	invite, status, msg := loadValidInvite(c.Params("code"))
+	if invite == nil {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+
+	var serverAvatar string
+	if err := db.Session.Query(`SELECT avatar FROM servers WHERE server_id = ?`, invite.ServerID).Scan(&serverAvatar); err != nil {
+		if err == gocql.ErrNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Ce serveur n'existe plus."})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur de récupération du serveur."})
+	}
+
+	isMember, err := dbTools.IsServerMember(invite.ServerID, userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur interne."})
+	}
+	if isMember {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Vous êtes déjà membre de ce serveur.", "server_id": invite.ServerID})
+	}
+	if status, msg := checkNotBanned(invite.ServerID, userID); status != 0 {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+
+	if err := dbTools.UseInvite(invite); err != nil {
+		if err == dbTools.ErrInviteExhausted {
+			return c.Status(fiber.StatusGone).JSON(fiber.Map{"message": "Cette invitation a expiré."})
+		}
+		utils.Error("Utilisation de l'invitation impossible", "code", invite.Code, "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur interne."})
+	}
+
+	if err := dbTools.AddServerMember(invite.ServerID, userID, serverAvatar, invite.Temporary); err != nil {
+		utils.Error("Server join batch failed", "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur pour rejoindre le serveur."})
+	}
+	invalidateMemberships(invite.ServerID, membershipJoined, userID)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":   "Serveur rejoint avec succès.",
+		"server_id": invite.ServerID,
+		"temporary": invite.Temporary,
+	})
+}
+
+// loadValidInvite charge une invitation et vérifie qu'elle est encore utilisable.
+func loadValidInvite(code string) (*models.Invite, int, string) {
+	invite, err := dbTools.GetInvite(code)
+	if err != nil {
+		if err == gocql.ErrNotFound {
+			return nil, fiber.StatusNotFound, "Invitation invalide."
+		}
+		utils.Error("Lecture de l'invitation impossible", "code", code, "err", err)
+		return nil, fiber.StatusInternalServerError, "Erreur interne."
+	}
+	if invite.IsExpired() {
+		return nil, fiber.StatusGone, "Cette invitation a expiré."
+	}
+	return invite, 0, ""
+}
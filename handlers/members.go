@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"strings"
+	"time"
+
+	middlewares "github.com/Romain-GUILLEMOT/WhispyrBack/middleware"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils/dbTools"
+	"github.com/gocql/gocql"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Statuts des événements member_remove diffusés aux clients du serveur.
+const (
+	memberRemoveLeft   = "left"
+	memberRemoveKicked = "kicked"
+	memberRemoveBanned = "banned"
+)
+
+type banInput struct {
+	Reason   string `json:"reason" validate:"max=512"`
+	Duration int    `json:"duration" validate:"min=0"` // En secondes, 0 = définitif
+}
+
+// ----------------------
+// 📌 Quitter un serveur
+// ----------------------
+func LeaveServer(c *fiber.Ctx) error {
+	member := middlewares.GetMember(c)
+
+	if member.IsOwner {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Le propriétaire doit transférer ou supprimer le serveur avant de le quitter."})
+	}
+
+	if err := dbTools.RemoveServerMember(member.ServerID, member.UserID); err != nil {
+		utils.Error("Server leave batch failed", "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur pour quitter le serveur."})
+	}
+
+	publishMemberRemove(member.ServerID, member.UserID, memberRemoveLeft, "")
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Vous avez quitté le serveur."})
+}
+
+// ----------------------
+// 📌 Expulser un membre
+// ----------------------
+func KickMember(c *fiber.Ctx) error {
+	member := middlewares.GetMember(c)
+
+	target, status, msg := resolveManageableMember(c, member)
+	if target == nil {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+	if target.UserID == member.UserID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Utilisez la route /leave pour quitter le serveur."})
+	}
+
+	if err := dbTools.RemoveServerMember(member.ServerID, target.UserID); err != nil {
+		utils.Error("Server kick batch failed", "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de l'expulsion."})
+	}
+
+	publishMemberRemove(member.ServerID, target.UserID, memberRemoveKicked, "")
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Membre expulsé."})
+}
+
+// ----------------------
+// 📌 Bannir un utilisateur (membre ou non)
+// ----------------------
+func BanMember(c *fiber.Ctx) error {
+	member := middlewares.GetMember(c)
+
+	targetID, err := gocql.ParseUUID(c.Params("userId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID d'utilisateur invalide."})
+	}
+	if targetID == member.UserID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Vous ne pouvez pas vous bannir vous-même."})
+	}
+
+	var input banInput
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Données invalides."})
+		}
+	}
+	if err := validate.Struct(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Champs invalides."})
+	}
+
+	// Si l'utilisateur est membre, la hiérarchie des rôles s'applique.
+	target, err := dbTools.GetMemberPermissions(member.ServerID, targetID)
+	if err != nil && err != gocql.ErrNotFound {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur interne."})
+	}
+	if target != nil && (target.IsOwner || !member.Outranks(target.Position)) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Vous ne pouvez pas gérer un membre égal ou supérieur à vous."})
+	}
+
+	now := time.Now()
+	ban := models.ServerBan{
+		ServerID: member.ServerID,
+		UserID:   targetID,
+		Reason:   strings.TrimSpace(input.Reason),
+		BannedBy: member.UserID,
+		BannedAt: now,
+	}
+	if input.Duration > 0 {
+		ban.ExpiresAt = now.Add(time.Duration(input.Duration) * time.Second)
+	}
+
+	if err := dbTools.BanMember(ban); err != nil {
+		utils.Error("Server ban batch failed", "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors du bannissement."})
+	}
+
+	if target != nil {
+		publishMemberRemove(member.ServerID, targetID, memberRemoveBanned, ban.Reason)
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Utilisateur banni.", "ban": ban})
+}
+
+// ----------------------
+// 📌 Lever un bannissement
+// ----------------------
+func UnbanMember(c *fiber.Ctx) error {
+	member := middlewares.GetMember(c)
+
+	targetID, err := gocql.ParseUUID(c.Params("userId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID d'utilisateur invalide."})
+	}
+
+	if _, err := dbTools.GetActiveBan(member.ServerID, targetID); err != nil {
+		if err == gocql.ErrNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Cet utilisateur n'est pas banni."})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur interne."})
+	}
+
+	if err := dbTools.UnbanMember(member.ServerID, targetID); err != nil {
+		utils.Error("Server unban failed", "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de la levée du bannissement."})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Bannissement levé."})
+}
+
+// ----------------------
+// 📌 Lister les bannissements
+// ----------------------
+func GetServerBans(c *fiber.Ctx) error {
+	member := middlewares.GetMember(c)
+
+	bans, err := dbTools.GetServerBans(member.ServerID)
+	if err != nil {
+		utils.Error("Lecture des bannissements impossible", "serverId", member.ServerID, "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de la lecture des bannissements."})
+	}
+	return c.JSON(bans)
+}
+
+// checkNotBanned renvoie un message d'erreur si l'utilisateur est banni du serveur.
+func checkNotBanned(serverID, userID gocql.UUID) (int, string) {
+	if _, err := dbTools.GetActiveBan(serverID, userID); err == nil {
+		return fiber.StatusForbidden, "Vous êtes banni de ce serveur."
+	} else if err != gocql.ErrNotFound {
+		return fiber.StatusInternalServerError, "Erreur interne."
+	}
+	return 0, ""
+}
+
+// publishMemberRemove notifie le serveur du départ d'un membre. Le broadcaster
+// force aussi la sortie des connexions de ce membre actives sur le serveur et vide
+// leur cache des adhésions.
+func publishMemberRemove(serverID, userID gocql.UUID, status, reason string) {
+	dropMembershipCache(userID)
+	publishServerEvent(Message{
+		Type:      "member_remove",
+		ServerID:  serverID.String(),
+		UserID:    userID.String(),
+		Status:    status,
+		Content:   reason,
+		Timestamp: time.Now().UnixNano() / int64(time.Millisecond),
+	})
+}
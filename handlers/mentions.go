@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils/dbTools"
+	"github.com/gocql/gocql"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// Nombre maximal de mentions explicites (utilisateurs + rôles) prises en compte par message.
+const maxMentionsPerMessage = 50
+
+var (
+	userMentionPattern = regexp.MustCompile(`<@([0-9a-fA-F-]{36})>`)
+	roleMentionPattern = regexp.MustCompile(`<@&([^<>]{1,32})>`)
+)
+
+// parsedMentions regroupe les mentions extraites du contenu d'un message, sans doublons.
+type parsedMentions struct {
+	Users    []gocql.UUID
+	Roles    []string
+	Everyone bool
+	Here     bool // Jamais vrai en même temps que Everyone
+}
+
+// parseMentions extrait les mentions du contenu d'un message. Les rôles réservés (hors
+// "admin") sont ignorés ; @everyone et @here ne comptent qu'avec canMentionEveryone.
+func parseMentions(content string, canMentionEveryone bool) parsedMentions {
+	var parsed parsedMentions
+	seenUsers := make(map[gocql.UUID]bool)
+	for _, match := range userMentionPattern.FindAllStringSubmatch(content, maxMentionsPerMessage) {
+		userID, err := gocql.ParseUUID(match[1])
+		if err != nil || seenUsers[userID] {
+			continue
+		}
+		seenUsers[userID] = true
+		parsed.Users = append(parsed.Users, userID)
+	}
+
+	seenRoles := make(map[string]bool)
+	for _, match := range roleMentionPattern.FindAllStringSubmatch(content, maxMentionsPerMessage) {
+		role := match[1]
+		// Le rôle "admin", bien que réservé, est un vrai rôle du serveur et reste mentionnable.
+		if (models.IsReservedRole(role) && role != models.RoleAdmin) || seenRoles[role] {
+			continue
+		}
+		seenRoles[role] = true
+		parsed.Roles = append(parsed.Roles, role)
+	}
+
+	if canMentionEveryone {
+		// Une mention de rôle telle que <@&@everyone> ne déclenche pas @everyone.
+		withoutRoles := roleMentionPattern.ReplaceAllString(content, "")
+		parsed.Everyone = strings.Contains(withoutRoles, "@everyone")
+		parsed.Here = !parsed.Everyone && strings.Contains(withoutRoles, "@here")
+	}
+	return parsed
+}
+
+// resolveMentions analyse le contenu du message, renseigne Mentions, MentionRoles et
+// MentionEveryone, et retourne les membres à notifier (auteur exclu). Sans la permission
+// MENTION_EVERYONE, @everyone et @here restent du texte. Seuls les membres qui voient le
+// salon sont notifiés.
+func resolveMentions(member *models.MemberPermissions, message *models.MessageByChannel) ([]gocql.UUID, error) {
+	parsed := parseMentions(message.Content, member.Has(models.PermMentionEveryone))
+	everyone, here := parsed.Everyone, parsed.Here
+	if len(parsed.Users) == 0 && len(parsed.Roles) == 0 && !everyone && !here {
+		return nil, nil
+	}
+
+	memberRoles, err := dbTools.GetServerMemberRoles(member.ServerID)
+	if err != nil {
+		return nil, err
+	}
+
+	notified := make(map[gocql.UUID]bool)
+	for _, userID := range parsed.Users {
+		if _, ok := memberRoles[userID]; ok {
+			notified[userID] = true
+			message.Mentions = append(message.Mentions, userID)
+		}
+	}
+
+	if len(parsed.Roles) > 0 {
+		mentionedRoles := make(map[string]bool, len(parsed.Roles))
+		for _, role := range parsed.Roles {
+			mentionedRoles[role] = true
+		}
+		message.MentionRoles = append(message.MentionRoles, parsed.Roles...)
+		for userID, role := range memberRoles {
+			if mentionedRoles[role] {
+				notified[userID] = true
+			}
+		}
+	}
+
+	if everyone || here {
+		message.MentionEveryone = true
+		candidates := make([]gocql.UUID, 0, len(memberRoles))
+		for userID := range memberRoles {
+			candidates = append(candidates, userID)
+		}
+		if here {
+			// @here ne vise que les membres connectés.
+			if candidates, err = filterOnline(candidates); err != nil {
+				return nil, err
+			}
+		}
+		for _, userID := range candidates {
+			notified[userID] = true
+		}
+	}
+
+	delete(notified, message.SenderID)
+	recipients := make([]gocql.UUID, 0, len(notified))
+	for userID := range notified {
+		recipients = append(recipients, userID)
+	}
+	// Seuls les membres qui voient le salon sont notifiés.
+	return filterChannelViewers(member.ServerID, message.ChannelID, recipients, memberRoles)
+}
+
+// filterOnline ne garde que les utilisateurs ayant au moins une session en ligne.
+func filterOnline(userIDs []gocql.UUID) ([]gocql.UUID, error) {
+	if len(userIDs) == 0 {
+		return userIDs, nil
+	}
+	online, err := onlineUsers(userIDs)
+	if err != nil {
+		return nil, err
+	}
+	filtered := make([]gocql.UUID, 0, len(userIDs))
+	for i, isOnline := range online {
+		if isOnline {
+			filtered = append(filtered, userIDs[i])
+		}
+	}
+	return filtered, nil
+}
+
+// notifyMentions enregistre la mention dans la boîte de réception de chaque destinataire
+// puis publie l'événement "mention". Le broadcaster ne le livre qu'aux connexions qui ne
+// sont pas déjà sur le salon (elles reçoivent l'événement chat). Exécuté en arrière-plan.
+func notifyMentions(event *Message, serverID gocql.UUID, message *models.MessageByChannel, recipients []gocql.UUID) {
+	if len(recipients) == 0 {
+		return
+	}
+	go func() {
+		recipientIDs := make([]string, 0, len(recipients))
+		for _, userID := range recipients {
+			recorded, err := dbTools.RecordMention(models.MentionByUser{
+				UserID:    userID,
+				MessageID: message.SentAt,
+				ChannelID: message.ChannelID,
+				ServerID:  serverID,
+			})
+			if err != nil {
+				utils.Error("Enregistrement de la mention impossible pour " + userID.String() + ": " + err.Error())
+			} else if !recorded {
+				continue // Déjà mentionné par ce message avant sa modification.
+			}
+			recipientIDs = append(recipientIDs, userID.String())
+		}
+		if len(recipientIDs) == 0 {
+			return
+		}
+
+		publishUserEvent(Message{
+			Type:         "mention",
+			ServerID:     event.ServerID,
+			ChannelID:    event.ChannelID,
+			MessageID:    event.MessageID,
+			UserID:       event.UserID,
+			Username:     event.Username,
+			Avatar:       event.Avatar,
+			Content:      snippet(event.Content, 100),
+			Timestamp:    event.Timestamp,
+			RecipientIDs: recipientIDs,
+		})
+	}()
+}
+
+// withdrawMentions retire la mention d'un message modifié aux membres qui ne sont plus
+// mentionnés. previous contient les mentions avant modification ; les membres visés par un
+// rôle ou @everyone sont retrouvés via leur rôle actuel. Exécuté en arrière-plan.
+func withdrawMentions(serverID gocql.UUID, previous, edited *models.MessageByChannel, recipients []gocql.UUID) {
+	if len(previous.Mentions) == 0 && len(previous.MentionRoles) == 0 && !previous.MentionEveryone {
+		return
+	}
+	go func() {
+		kept := make(map[gocql.UUID]bool, len(recipients))
+		for _, userID := range recipients {
+			kept[userID] = true
+		}
+		candidates := make(map[gocql.UUID]bool)
+		for _, userID := range previous.Mentions {
+			candidates[userID] = true
+		}
+		if len(previous.MentionRoles) > 0 || previous.MentionEveryone {
+			memberRoles, err := dbTools.GetServerMemberRoles(serverID)
+			if err != nil {
+				utils.Error("Lecture des membres impossible pour le retrait des mentions: " + err.Error())
+				return
+			}
+			mentionedRoles := make(map[string]bool, len(previous.MentionRoles))
+			for _, role := range previous.MentionRoles {
+				mentionedRoles[role] = true
+			}
+			for userID, role := range memberRoles {
+				if previous.MentionEveryone || mentionedRoles[role] {
+					candidates[userID] = true
+				}
+			}
+		}
+
+		// Seuls les membres réellement notifiés ont une mention à retirer.
+		for userID := range candidates {
+			if kept[userID] || userID == edited.SenderID {
+				continue
+			}
+			if err := dbTools.RemoveMention(models.MentionByUser{
+				UserID:    userID,
+				MessageID: edited.SentAt,
+				ChannelID: edited.ChannelID,
+				ServerID:  serverID,
+			}); err != nil {
+				utils.Error("Retrait de la mention impossible pour " + userID.String() + ": " + err.Error())
+			}
+		}
+	}()
+}
+
+// ----------------------
+// 📌 Mentions récentes de l'utilisateur (?limit=, ?before=<messageId>)
+// ----------------------
+func GetRecentMentions(c *fiber.Ctx) error {
+	rawUserID := c.Locals("user_id").(*uuid.UUID)
+	userID := gocql.UUID(*rawUserID)
+
+	limit := c.QueryInt("limit", 25)
+	if limit <= 0 || limit > 100 {
+		limit = 25
+	}
+	var before *gocql.UUID
+	if raw := c.Query("before"); raw != "" {
+		cursor, err := gocql.ParseUUID(raw)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Curseur invalide."})
+		}
+		before = &cursor
+	}
+
+	mentions, err := dbTools.GetUserMentions(userID, before, limit)
+	if err != nil {
+		utils.Error("Lecture des mentions impossible", "userId", userID, "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de la récupération des mentions."})
+	}
+
+	type mentionResponse struct {
+		ServerID  gocql.UUID      `json:"server_id"`
+		ChannelID gocql.UUID      `json:"channel_id"`
+		Message   MessageResponse `json:"message"`
+	}
+
+	// Les mentions de serveurs quittés depuis et de messages supprimés sont ignorées.
+	membership := make(map[gocql.UUID]bool)
+	results := make([]mentionResponse, 0, len(mentions))
+	for _, mention := range mentions {
+		isMember, checked := membership[mention.ServerID]
+		if !checked {
+			isMember, err = dbTools.IsServerMember(mention.ServerID, userID)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de la récupération des mentions."})
+			}
+			membership[mention.ServerID] = isMember
+		}
+		if !isMember {
+			continue
+		}
+		message, err := dbTools.GetMessage(mention.ChannelID, mention.MessageID)
+		if err != nil {
+			continue
+		}
+		results = append(results, mentionResponse{
+			ServerID:  mention.ServerID,
+			ChannelID: mention.ChannelID,
+			Message:   toMessageResponse(*message),
+		})
+	}
+
+	// Le curseur suit la boîte de réception et non les résultats filtrés.
+	var nextCursor string
+	if len(mentions) == limit {
+		nextCursor = mentions[len(mentions)-1].MessageID.String()
+	}
+	return c.JSON(fiber.Map{
+		"data":        results,
+		"next_cursor": nextCursor,
+	})
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gocql/gocql"
+)
+
+func TestParseMentions(t *testing.T) {
+	alice := gocql.MustRandomUUID()
+	bob := gocql.MustRandomUUID()
+
+	tests := []struct {
+		name               string
+		content            string
+		canMentionEveryone bool
+		want               parsedMentions
+	}{
+		{
+			name:    "texte sans mention",
+			content: "bonjour à tous",
+		},
+		{
+			name:    "utilisateurs dédoublonnés dans l'ordre",
+			content: "<@" + alice.String() + "> et <@" + bob.String() + "> puis <@" + alice.String() + ">",
+			want:    parsedMentions{Users: []gocql.UUID{alice, bob}},
+		},
+		{
+			name:    "identifiant d'utilisateur invalide ignoré",
+			content: "<@zzzzzzzz-zzzz-zzzz-zzzz-zzzzzzzzzzzz>",
+		},
+		{
+			name:    "rôles dédoublonnés",
+			content: "<@&modos> <@&devs> <@&modos>",
+			want:    parsedMentions{Roles: []string{"modos", "devs"}},
+		},
+		{
+			name:    "rôles réservés ignorés sauf admin",
+			content: "<@&owner> <@&member> <@&@everyone> <@&admin>",
+			want:    parsedMentions{Roles: []string{"admin"}},
+		},
+		{
+			name:    "@everyone sans la permission",
+			content: "@everyone @here",
+		},
+		{
+			name:               "@everyone l'emporte sur @here",
+			content:            "@here et @everyone",
+			canMentionEveryone: true,
+			want:               parsedMentions{Everyone: true},
+		},
+		{
+			name:               "@here seul",
+			content:            "@here réunion",
+			canMentionEveryone: true,
+			want:               parsedMentions{Here: true},
+		},
+		{
+			name:               "mention du rôle @everyone sans @everyone",
+			content:            "<@&@everyone>",
+			canMentionEveryone: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseMentions(tt.content, tt.canMentionEveryone)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseMentions(%q) = %+v, attendu %+v", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMentionsLimit(t *testing.T) {
+	content := ""
+	for i := 0; i < maxMentionsPerMessage+10; i++ {
+		content += "<@" + gocql.MustRandomUUID().String() + ">"
+	}
+	if got := len(parseMentions(content, false).Users); got != maxMentionsPerMessage {
+		t.Errorf("%d utilisateurs mentionnés, attendu %d", got, maxMentionsPerMessage)
+	}
+}
@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"mime/multipart"
+	"strings"
+	"time"
+
+	middlewares "github.com/Romain-GUILLEMOT/WhispyrBack/middleware"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils/dbTools"
+	"github.com/gocql/gocql"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const maxMessageLength = 4000
+
+// resolveReplyTo valide l'ID du message cité par une réponse (vide = pas de réponse).
+// Le message cité doit exister dans le même salon.
+func resolveReplyTo(channelID gocql.UUID, raw string) (gocql.UUID, string) {
+	if raw == "" {
+		return gocql.UUID{}, ""
+	}
+	replyTo, err := gocql.ParseUUID(raw)
+	if err != nil {
+		return replyTo, "ID du message cité invalide."
+	}
+	if _, err := dbTools.GetMessage(channelID, replyTo); err != nil {
+		return replyTo, "Le message cité est introuvable."
+	}
+	return replyTo, ""
+}
+
+// createChannelMessage persiste un nouveau message puis publie l'événement chat sur
+// chat:channel:<id>. Le TimeUUID est généré une seule fois : il sert d'ID au message
+// diffusé et à la ligne persistée. recipientIDs n'est renseigné que pour un salon privé.
+func createChannelMessage(serverID string, recipientIDs []string, message *models.MessageByChannel, nonce string) (*Message, error) {
+	now := time.Now()
+	message.SentAt = gocql.UUIDFromTime(now)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := dbTools.SaveMessageToScylla(ctx, message); err != nil {
+		return nil, err
+	}
+	serverUUID, _ := gocql.ParseUUID(serverID) // Nul pour un salon privé
+	if err := dbTools.RecordChannelActivity(serverUUID, message.ChannelID, message.SenderID, message.SentAt); err != nil {
+		utils.Warn("Mise à jour de l'état de lecture impossible pour le salon " + message.ChannelID.String() + ": " + err.Error())
+	}
+	if serverUUID != (gocql.UUID{}) {
+		indexMessage(serverUUID, message)
+	}
+
+	chatMsg := Message{
+		Type:         "chat",
+		ServerID:     serverID,
+		ChannelID:    message.ChannelID.String(),
+		MessageID:    message.SentAt.String(),
+		Nonce:        nonce,
+		UserID:       message.SenderID.String(),
+		Username:     message.SenderUsername,
+		Avatar:       message.SenderAvatar,
+		Content:      message.Content,
+		Attachments:  message.Attachments,
+		Timestamp:    now.UnixNano() / int64(time.Millisecond),
+		RecipientIDs: recipientIDs,
+	}
+	for _, userID := range message.Mentions {
+		chatMsg.Mentions = append(chatMsg.Mentions, userID.String())
+	}
+	if message.ReplyTo != (gocql.UUID{}) {
+		chatMsg.ReplyTo = message.ReplyTo.String()
+	}
+	publishChannelEvent(chatMsg)
+	return &chatMsg, nil
+}
+
+// loadChannelMessage vérifie que le salon appartient au serveur du membre et qu'il peut le voir,
+// puis charge le message. Retourne aussi les permissions du membre sur le salon.
+func loadChannelMessage(member *models.MemberPermissions, channelID, messageID gocql.UUID) (*models.MessageByChannel, *models.MemberPermissions, int, string) {
+	channel, permissions, status, msg := loadServerChannel(member, channelID)
+	if channel == nil {
+		return nil, nil, status, msg
+	}
+
+	message, err := dbTools.GetMessage(channelID, messageID)
+	if err != nil {
+		if err == gocql.ErrNotFound {
+			return nil, nil, fiber.StatusNotFound, "Message introuvable."
+		}
+		utils.Error("Lecture du message impossible", "channelId", channelID, "messageId", messageID, "err", err)
+		return nil, nil, fiber.StatusInternalServerError, "Erreur interne."
+	}
+	return message, permissions, 0, ""
+}
+
+// editChannelMessage modifie le contenu d'un message si l'appelant en est l'auteur
+// ou dispose de MANAGE_MESSAGES.
+// Retourne l'événement message_update à diffuser.
+func editChannelMessage(member *models.MemberPermissions, channelID, messageID gocql.UUID, content string) (*Message, int, string) {
+	content = strings.TrimSpace(content)
+	if len(content) > maxMessageLength {
+		return nil, fiber.StatusBadRequest, "Le contenu du message est invalide."
+	}
+
+	message, permissions, status, msg := loadChannelMessage(member, channelID, messageID)
+	if message == nil {
+		return nil, status, msg
+	}
+	// Un message sans pièce jointe ne peut pas être vidé de son texte.
+	if content == "" && len(message.Attachments) == 0 {
+		return nil, fiber.StatusBadRequest, "Le contenu du message est invalide."
+	}
+	if message.SenderID != member.UserID && !permissions.Has(models.PermManageMessages) {
+		return nil, fiber.StatusForbidden, "Permission manquante."
+	}
+
+	// Les mentions sont résolues à nouveau : les membres ajoutés sont notifiés, ceux retirés
+	// perdent leur mention.
+	previous := *message
+	message.Content = content
+	message.Mentions, message.MentionRoles, message.MentionEveryone = nil, nil, false
+	mentioned, err := resolveMentions(member, message)
+	if err != nil {
+		utils.Error("Résolution des mentions impossible", "messageId", messageID, "err", err)
+	}
+
+	editedAt := time.Now()
+	if err := dbTools.UpdateMessageContent(message, editedAt); err != nil {
+		utils.Error("Modification du message impossible", "messageId", messageID, "err", err)
+		return nil, fiber.StatusInternalServerError, "Erreur lors de la modification du message."
+	}
+	indexMessage(member.ServerID, message)
+
+	event := &Message{
+		Type:      "message_update",
+		ServerID:  member.ServerID.String(),
+		ChannelID: channelID.String(),
+		MessageID: messageID.String(),
+		UserID:    message.SenderID.String(),
+		Content:   content,
+		Timestamp: editedAt.UnixNano() / int64(time.Millisecond),
+	}
+	for _, userID := range message.Mentions {
+		event.Mentions = append(event.Mentions, userID.String())
+	}
+	withdrawMentions(member.ServerID, &previous, message, mentioned)
+	notification := *event
+	notification.Username, notification.Avatar = message.SenderUsername, message.SenderAvatar
+	notifyMentions(&notification, member.ServerID, message, mentioned)
+	return event, 0, ""
+}
+
+// deleteChannelMessage supprime un message (et ses pièces jointes dans MinIO) si l'appelant
+// en est l'auteur ou dispose de MANAGE_MESSAGES.
+// Retourne l'événement message_delete à diffuser.
+func deleteChannelMessage(member *models.MemberPermissions, channelID, messageID gocql.UUID) (*Message, int, string) {
+	message, permissions, status, msg := loadChannelMessage(member, channelID, messageID)
+	if message == nil {
+		return nil, status, msg
+	}
+	if message.SenderID != member.UserID && !permissions.Has(models.PermManageMessages) {
+		return nil, fiber.StatusForbidden, "Permission manquante."
+	}
+
+	unpinned, err := dbTools.DeleteMessage(channelID, messageID)
+	if err != nil {
+		utils.Error("Suppression du message impossible", "messageId", messageID, "err", err)
+		return nil, fiber.StatusInternalServerError, "Erreur lors de la suppression du message."
+	}
+	if len(message.Attachments) > 0 {
+		go utils.DeleteObjects(context.Background(), attachmentObjectKeys(message.Attachments))
+	}
+	unindexMessage(messageID)
+	if unpinned {
+		publishPinsUpdate(member.ServerID, channelID, messageID, member.UserID, "unpinned")
+	}
+
+	return &Message{
+		Type:      "message_delete",
+		ServerID:  member.ServerID.String(),
+		ChannelID: channelID.String(),
+		MessageID: messageID.String(),
+		UserID:    message.SenderID.String(),
+		Timestamp: time.Now().UnixNano() / int64(time.Millisecond),
+	}, 0, ""
+}
+
+// parseMessageParams récupère :id (salon) et :messageId depuis l'URL.
+func parseMessageParams(c *fiber.Ctx) (gocql.UUID, gocql.UUID, error) {
+	channelID, err := gocql.ParseUUID(c.Params("id"))
+	if err != nil {
+		return channelID, channelID, err
+	}
+	messageID, err := gocql.ParseUUID(c.Params("messageId"))
+	return channelID, messageID, err
+}
+
+// ----------------------
+// 📌 Envoyer un message avec pièces jointes (multipart : content, reply_to, nonce, files)
+// ----------------------
+func CreateChannelMessage(c *fiber.Ctx) error {
+	member := middlewares.GetMember(c)
+
+	channelID, err := gocql.ParseUUID(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID de salon invalide."})
+	}
+	channel, permissions, status, msg := loadServerChannel(member, channelID)
+	if channel == nil {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+	if !permissions.Has(models.PermSendMessages) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Permission manquante.", "permission": models.PermSendMessages})
+	}
+
+	content := strings.TrimSpace(c.FormValue("content"))
+	if len(content) > maxMessageLength {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Message trop long."})
+	}
+
+	var files []*multipart.FileHeader
+	if form, err := c.MultipartForm(); err == nil {
+		files = form.File["files"]
+	}
+	if content == "" && len(files) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Le message est vide."})
+	}
+	if len(files) > maxAttachmentsPerMessage {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": fmt.Sprintf("%d pièces jointes maximum par message.", maxAttachmentsPerMessage)})
+	}
+	if len(files) > 0 && !permissions.Has(models.PermAttachFiles) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Permission manquante.", "permission": models.PermAttachFiles})
+	}
+
+	replyTo, errMsg := resolveReplyTo(channelID, c.FormValue("reply_to"))
+	if errMsg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": errMsg})
+	}
+
+	authorID := uuid.UUID(member.UserID)
+	author, err := dbTools.GetUserByID(&authorID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur interne."})
+	}
+
+	attachments := make([]models.Attachment, 0, len(files))
+	for _, file := range files {
+		attachment, err := processAndUploadAttachment(channelID, file)
+		if err != nil {
+			utils.DeleteObjects(context.Background(), attachmentObjectKeys(attachments))
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+		}
+		attachments = append(attachments, *attachment)
+	}
+
+	message := &models.MessageByChannel{
+		ChannelID:      channelID,
+		SenderID:       member.UserID,
+		SenderUsername: author.Username,
+		SenderAvatar:   author.Avatar,
+		Content:        content,
+		ReplyTo:        replyTo,
+		Attachments:    attachments,
+	}
+	mentioned, err := resolveMentions(member, message)
+	if err != nil {
+		utils.Error("Résolution des mentions impossible", "err", err)
+	}
+
+	event, err := createChannelMessage(member.ServerID.String(), nil, message, c.FormValue("nonce"))
+	if err != nil {
+		utils.DeleteObjects(context.Background(), attachmentObjectKeys(attachments))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Le message n'a pas pu être enregistré."})
+	}
+	notifyMentions(event, member.ServerID, message, mentioned)
+	clearTyping(channelID.String(), member.UserID.String())
+
+	if channel.IsThread() {
+		touchThread(member.ServerID.String(), channelID)
+	}
+	return c.Status(fiber.StatusCreated).JSON(event)
+}
+
+// ----------------------
+// 📌 Modifier un message
+// ----------------------
+func UpdateChannelMessage(c *fiber.Ctx) error {
+	member := middlewares.GetMember(c)
+
+	channelID, messageID, err := parseMessageParams(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID invalide."})
+	}
+
+	var reqBody struct {
+		Content string `json:"content"`
+	}
+	if err := c.BodyParser(&reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Données invalides."})
+	}
+
+	event, status, msg := editChannelMessage(member, channelID, messageID, reqBody.Content)
+	if event == nil {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+
+	publishChannelEvent(*event)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Message modifié.", "data": event})
+}
+
+// ----------------------
+// 📌 Supprimer un message
+// ----------------------
+func DeleteChannelMessage(c *fiber.Ctx) error {
+	member := middlewares.GetMember(c)
+
+	channelID, messageID, err := parseMessageParams(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID invalide."})
+	}
+
+	event, status, msg := deleteChannelMessage(member, channelID, messageID)
+	if event == nil {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+
+	publishChannelEvent(*event)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Message supprimé."})
+}
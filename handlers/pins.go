@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"time"
+
+	middlewares "github.com/Romain-GUILLEMOT/WhispyrBack/middleware"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils/dbTools"
+	"github.com/gocql/gocql"
+	"github.com/gofiber/fiber/v2"
+)
+
+// PinResponse est un message épinglé : le message complet, suivi de l'auteur et de la date de l'épingle.
+type PinResponse struct {
+	MessageResponse
+	PinnedBy gocql.UUID `json:"pinned_by"`
+	PinnedAt time.Time  `json:"pinned_at"`
+}
+
+// publishPinsUpdate prévient les clients ouverts sur le salon que sa liste d'épingles a changé.
+func publishPinsUpdate(serverID, channelID, messageID, userID gocql.UUID, status string) {
+	publishChannelEvent(Message{
+		Type:      "channel_pins_update",
+		ServerID:  serverID.String(),
+		ChannelID: channelID.String(),
+		MessageID: messageID.String(),
+		UserID:    userID.String(),
+		Status:    status, // "pinned" ou "unpinned"
+		Timestamp: time.Now().UnixNano() / int64(time.Millisecond),
+	})
+}
+
+// ----------------------
+// 📌 Épingler un message
+// ----------------------
+func PinChannelMessage(c *fiber.Ctx) error {
+	member := middlewares.GetMember(c)
+
+	channelID, messageID, err := parseMessageParams(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID invalide."})
+	}
+	message, permissions, status, msg := loadChannelMessage(member, channelID, messageID)
+	if message == nil {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+	if !permissions.Has(models.PermManageMessages) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Permission manquante.", "permission": models.PermManageMessages})
+	}
+
+	pinned, err := dbTools.PinMessage(channelID, messageID, member.UserID)
+	if err != nil {
+		if err == dbTools.ErrTooManyPins {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Nombre maximal de messages épinglés atteint pour ce salon."})
+		}
+		utils.Error("Épinglage du message impossible", "messageId", messageID, "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de l'épinglage du message."})
+	}
+
+	if pinned {
+		publishPinsUpdate(member.ServerID, channelID, messageID, member.UserID, "pinned")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// ----------------------
+// 📌 Désépingler un message
+// ----------------------
+func UnpinChannelMessage(c *fiber.Ctx) error {
+	member := middlewares.GetMember(c)
+
+	channelID, messageID, err := parseMessageParams(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID invalide."})
+	}
+	channel, permissions, status, msg := loadServerChannel(member, channelID)
+	if channel == nil {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+	if !permissions.Has(models.PermManageMessages) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Permission manquante.", "permission": models.PermManageMessages})
+	}
+
+	unpinned, err := dbTools.UnpinMessage(channelID, messageID)
+	if err != nil {
+		utils.Error("Désépinglage du message impossible", "messageId", messageID, "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors du désépinglage du message."})
+	}
+
+	if unpinned {
+		publishPinsUpdate(member.ServerID, channelID, messageID, member.UserID, "unpinned")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// ----------------------
+// 📌 Lister les messages épinglés d'un salon
+// ----------------------
+func GetChannelPins(c *fiber.Ctx) error {
+	member := middlewares.GetMember(c)
+
+	channelID, err := gocql.ParseUUID(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID de salon invalide."})
+	}
+	if channel, _, status, msg := loadServerChannel(member, channelID); channel == nil {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+
+	pins, err := dbTools.GetPins(channelID)
+	if err != nil {
+		utils.Error("Lecture des épingles impossible", "channelId", channelID, "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de la lecture des messages épinglés."})
+	}
+
+	// Une épingle dont le message a disparu est ignorée, et retirée pour libérer sa place.
+	messages := make([]models.MessageByChannel, 0, len(pins))
+	kept := make([]models.Pin, 0, len(pins))
+	for _, pin := range pins {
+		message, err := dbTools.GetMessage(channelID, pin.MessageID)
+		if err == gocql.ErrNotFound {
+			if _, err := dbTools.UnpinMessage(channelID, pin.MessageID); err != nil {
+				utils.Warn("Retrait de l'épingle orpheline impossible pour le message " + pin.MessageID.String() + ": " + err.Error())
+			}
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		messages = append(messages, *message)
+		kept = append(kept, pin)
+	}
+
+	messageIDs := make([]gocql.UUID, 0, len(messages))
+	for _, m := range messages {
+		messageIDs = append(messageIDs, m.SentAt)
+	}
+	reactions, err := dbTools.GetReactions(channelID, messageIDs, member.UserID)
+	if err != nil {
+		return messagesReadError(c, err)
+	}
+	replies, err := buildReplyPreviews(channelID, messages)
+	if err != nil {
+		return messagesReadError(c, err)
+	}
+
+	results := make([]PinResponse, 0, len(messages))
+	for i, m := range messages {
+		response := toMessageResponse(m)
+		response.Reactions = reactions[m.SentAt]
+		response.ReplyTo = replies[m.ReplyTo]
+		results = append(results, PinResponse{
+			MessageResponse: response,
+			PinnedBy:        kept[i].PinnedBy,
+			PinnedAt:        kept[i].PinnedAt,
+		})
+	}
+	return c.JSON(fiber.Map{"data": results})
+}
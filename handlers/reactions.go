@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+
+	middlewares "github.com/Romain-GUILLEMOT/WhispyrBack/middleware"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils/dbTools"
+	"github.com/gocql/gocql"
+	"github.com/gofiber/fiber/v2"
+)
+
+const maxEmojiLength = 64
+
+// normalizeEmoji nettoie l'emoji reçu : emoji unicode ou nom d'emoji personnalisé, sans espace.
+func normalizeEmoji(emoji string) (string, bool) {
+	emoji = strings.TrimSpace(emoji)
+	if emoji == "" || len(emoji) > maxEmojiLength || strings.IndexFunc(emoji, unicode.IsSpace) >= 0 {
+		return "", false
+	}
+	return emoji, true
+}
+
+// reactToMessage ajoute ou retire la réaction de l'appelant sur un message.
+// Retourne l'événement reaction_add/reaction_remove à diffuser, ou nil si rien n'a changé
+// (réaction déjà présente ou déjà absente).
+func reactToMessage(member *models.MemberPermissions, channelID, messageID gocql.UUID, rawEmoji string, add bool) (*Message, int, string) {
+	emoji, ok := normalizeEmoji(rawEmoji)
+	if !ok {
+		return nil, fiber.StatusBadRequest, "Emoji invalide."
+	}
+	message, permissions, status, msg := loadChannelMessage(member, channelID, messageID)
+	if message == nil {
+		return nil, status, msg
+	}
+	if !permissions.Has(models.PermSendMessages) {
+		return nil, fiber.StatusForbidden, "Permission manquante."
+	}
+
+	eventType := "reaction_add"
+	var changed bool
+	var err error
+	if add {
+		changed, err = dbTools.AddReaction(channelID, messageID, member.UserID, emoji)
+	} else {
+		eventType = "reaction_remove"
+		changed, err = dbTools.RemoveReaction(channelID, messageID, member.UserID, emoji)
+	}
+	if err != nil {
+		if err == dbTools.ErrTooManyReactions {
+			return nil, fiber.StatusBadRequest, "Nombre maximal de réactions atteint pour ce message."
+		}
+		utils.Error("Mise à jour de la réaction impossible", "messageId", messageID, "err", err)
+		return nil, fiber.StatusInternalServerError, "Erreur lors de la mise à jour de la réaction."
+	}
+	if !changed {
+		return nil, 0, ""
+	}
+
+	return &Message{
+		Type:      eventType,
+		ServerID:  member.ServerID.String(),
+		ChannelID: channelID.String(),
+		MessageID: messageID.String(),
+		UserID:    member.UserID.String(),
+		Emoji:     emoji,
+		Timestamp: time.Now().UnixNano() / int64(time.Millisecond),
+	}, 0, ""
+}
+
+// ----------------------
+// 📌 Ajouter une réaction
+// ----------------------
+func AddMessageReaction(c *fiber.Ctx) error {
+	return handleReactionRequest(c, true)
+}
+
+// ----------------------
+// 📌 Retirer une réaction
+// ----------------------
+func RemoveMessageReaction(c *fiber.Ctx) error {
+	return handleReactionRequest(c, false)
+}
+
+func handleReactionRequest(c *fiber.Ctx, add bool) error {
+	member := middlewares.GetMember(c)
+
+	channelID, messageID, err := parseMessageParams(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID invalide."})
+	}
+	emoji, err := url.PathUnescape(c.Params("emoji"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Emoji invalide."})
+	}
+
+	event, status, msg := reactToMessage(member, channelID, messageID, emoji, add)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+
+	if event != nil {
+		publishChannelEvent(*event)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
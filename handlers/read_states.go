@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+
+	middlewares "github.com/Romain-GUILLEMOT/WhispyrBack/middleware"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils/dbTools"
+	"github.com/gocql/gocql"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// Tolérance sur l'horloge du client pour un ID de message "dans le futur".
+const ackClockSkew = time.Minute
+
+// ----------------------
+// 📌 Marquer un salon comme lu jusqu'à un message
+// ----------------------
+func AckChannelMessage(c *fiber.Ctx) error {
+	member := middlewares.GetMember(c)
+
+	channelID, err := gocql.ParseUUID(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID de salon invalide."})
+	}
+	channel, _, status, msg := loadServerChannel(member, channelID)
+	if channel == nil {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+
+	if status, msg := ackChannel(member.UserID, channel, c.Params("messageId")); status != 0 {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// ----------------------
+// 📌 Marquer un message privé comme lu jusqu'à un message
+// ----------------------
+func AckPrivateChannelMessage(c *fiber.Ctx) error {
+	rawUserID := c.Locals("user_id").(*uuid.UUID)
+	userID := gocql.UUID(*rawUserID)
+
+	channelID, err := gocql.ParseUUID(c.Params("channelId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID de salon invalide."})
+	}
+	channel, _, status, msg := loadPrivateChannel(channelID, userID)
+	if channel == nil {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+
+	if status, msg := ackChannel(userID, channel, c.Params("messageId")); status != 0 {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// handleMessageAck traite l'opération message_ack du socket. Le salon peut être un salon
+// de serveur (appartenance au serveur et visibilité vérifiées) ou un salon privé (appartenance au salon).
+func handleMessageAck(currentClient *Client, incomingMessage Message) error {
+	userID := gocql.UUID(currentClient.UserID)
+	channel, err := dbTools.GetChannelByID(incomingMessage.ChannelID)
+	if err == gocql.ErrNotFound {
+		return newGatewayError(gatewayNotFound, "Salon introuvable.")
+	}
+	if err != nil {
+		return fmt.Errorf("salon %s introuvable: %w", incomingMessage.ChannelID, err)
+	}
+
+	var isMember bool
+	if channel.IsPrivateMessage() {
+		isMember, err = dbTools.IsChannelMember(channel.ChannelID, userID)
+	} else {
+		isMember, err = canViewServerChannel(userID, channel)
+	}
+	if err != nil {
+		return err
+	}
+	if !isMember {
+		// Un salon invisible est signalé comme introuvable, comme sur les routes REST.
+		return newGatewayError(gatewayNotFound, "Salon introuvable.")
+	}
+
+	if status, msg := ackChannel(userID, channel, incomingMessage.MessageID); msg != "" {
+		return gatewayErrorFromStatus(status, msg)
+	}
+	return nil
+}
+
+// ackChannel avance l'état de lecture de userID sur un salon. Un acquittement plus ancien
+// que l'état courant est ignoré ; les autres connexions de l'utilisateur sont prévenues.
+func ackChannel(userID gocql.UUID, channel *models.Channel, rawMessageID string) (int, string) {
+	messageID, err := gocql.ParseUUID(rawMessageID)
+	if err != nil || messageID.Version() != 1 || messageID.Time().After(time.Now().Add(ackClockSkew)) {
+		return fiber.StatusBadRequest, "ID de message invalide."
+	}
+
+	state, err := dbTools.GetReadState(userID, channel.ChannelID)
+	if err != nil && err != gocql.ErrNotFound {
+		utils.Error("Lecture de l'état de lecture impossible", "err", err)
+		return fiber.StatusInternalServerError, "Erreur interne."
+	}
+	if state != nil && !state.IsUnread(messageID) {
+		if state.MentionCount == 0 {
+			return 0, ""
+		}
+		// On ne recule jamais : seules les mentions sont remises à zéro.
+		messageID = state.LastReadMessageID
+	}
+
+	if err := dbTools.AckChannel(userID, channel.ChannelID, channel.ServerID, messageID); err != nil {
+		utils.Error("Acquittement du salon impossible", "err", err)
+		return fiber.StatusInternalServerError, "Erreur lors de l'acquittement."
+	}
+
+	event := Message{
+		Type:         "message_ack",
+		ChannelID:    channel.ChannelID.String(),
+		MessageID:    messageID.String(),
+		UserID:       userID.String(),
+		Timestamp:    time.Now().UnixNano() / int64(time.Millisecond),
+		RecipientIDs: []string{userID.String()},
+	}
+	if channel.ServerID != (gocql.UUID{}) {
+		event.ServerID = channel.ServerID.String()
+	}
+	publishUserEvent(event)
+	return 0, ""
+}
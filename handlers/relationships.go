@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils/dbTools"
+	"github.com/goccy/go-json"
+	"github.com/gocql/gocql"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type relationshipResponse struct {
+	ID       gocql.UUID `json:"id"`
+	Username string     `json:"username"`
+	Avatar   string     `json:"avatar"`
+	Type     string     `json:"type"`
+	Since    time.Time  `json:"since"`
+}
+
+type friendRequestInput struct {
+	Username string `json:"username" validate:"required,min=3,max=32"`
+}
+
+// ----------------------
+// 📌 Lister ses relations (amis, demandes reçues/envoyées, bloqués)
+// ----------------------
+func GetRelationships(c *fiber.Ctx) error {
+	rawUserID := c.Locals("user_id").(*uuid.UUID)
+	userID := gocql.UUID(*rawUserID)
+
+	relationships, err := dbTools.GetRelationships(userID)
+	if err != nil {
+		utils.Error("Lecture des relations impossible", "userId", userID, "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de la récupération des relations."})
+	}
+
+	response := make([]relationshipResponse, 0, len(relationships))
+	for _, relationship := range relationships {
+		entry := relationshipResponse{ID: relationship.TargetID, Type: relationship.Type, Since: relationship.CreatedAt}
+		targetID := uuid.UUID(relationship.TargetID)
+		if user, err := dbTools.GetUserByID(&targetID); err == nil {
+			entry.Username, entry.Avatar = user.Username, user.Avatar
+		}
+		response = append(response, entry)
+	}
+	return c.JSON(response)
+}
+
+// ----------------------
+// 📌 Envoyer une demande d'ami par nom d'utilisateur
+// ----------------------
+func SendFriendRequest(c *fiber.Ctx) error {
+	rawUserID := c.Locals("user_id").(*uuid.UUID)
+	userID := gocql.UUID(*rawUserID)
+
+	var input friendRequestInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Données invalides."})
+	}
+	input.Username = strings.TrimSpace(input.Username)
+	if err := validate.Struct(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Champs invalides."})
+	}
+
+	target, err := dbTools.GetUserByUsername(input.Username)
+	if err != nil {
+		if err == gocql.ErrNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Utilisateur introuvable."})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur interne."})
+	}
+	if target.ID == userID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Vous ne pouvez pas vous ajouter vous-même."})
+	}
+
+	current, status, msg := getRelationshipType(userID, target.ID)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+	switch current {
+	case models.RelationshipFriend:
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Vous êtes déjà amis."})
+	case models.RelationshipOutgoing:
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Demande d'ami déjà envoyée."})
+	case models.RelationshipBlocked:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Débloquez cet utilisateur avant de l'ajouter."})
+	case models.RelationshipIncoming:
+		// Une demande croisée vaut acceptation.
+		return acceptFriendRequest(c, userID, target.ID)
+	}
+
+	// La cible qui nous a bloqués n'est pas révélée : même message qu'un refus générique.
+	if reverse, status, msg := getRelationshipType(target.ID, userID); status != 0 {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	} else if reverse == models.RelationshipBlocked {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Impossible d'envoyer une demande d'ami à cet utilisateur."})
+	}
+
+	if err := dbTools.SendFriendRequest(userID, target.ID); err != nil {
+		utils.Error("Envoi de la demande d'ami impossible", "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de l'envoi de la demande d'ami."})
+	}
+	publishRelationshipEvent(userID, target.ID, models.RelationshipOutgoing)
+	publishRelationshipEvent(target.ID, userID, models.RelationshipIncoming)
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"message": "Demande d'ami envoyée."})
+}
+
+// ----------------------
+// 📌 Accepter une demande d'ami reçue
+// ----------------------
+func AcceptFriendRequest(c *fiber.Ctx) error {
+	rawUserID := c.Locals("user_id").(*uuid.UUID)
+	userID := gocql.UUID(*rawUserID)
+
+	targetID, err := gocql.ParseUUID(c.Params("userId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID d'utilisateur invalide."})
+	}
+	current, status, msg := getRelationshipType(userID, targetID)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+	if current != models.RelationshipIncoming {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Aucune demande d'ami de cet utilisateur."})
+	}
+	return acceptFriendRequest(c, userID, targetID)
+}
+
+// ----------------------
+// 📌 Refuser une demande d'ami reçue
+// ----------------------
+func DeclineFriendRequest(c *fiber.Ctx) error {
+	rawUserID := c.Locals("user_id").(*uuid.UUID)
+	userID := gocql.UUID(*rawUserID)
+
+	targetID, err := gocql.ParseUUID(c.Params("userId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID d'utilisateur invalide."})
+	}
+	current, status, msg := getRelationshipType(userID, targetID)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+	if current != models.RelationshipIncoming {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Aucune demande d'ami de cet utilisateur."})
+	}
+
+	if err := dbTools.DeleteRelationship(userID, targetID); err != nil {
+		utils.Error("Refus de la demande d'ami impossible", "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors du refus de la demande."})
+	}
+	publishRelationshipEvent(userID, targetID, "")
+	publishRelationshipEvent(targetID, userID, "")
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Demande d'ami refusée."})
+}
+
+// ----------------------
+// 📌 Supprimer une relation : retirer un ami, annuler une demande envoyée ou débloquer
+// ----------------------
+func DeleteRelationship(c *fiber.Ctx) error {
+	rawUserID := c.Locals("user_id").(*uuid.UUID)
+	userID := gocql.UUID(*rawUserID)
+
+	targetID, err := gocql.ParseUUID(c.Params("userId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID d'utilisateur invalide."})
+	}
+	current, status, msg := getRelationshipType(userID, targetID)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+
+	switch current {
+	case models.RelationshipBlocked:
+		if err := dbTools.UnblockUser(userID, targetID); err != nil {
+			utils.Error("Déblocage impossible", "err", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors du déblocage."})
+		}
+		publishRelationshipEvent(userID, targetID, "")
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Utilisateur débloqué."})
+	case models.RelationshipFriend, models.RelationshipOutgoing:
+		if err := dbTools.DeleteRelationship(userID, targetID); err != nil {
+			utils.Error("Suppression de la relation impossible", "err", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de la suppression de la relation."})
+		}
+		publishRelationshipEvent(userID, targetID, "")
+		publishRelationshipEvent(targetID, userID, "")
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Relation supprimée."})
+	case models.RelationshipIncoming:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Utilisez le refus pour une demande reçue."})
+	default:
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Aucune relation avec cet utilisateur."})
+	}
+}
+
+// ----------------------
+// 📌 Bloquer un utilisateur (supprime l'amitié ou les demandes en cours)
+// ----------------------
+func BlockUser(c *fiber.Ctx) error {
+	rawUserID := c.Locals("user_id").(*uuid.UUID)
+	userID := gocql.UUID(*rawUserID)
+
+	targetID, err := gocql.ParseUUID(c.Params("userId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID d'utilisateur invalide."})
+	}
+	if targetID == userID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Vous ne pouvez pas vous bloquer vous-même."})
+	}
+	if status, msg := checkUsersExist([]gocql.UUID{targetID}); status != 0 {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+
+	current, status, msg := getRelationshipType(userID, targetID)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+	if current == models.RelationshipBlocked {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Utilisateur déjà bloqué."})
+	}
+	reverse, status, msg := getRelationshipType(targetID, userID)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+
+	if err := dbTools.BlockUser(userID, targetID, reverse == models.RelationshipBlocked); err != nil {
+		utils.Error("Blocage impossible", "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors du blocage."})
+	}
+	publishRelationshipEvent(userID, targetID, models.RelationshipBlocked)
+	if reverse != "" && reverse != models.RelationshipBlocked {
+		// La cible perd simplement l'amitié ou la demande, sans être informée du blocage.
+		publishRelationshipEvent(targetID, userID, "")
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Utilisateur bloqué."})
+}
+
+func acceptFriendRequest(c *fiber.Ctx, userID, targetID gocql.UUID) error {
+	if err := dbTools.AcceptFriendRequest(userID, targetID); err != nil {
+		utils.Error("Acceptation de la demande d'ami impossible", "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de l'acceptation de la demande."})
+	}
+	publishRelationshipEvent(userID, targetID, models.RelationshipFriend)
+	publishRelationshipEvent(targetID, userID, models.RelationshipFriend)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Demande d'ami acceptée."})
+}
+
+// getRelationshipType retourne le type de relation de userID envers targetID ("" si aucune).
+func getRelationshipType(userID, targetID gocql.UUID) (string, int, string) {
+	relationship, err := dbTools.GetRelationship(userID, targetID)
+	if err == gocql.ErrNotFound {
+		return "", 0, ""
+	}
+	if err != nil {
+		utils.Error("Lecture de la relation impossible", "err", err)
+		return "", fiber.StatusInternalServerError, "Erreur interne."
+	}
+	return relationship.Type, 0, ""
+}
+
+// publishRelationshipEvent informe userID (toutes ses connexions) que sa relation avec
+// targetID vaut désormais relationshipType ; une chaîne vide signale une suppression.
+func publishRelationshipEvent(userID, targetID gocql.UUID, relationshipType string) {
+	event := Message{
+		Type:         "relationship_update",
+		UserID:       targetID.String(),
+		Status:       relationshipType,
+		Timestamp:    time.Now().UnixNano() / int64(time.Millisecond),
+		RecipientIDs: []string{userID.String()},
+	}
+	if relationshipType == "" {
+		event.Type = "relationship_remove"
+	} else {
+		id := uuid.UUID(targetID)
+		if user, err := dbTools.GetUserByID(&id); err == nil {
+			event.Username, event.Avatar = user.Username, user.Avatar
+		}
+	}
+	publishUserEvent(event)
+}
+
+// presenceAudience retourne les utilisateurs autorisés à voir la présence de userID :
+// lui-même (ses autres connexions), ses amis et les membres des serveurs qu'il partage.
+func presenceAudience(userID gocql.UUID) []string {
+	audience := map[gocql.UUID]bool{userID: true}
+
+	friends, err := dbTools.GetFriendIDs(userID)
+	if err != nil {
+		utils.Warn("Présence: lecture des amis impossible pour " + userID.String() + ": " + err.Error())
+	}
+	for _, friendID := range friends {
+		audience[friendID] = true
+	}
+
+	serverIDs, err := dbTools.GetUserServerIDs(userID)
+	if err != nil {
+		utils.Warn("Présence: lecture des serveurs impossible pour " + userID.String() + ": " + err.Error())
+	}
+	for _, serverID := range serverIDs {
+		memberIDs, err := dbTools.GetServerMemberIDs(serverID)
+		if err != nil {
+			utils.Warn("Présence: lecture des membres impossible pour " + serverID.String() + ": " + err.Error())
+			continue
+		}
+		for _, memberID := range memberIDs {
+			audience[memberID] = true
+		}
+	}
+
+	recipients := make([]string, 0, len(audience))
+	for id := range audience {
+		recipients = append(recipients, id.String())
+	}
+	return recipients
+}
+
+// publishUserEvent publie un événement ciblé (RecipientIDs) sur user:presence:updates.
+func publishUserEvent(event Message) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		utils.Error("Erreur encodage JSON de l'événement utilisateur: " + err.Error())
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := utils.RedisPublish(ctx, "user:presence:updates", payload); err != nil {
+		utils.Error("Erreur publication événement utilisateur Redis: " + err.Error())
+	}
+}
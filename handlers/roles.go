@@ -0,0 +1,295 @@
+package handlers
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	middlewares "github.com/Romain-GUILLEMOT/WhispyrBack/middleware"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils/dbTools"
+	"github.com/go-playground/validator/v10"
+	"github.com/gocql/gocql"
+	"github.com/gofiber/fiber/v2"
+)
+
+var validate = validator.New()
+
+type roleInput struct {
+	Name        string    `json:"name"`
+	Color       *string   `json:"color" validate:"omitempty,hexcolor"`
+	Position    *int      `json:"position" validate:"omitempty,min=1"`
+	Permissions *[]string `json:"permissions"`
+}
+
+// roleParam récupère le nom du rôle depuis l'URL (ex: %40everyone).
+func roleParam(c *fiber.Ctx) string {
+	name, err := url.PathUnescape(c.Params("role"))
+	if err != nil {
+		return c.Params("role")
+	}
+	return name
+}
+
+// checkGrantablePermissions vérifie que les permissions existent et que l'appelant
+// les possède lui-même : on ne peut pas donner plus que ce que l'on a.
+func checkGrantablePermissions(member *models.MemberPermissions, permissions []string) string {
+	for _, p := range permissions {
+		if !models.IsValidPermission(p) {
+			return "Permission inconnue : " + p
+		}
+		if !member.Has(p) {
+			return "Vous ne pouvez pas accorder une permission que vous ne possédez pas : " + p
+		}
+	}
+	return ""
+}
+
+// ----------------------
+// 📌 Lister les rôles d'un serveur
+// ----------------------
+func GetServerRoles(c *fiber.Ctx) error {
+	member := middlewares.GetMember(c)
+
+	roles, err := dbTools.GetServerRoles(member.ServerID)
+	if err != nil {
+		utils.Error("Lecture des rôles impossible", "serverId", member.ServerID, "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de la lecture des rôles."})
+	}
+	return c.JSON(roles)
+}
+
+// ----------------------
+// 📌 Créer un rôle
+// ----------------------
+func CreateServerRole(c *fiber.Ctx) error {
+	member := middlewares.GetMember(c)
+
+	var input roleInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Données invalides."})
+	}
+	if err := validate.Struct(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Champs invalides."})
+	}
+
+	name := strings.TrimSpace(input.Name)
+	if name == "" || len(name) > 32 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Le nom du rôle doit faire entre 1 et 32 caractères."})
+	}
+	if models.IsReservedRole(name) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Ce nom de rôle est réservé."})
+	}
+
+	role := models.ServerRole{ServerID: member.ServerID, Role: name, Position: 1, Permissions: []string{}}
+	if input.Color != nil {
+		role.Color = *input.Color
+	}
+	if input.Position != nil {
+		role.Position = *input.Position
+	}
+	if input.Permissions != nil {
+		role.Permissions = *input.Permissions
+	}
+
+	if !member.Outranks(role.Position) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Vous ne pouvez pas créer un rôle égal ou supérieur au vôtre."})
+	}
+	if msg := checkGrantablePermissions(member, role.Permissions); msg != "" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": msg})
+	}
+
+	if _, err := dbTools.GetServerRole(member.ServerID, name); err == nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Un rôle porte déjà ce nom."})
+	} else if err != gocql.ErrNotFound {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur interne."})
+	}
+
+	if err := dbTools.SaveServerRole(role); err != nil {
+		utils.Error("Création du rôle impossible", "serverId", member.ServerID, "role", name, "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de la création du rôle."})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(role)
+}
+
+// ----------------------
+// 📌 Modifier un rôle (couleur, position, permissions)
+// ----------------------
+// Le nom étant la clé primaire du rôle, il n'est pas modifiable.
+func UpdateServerRole(c *fiber.Ctx) error {
+	member := middlewares.GetMember(c)
+	name := roleParam(c)
+
+	var input roleInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Données invalides."})
+	}
+	if err := validate.Struct(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Champs invalides."})
+	}
+
+	role, err := dbTools.GetServerRole(member.ServerID, name)
+	if err != nil {
+		if err == gocql.ErrNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Rôle introuvable."})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur interne."})
+	}
+	if !member.Outranks(role.Position) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Vous ne pouvez pas modifier un rôle égal ou supérieur au vôtre."})
+	}
+
+	if input.Color != nil {
+		role.Color = *input.Color
+	}
+	// @everyone reste toujours en bas de la hiérarchie.
+	if input.Position != nil && role.Role != models.RoleEveryone {
+		if !member.Outranks(*input.Position) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Vous ne pouvez pas placer un rôle au-dessus du vôtre."})
+		}
+		role.Position = *input.Position
+	}
+	if input.Permissions != nil {
+		// Le rôle "admin" garde ADMINISTRATOR : il remplace le propriétaire après un transfert.
+		if role.Role == models.RoleAdmin {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Les permissions de ce rôle ne sont pas modifiables."})
+		}
+		if msg := checkGrantablePermissions(member, *input.Permissions); msg != "" {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": msg})
+		}
+		role.Permissions = *input.Permissions
+	}
+
+	if err := dbTools.SaveServerRole(*role); err != nil {
+		utils.Error("Mise à jour du rôle impossible", "serverId", member.ServerID, "role", name, "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de la modification du rôle."})
+	}
+
+	publishPermissionsUpdate(member.ServerID, "")
+	return c.JSON(role)
+}
+
+// ----------------------
+// 📌 Supprimer un rôle
+// ----------------------
+func DeleteServerRole(c *fiber.Ctx) error {
+	member := middlewares.GetMember(c)
+	name := roleParam(c)
+
+	if models.IsReservedRole(name) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Ce rôle ne peut pas être supprimé."})
+	}
+
+	role, err := dbTools.GetServerRole(member.ServerID, name)
+	if err != nil {
+		if err == gocql.ErrNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Rôle introuvable."})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur interne."})
+	}
+	if !member.Outranks(role.Position) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Vous ne pouvez pas supprimer un rôle égal ou supérieur au vôtre."})
+	}
+
+	if err := dbTools.DeleteServerRole(member.ServerID, name); err != nil {
+		utils.Error("Suppression du rôle impossible", "serverId", member.ServerID, "role", name, "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de la suppression du rôle."})
+	}
+
+	publishPermissionsUpdate(member.ServerID, "")
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Rôle supprimé."})
+}
+
+// ----------------------
+// 📌 Attribuer un rôle à un membre
+// ----------------------
+func AssignServerRole(c *fiber.Ctx) error {
+	member := middlewares.GetMember(c)
+	name := roleParam(c)
+
+	if models.IsReservedRole(name) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Ce rôle ne peut pas être attribué."})
+	}
+
+	role, err := dbTools.GetServerRole(member.ServerID, name)
+	if err != nil {
+		if err == gocql.ErrNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Rôle introuvable."})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur interne."})
+	}
+	if !member.Outranks(role.Position) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Vous ne pouvez pas attribuer un rôle égal ou supérieur au vôtre."})
+	}
+
+	target, status, msg := resolveManageableMember(c, member)
+	if target == nil {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+
+	if err := dbTools.SetMemberRole(member.ServerID, target.UserID, role.Role); err != nil {
+		utils.Error("Attribution du rôle impossible", "serverId", member.ServerID, "role", name, "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de l'attribution du rôle."})
+	}
+
+	publishPermissionsUpdate(member.ServerID, target.UserID.String())
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Rôle attribué."})
+}
+
+// ----------------------
+// 📌 Retirer un rôle à un membre
+// ----------------------
+func UnassignServerRole(c *fiber.Ctx) error {
+	member := middlewares.GetMember(c)
+	name := roleParam(c)
+
+	target, status, msg := resolveManageableMember(c, member)
+	if target == nil {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+	if target.Role != name {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Ce membre n'a pas ce rôle."})
+	}
+
+	if err := dbTools.SetMemberRole(member.ServerID, target.UserID, models.RoleMember); err != nil {
+		utils.Error("Retrait du rôle impossible", "serverId", member.ServerID, "role", name, "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors du retrait du rôle."})
+	}
+
+	publishPermissionsUpdate(member.ServerID, target.UserID.String())
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Rôle retiré."})
+}
+
+// resolveManageableMember charge le membre ciblé par :userId et vérifie que
+// l'appelant est au-dessus de lui dans la hiérarchie.
+func resolveManageableMember(c *fiber.Ctx, member *models.MemberPermissions) (*models.MemberPermissions, int, string) {
+	targetID, err := gocql.ParseUUID(c.Params("userId"))
+	if err != nil {
+		return nil, fiber.StatusBadRequest, "ID d'utilisateur invalide."
+	}
+
+	target, err := dbTools.GetMemberPermissions(member.ServerID, targetID)
+	if err != nil {
+		if err == gocql.ErrNotFound {
+			return nil, fiber.StatusNotFound, "Membre introuvable."
+		}
+		return nil, fiber.StatusInternalServerError, "Erreur interne."
+	}
+	if target.IsOwner || (target.UserID != member.UserID && !member.Outranks(target.Position)) {
+		return nil, fiber.StatusForbidden, "Vous ne pouvez pas gérer un membre égal ou supérieur à vous."
+	}
+	return target, 0, ""
+}
+
+// publishPermissionsUpdate demande aux connexions actives sur le serveur de résoudre à nouveau
+// leurs permissions. userID restreint la mise à jour aux connexions d'un membre ("" pour toutes).
+func publishPermissionsUpdate(serverID gocql.UUID, userID string) {
+	publishServerEvent(Message{
+		Type:      "permissions_update",
+		ServerID:  serverID.String(),
+		UserID:    userID,
+		Timestamp: time.Now().UnixNano() / int64(time.Millisecond),
+	})
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"strings"
+	"time"
+
+	middlewares "github.com/Romain-GUILLEMOT/WhispyrBack/middleware"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils/dbTools"
+	"github.com/gocql/gocql"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultSearchLimit = 25
+	maxSearchLimit     = 50
+	maxSearchOffset    = 5000
+)
+
+// indexMessage ajoute un message de serveur à l'index de recherche, en arrière-plan.
+// Un message de thread est rattaché au salon parent pour le contrôle d'accès.
+func indexMessage(serverID gocql.UUID, message *models.MessageByChannel) {
+	document := models.SearchDocument{
+		ServerID:        serverID.String(),
+		ChannelID:       message.ChannelID.String(),
+		AccessChannelID: message.ChannelID.String(),
+		AuthorID:        message.SenderID.String(),
+		Content:         message.Content,
+		SentAt:          message.SentAt.Time(),
+		HasAttachment:   len(message.Attachments) > 0,
+	}
+	for _, userID := range message.Mentions {
+		document.Mentions = append(document.Mentions, userID.String())
+	}
+	messageID := message.SentAt.String()
+
+	go func() {
+		if channel, err := dbTools.GetChannelByID(document.ChannelID); err == nil && channel.IsThread() {
+			document.AccessChannelID = channel.ParentChannelID.String()
+		}
+		if err := utils.SearchIndexMessage(messageID, document); err != nil {
+			utils.Error("Indexation du message impossible", "messageId", messageID, "err", err)
+		}
+	}()
+}
+
+// unindexMessage retire un message supprimé de l'index de recherche.
+func unindexMessage(messageID gocql.UUID) {
+	go func() {
+		if err := utils.SearchDeleteMessage(messageID.String()); err != nil {
+			utils.Error("Désindexation du message impossible", "messageId", messageID, "err", err)
+		}
+	}()
+}
+
+// viewableChannelIDs retourne les salons du serveur dont le membre peut lire les messages.
+func viewableChannelIDs(member *models.MemberPermissions) ([]string, error) {
+	channels, err := dbTools.GetServerChannels(member.ServerID)
+	if err != nil {
+		return nil, err
+	}
+	visible, err := visibleChannels(member, channels)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(channels))
+	for _, channel := range channels {
+		if visible[channel.ChannelID] {
+			ids = append(ids, channel.ChannelID.String())
+		}
+	}
+	return ids, nil
+}
+
+// parseSearchDate accepte une date RFC 3339 ou au format AAAA-MM-JJ.
+func parseSearchDate(raw string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", raw)
+}
+
+// ----------------------
+// 📌 Rechercher des messages dans un serveur
+// (?q=, author_id=, channel_id=, after=, before=, has_attachment=, mentions=, limit=, offset=)
+// ----------------------
+func SearchServerMessages(c *fiber.Ctx) error {
+	member := middlewares.GetMember(c)
+
+	search := models.SearchQuery{
+		ServerID: member.ServerID.String(),
+		Text:     strings.TrimSpace(c.Query("q")),
+		Limit:    c.QueryInt("limit", defaultSearchLimit),
+		Offset:   c.QueryInt("offset", 0),
+	}
+	if search.Limit <= 0 || search.Limit > maxSearchLimit {
+		search.Limit = defaultSearchLimit
+	}
+	if search.Offset < 0 || search.Offset > maxSearchOffset {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Décalage invalide."})
+	}
+	if len(search.Text) > maxMessageLength {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Recherche trop longue."})
+	}
+
+	for param, target := range map[string]*string{"author_id": &search.AuthorID, "channel_id": &search.ChannelID, "mentions": &search.MentionsUserID} {
+		if raw := c.Query(param); raw != "" {
+			id, err := gocql.ParseUUID(raw)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Filtre " + param + " invalide."})
+			}
+			*target = id.String()
+		}
+	}
+	for param, target := range map[string]*time.Time{"after": &search.After, "before": &search.Before} {
+		if raw := c.Query(param); raw != "" {
+			date, err := parseSearchDate(raw)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Date " + param + " invalide."})
+			}
+			*target = date
+		}
+	}
+	if raw := c.Query("has_attachment"); raw != "" {
+		hasAttachment := raw == "true" || raw == "1"
+		search.HasAttachment = &hasAttachment
+	}
+
+	accessIDs, err := viewableChannelIDs(member)
+	if err != nil {
+		utils.Error("Lecture des salons visibles impossible", "serverId", member.ServerID, "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de la recherche."})
+	}
+	search.AccessChannelIDs = accessIDs
+
+	hits, total, err := utils.SearchMessages(search)
+	if err != nil {
+		utils.Error("Recherche impossible", "serverId", member.ServerID, "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de la recherche."})
+	}
+
+	// Les messages sont relus dans ScyllaDB : le contenu renvoyé reflète les modifications.
+	messages := make([]models.MessageByChannel, 0, len(hits))
+	for _, hit := range hits {
+		channelID, err := gocql.ParseUUID(hit.ChannelID)
+		if err != nil {
+			continue
+		}
+		messageID, err := gocql.ParseUUID(hit.MessageID)
+		if err != nil {
+			continue
+		}
+		message, err := dbTools.GetMessage(channelID, messageID)
+		if err != nil {
+			continue
+		}
+		messages = append(messages, *message)
+	}
+
+	// Réactions et réponses sont lues salon par salon, comme pour l'historique d'un salon.
+	byChannel := make(map[gocql.UUID][]models.MessageByChannel)
+	for _, m := range messages {
+		byChannel[m.ChannelID] = append(byChannel[m.ChannelID], m)
+	}
+	reactions := make(map[gocql.UUID][]models.ReactionCount, len(messages))
+	replies := make(map[gocql.UUID]*ReplyPreview)
+	for channelID, channelMessages := range byChannel {
+		messageIDs := make([]gocql.UUID, 0, len(channelMessages))
+		for _, m := range channelMessages {
+			messageIDs = append(messageIDs, m.SentAt)
+		}
+		channelReactions, err := dbTools.GetReactions(channelID, messageIDs, member.UserID)
+		if err != nil {
+			return messagesReadError(c, err)
+		}
+		for messageID, counts := range channelReactions {
+			reactions[messageID] = counts
+		}
+		channelReplies, err := buildReplyPreviews(channelID, channelMessages)
+		if err != nil {
+			return messagesReadError(c, err)
+		}
+		for messageID, preview := range channelReplies {
+			replies[messageID] = preview
+		}
+	}
+
+	results := make([]MessageResponse, 0, len(messages))
+	for _, m := range messages {
+		response := toMessageResponse(m)
+		response.Reactions = reactions[m.SentAt]
+		response.ReplyTo = replies[m.ReplyTo]
+		results = append(results, response)
+	}
+
+	return c.JSON(fiber.Map{
+		"data":  results,
+		"total": total,
+	})
+}
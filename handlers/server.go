@@ -9,7 +9,10 @@ import (
 
 	"github.com/Romain-GUILLEMOT/WhispyrBack/config"
 	"github.com/Romain-GUILLEMOT/WhispyrBack/db"
+	middlewares "github.com/Romain-GUILLEMOT/WhispyrBack/middleware"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
 	"github.com/Romain-GUILLEMOT/WhispyrBack/utils"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils/dbTools"
 	"github.com/gocql/gocql"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
@@ -78,11 +81,15 @@ func CreateServer(c *fiber.Ctx) error {
 
 	// Requête pour lier l'utilisateur au serveur
 	batch.Query(`INSERT INTO user_servers (user_id, server_id, role, joined_at, server_avatar) VALUES (?, ?, ?, ?, ?)`,
-		gocqlUserID, serverID, "owner", createdAt, avatarURL)
+		gocqlUserID, serverID, models.RoleOwner, createdAt, avatarURL)
 
 	// Requête pour ajouter l'utilisateur à la liste des membres du serveur
 	batch.Query(`INSERT INTO server_members (server_id, user_id, role, joined_at, username, avatar) VALUES (?, ?, ?, ?, ?, ?)`,
-		serverID, gocqlUserID, "owner", createdAt, username, userAvatar)
+		serverID, gocqlUserID, models.RoleOwner, createdAt, username, userAvatar)
+
+	// Requête pour créer le rôle @everyone appliqué à tous les membres
+	batch.Query(`INSERT INTO server_roles (server_id, role, permissions) VALUES (?, ?, ?)`,
+		serverID, models.RoleEveryone, models.DefaultEveryonePermissions)
 
 	// Requête pour créer la catégorie par défaut "Salons Textuels"
 	batch.Query(`INSERT INTO categories_by_server (server_id, category_id, name, position) VALUES (?, ?, ?, ?)`,
@@ -101,6 +108,7 @@ func CreateServer(c *fiber.Ctx) error {
 		utils.Error("Le batch de création de serveur a échoué", "err", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur critique lors de la création du serveur."})
 	}
+	invalidateMemberships(serverID, membershipJoined, gocqlUserID)
 
 	// 7. Réponse en cas de succès
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
@@ -130,31 +138,28 @@ func JoinServer(c *fiber.Ctx) error {
 	if count > 0 {
 		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Vous êtes déjà membre de ce serveur."})
 	}
+	if status, msg := checkNotBanned(serverID, userID); status != 0 {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
 
 	var serverAvatar string
-	if err := db.Session.Query(`SELECT avatar FROM servers WHERE server_id = ?`, serverID).Scan(&serverAvatar); err != nil {
+	var allowUUIDJoin bool
+	if err := db.Session.Query(`SELECT avatar, allow_uuid_join FROM servers WHERE server_id = ?`, serverID).Scan(&serverAvatar, &allowUUIDJoin); err != nil {
 		if err == gocql.ErrNotFound {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Ce serveur n'existe pas."})
 		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur de récupération du serveur."})
 	}
-
-	var username, userAvatar string
-	if err := db.Session.Query(`SELECT username, avatar FROM users WHERE id = ?`, userID).Scan(&username, &userAvatar); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Impossible de récupérer le profil."})
+	// Sans opt-in du serveur, il faut passer par une invitation.
+	if !allowUUIDJoin {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Ce serveur n'accepte que les invitations."})
 	}
 
-	joinedAt := time.Now()
-	batch := db.Session.NewBatch(gocql.LoggedBatch)
-	batch.Query(`INSERT INTO user_servers (user_id, server_id, role, joined_at, server_avatar) VALUES (?, ?, ?, ?, ?)`,
-		userID, serverID, "member", joinedAt, serverAvatar)
-	batch.Query(`INSERT INTO server_members (server_id, user_id, role, joined_at, username, avatar) VALUES (?, ?, ?, ?, ?, ?)`,
-		serverID, userID, "member", joinedAt, username, userAvatar)
-
-	if err := db.Session.ExecuteBatch(batch); err != nil {
+	if err := dbTools.AddServerMember(serverID, userID, serverAvatar, false); err != nil {
 		utils.Error("Server join batch failed", "err", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur pour rejoindre le serveur."})
 	}
+	invalidateMemberships(serverID, membershipJoined, userID)
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Serveur rejoint avec succès."})
 }
@@ -174,6 +179,9 @@ func GetUserServers(c *fiber.Ctx) error {
 		Role      string     `json:"role"`
 		JoinedAt  time.Time  `json:"joined_at"`
 		CreatedAt time.Time  `json:"created_at"`
+		// Badge de la sidebar : un salon au moins est non lu, et total des mentions
+		Unread       bool `json:"unread"`
+		MentionCount int  `json:"mention_count"`
 	}
 
 	type userServerData struct {
@@ -223,9 +231,47 @@ func GetUserServers(c *fiber.Ctx) error {
 		return c.Status(500).JSON(fiber.Map{"message": "Erreur #2."})
 	}
 
+	readStates, err := dbTools.GetReadStates(userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "Erreur #3."})
+	}
+	for i := range results {
+		unread, mentions, err := serverReadState(results[i].ServerID, readStates)
+		if err != nil {
+			utils.Warn("Calcul des non-lus impossible pour le serveur " + results[i].ServerID.String() + ": " + err.Error())
+			continue
+		}
+		results[i].Unread, results[i].MentionCount = unread, mentions
+	}
+
 	return c.JSON(results)
 }
 
+// serverReadState calcule le badge d'un serveur à partir de ses salons (les threads,
+// absents de channels_by_server, ne comptent pas).
+func serverReadState(serverID gocql.UUID, readStates map[gocql.UUID]*models.ReadState) (bool, int, error) {
+	channelIDs, err := dbTools.GetServerChannelIDs(serverID)
+	if err != nil {
+		return false, 0, err
+	}
+	lastMessages, err := dbTools.GetChannelLastMessages(serverID)
+	if err != nil {
+		return false, 0, err
+	}
+
+	unread, mentions := false, 0
+	for _, channelID := range channelIDs {
+		state := readStates[channelID]
+		if state != nil {
+			mentions += state.MentionCount
+		}
+		if state.IsUnread(lastMessages[channelID]) {
+			unread = true
+		}
+	}
+	return unread, mentions, nil
+}
+
 // ----------------------
 // 📌 Get infos détaillées d'un serveur
 // ----------------------
@@ -260,7 +306,7 @@ func GetServer(c *fiber.Ctx) error {
 }
 
 // ----------------------
-// 📌 Modifier un serveur (nom et/ou avatar)
+// 📌 Modifier un serveur (nom, avatar et/ou jointure par UUID)
 // ----------------------
 func UpdateServer(c *fiber.Ctx) error {
 	serverID, err := gocql.ParseUUID(c.Params("serverId"))
@@ -268,17 +314,11 @@ func UpdateServer(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID invalide."})
 	}
 
-	rawUserID := c.Locals("user_id").(*uuid.UUID)
-	userID := gocql.UUID(*rawUserID)
-
-	var ownerID gocql.UUID
+	// La permission MANAGE_SERVER est vérifiée par le middleware RequirePermission.
 	var oldAvatarURL string
-	if err := db.Session.Query(`SELECT owner_id, avatar FROM servers WHERE server_id = ?`, serverID).Scan(&ownerID, &oldAvatarURL); err != nil {
+	if err := db.Session.Query(`SELECT avatar FROM servers WHERE server_id = ?`, serverID).Scan(&oldAvatarURL); err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Serveur introuvable."})
 	}
-	if ownerID != userID {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Action non autorisée."})
-	}
 
 	newName := c.FormValue("name")
 	newAvatarURL, err := processAndUploadIcon(c, "icon", "server-icon-")
@@ -286,7 +326,9 @@ func UpdateServer(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": err.Error()})
 	}
 
-	if newName == "" && newAvatarURL == "" {
+	allowUUIDJoin := c.FormValue("allow_uuid_join")
+
+	if newName == "" && newAvatarURL == "" && allowUUIDJoin == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Aucune modification fournie."})
 	}
 
@@ -294,6 +336,9 @@ func UpdateServer(c *fiber.Ctx) error {
 	if newName != "" {
 		batch.Query(`UPDATE servers SET name = ? WHERE server_id = ?`, newName, serverID)
 	}
+	if allowUUIDJoin != "" {
+		batch.Query(`UPDATE servers SET allow_uuid_join = ? WHERE server_id = ?`, allowUUIDJoin == "true", serverID)
+	}
 	if newAvatarURL != "" {
 		batch.Query(`UPDATE servers SET avatar = ? WHERE server_id = ?`, newAvatarURL, serverID)
 	}
@@ -333,17 +378,15 @@ func DeleteServer(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID invalide."})
 	}
 
-	rawUserID := c.Locals("user_id").(*uuid.UUID)
-	userID := gocql.UUID(*rawUserID)
+	// Seul le propriétaire peut supprimer le serveur, quelles que soient ses permissions.
+	if member := middlewares.GetMember(c); member == nil || !member.IsOwner {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Action non autorisée."})
+	}
 
-	var ownerID gocql.UUID
 	var avatarURL string
-	if err := db.Session.Query(`SELECT owner_id, avatar FROM servers WHERE server_id = ?`, serverID).Scan(&ownerID, &avatarURL); err != nil {
+	if err := db.Session.Query(`SELECT avatar FROM servers WHERE server_id = ?`, serverID).Scan(&avatarURL); err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Serveur introuvable."})
 	}
-	if ownerID != userID {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Action non autorisée."})
-	}
 
 	var memberIDs []gocql.UUID
 	iter := db.Session.Query(`SELECT user_id FROM server_members WHERE server_id = ?`, serverID).Iter()
@@ -353,13 +396,32 @@ func DeleteServer(c *fiber.Ctx) error {
 	}
 	_ = iter.Close()
 
+	// Les codes d'invitation sont indexés par code : chacun doit être supprimé pour ne plus être résolu.
+	var inviteCodes []string
+	iter = db.Session.Query(`SELECT code FROM invites_by_server WHERE server_id = ?`, serverID).Iter()
+	var inviteCode string
+	for iter.Scan(&inviteCode) {
+		inviteCodes = append(inviteCodes, inviteCode)
+	}
+	if err := iter.Close(); err != nil {
+		utils.Error("Lecture des invitations impossible", "serverId", serverID, "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de la suppression."})
+	}
+
 	// ✅ Le batch est bien initialisé ici avant d'être utilisé
 	batch := db.Session.NewBatch(gocql.LoggedBatch)
 
 	batch.Query(`DELETE FROM servers WHERE server_id = ?`, serverID)
 	batch.Query(`DELETE FROM server_members WHERE server_id = ?`, serverID)
+	batch.Query(`DELETE FROM server_roles WHERE server_id = ?`, serverID)
 	batch.Query(`DELETE FROM categories_by_server WHERE server_id = ?`, serverID)
 	batch.Query(`DELETE FROM channels_by_server WHERE server_id = ?`, serverID)
+	batch.Query(`DELETE FROM channel_permission_overwrites WHERE server_id = ?`, serverID)
+	batch.Query(`DELETE FROM server_bans WHERE server_id = ?`, serverID)
+	batch.Query(`DELETE FROM invites_by_server WHERE server_id = ?`, serverID)
+	for _, code := range inviteCodes {
+		batch.Query(`DELETE FROM invites WHERE code = ?`, code)
+	}
 
 	for _, id := range memberIDs {
 		batch.Query(`DELETE FROM user_servers WHERE user_id = ? AND server_id = ?`, id, serverID)
@@ -369,6 +431,7 @@ func DeleteServer(c *fiber.Ctx) error {
 		utils.Error("Server deletion batch failed", "err", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de la suppression."})
 	}
+	invalidateMemberships(serverID, membershipLeft, memberIDs...)
 
 	if avatarURL != "" {
 		go utils.DeleteObject(avatarURL)
@@ -377,6 +440,63 @@ func DeleteServer(c *fiber.Ctx) error {
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Serveur supprimé avec succès."})
 }
 
+// ----------------------
+// 📌 Transférer la propriété d'un serveur
+// ----------------------
+func TransferServerOwnership(c *fiber.Ctx) error {
+	member := middlewares.GetMember(c)
+	if member == nil || !member.IsOwner {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Seul le propriétaire peut transférer le serveur."})
+	}
+
+	var reqBody struct {
+		UserID   string `json:"user_id" validate:"required,uuid"`
+		Password string `json:"password" validate:"required"`
+	}
+	if err := c.BodyParser(&reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Données invalides."})
+	}
+	if err := validate.Struct(reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Champs invalides."})
+	}
+	newOwnerID, _ := gocql.ParseUUID(reqBody.UserID)
+	if newOwnerID == member.UserID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Vous êtes déjà propriétaire de ce serveur."})
+	}
+
+	// Confirmation par le mot de passe du propriétaire actuel
+	var hashedPassword string
+	if err := db.Session.Query(`SELECT password FROM users WHERE id = ? LIMIT 1`, member.UserID).Scan(&hashedPassword); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Impossible de récupérer le profil."})
+	}
+	if !utils.CheckPasswordHash(reqBody.Password, hashedPassword) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Mot de passe incorrect."})
+	}
+
+	isMember, err := dbTools.IsServerMember(member.ServerID, newOwnerID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur interne."})
+	}
+	if !isMember {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Le nouveau propriétaire doit être membre du serveur."})
+	}
+
+	if err := dbTools.TransferOwnership(member.ServerID, member.UserID, newOwnerID); err != nil {
+		utils.Error("Server ownership transfer batch failed", "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors du transfert de propriété."})
+	}
+
+	publishServerEvent(Message{
+		Type:      "ownership_transfer",
+		ServerID:  member.ServerID.String(),
+		UserID:    newOwnerID.String(),
+		Content:   member.UserID.String(), // Ancien propriétaire
+		Timestamp: time.Now().UnixNano() / int64(time.Millisecond),
+	})
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Propriété du serveur transférée."})
+}
+
 // ----------------------
 // 헬 Helper pour l'upload d'image
 // ----------------------
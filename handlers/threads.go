@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	middlewares "github.com/Romain-GUILLEMOT/WhispyrBack/middleware"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils/dbTools"
+	"github.com/gocql/gocql"
+	"github.com/gofiber/fiber/v2"
+)
+
+// threadArchiveKey est l'ensemble trié Redis des threads actifs, avec pour score
+// l'échéance (timestamp Unix) de leur archivage automatique.
+const threadArchiveKey = "threads:archive_deadlines"
+
+const threadArchiverInterval = time.Minute
+
+type createThreadInput struct {
+	Name             string `json:"name" validate:"required,max=100"`
+	AutoArchiveAfter int    `json:"auto_archive_after" validate:"omitempty,oneof=3600 86400 259200 604800"` // En secondes
+}
+
+// ----------------------
+// 📌 Ouvrir un thread depuis un message
+// ----------------------
+func CreateThread(c *fiber.Ctx) error {
+	member := middlewares.GetMember(c)
+
+	channelID, messageID, err := parseMessageParams(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID invalide."})
+	}
+
+	var input createThreadInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Données invalides."})
+	}
+	input.Name = strings.TrimSpace(input.Name)
+	if err := validate.Struct(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Champs invalides."})
+	}
+	if input.AutoArchiveAfter == 0 {
+		input.AutoArchiveAfter = models.DefaultThreadAutoArchive
+	}
+
+	message, permissions, status, msg := loadChannelMessage(member, channelID, messageID)
+	if message == nil {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+	if !permissions.Has(models.PermSendMessages) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Permission manquante.", "permission": models.PermSendMessages})
+	}
+	channel, err := dbTools.GetChannelByID(channelID.String())
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Salon introuvable."})
+	}
+	if channel.IsThread() || channel.Type != "text" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Impossible d'ouvrir un thread dans ce salon."})
+	}
+
+	thread, err := dbTools.CreateThread(channel, messageID, member.UserID, input.Name, input.AutoArchiveAfter)
+	if err != nil {
+		if err == dbTools.ErrThreadExists {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Un thread existe déjà pour ce message."})
+		}
+		utils.Error("Création du thread impossible", "messageId", messageID, "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de la création du thread."})
+	}
+
+	scheduleThreadArchive(thread.ThreadID, input.AutoArchiveAfter)
+	publishChannelEvent(Message{
+		Type:        "thread_create",
+		ServerID:    member.ServerID.String(),
+		ChannelID:   channelID.String(),
+		MessageID:   messageID.String(),
+		ThreadID:    thread.ThreadID.String(),
+		ChannelName: thread.Name,
+		UserID:      member.UserID.String(),
+		Timestamp:   time.Now().UnixNano() / int64(time.Millisecond),
+	})
+
+	return c.Status(fiber.StatusCreated).JSON(thread)
+}
+
+// ----------------------
+// 📌 Lister les threads d'un salon (?archived=true pour les threads archivés)
+// ----------------------
+func GetChannelThreads(c *fiber.Ctx) error {
+	member := middlewares.GetMember(c)
+
+	channelID, err := gocql.ParseUUID(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID de salon invalide."})
+	}
+	if channel, _, status, msg := loadServerChannel(member, channelID); channel == nil {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+
+	threads, err := dbTools.GetChannelThreads(channelID, c.QueryBool("archived", false))
+	if err != nil {
+		utils.Error("Lecture des threads impossible", "channelId", channelID, "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de la lecture des threads."})
+	}
+	return c.JSON(threads)
+}
+
+// scheduleThreadArchive repousse l'échéance d'archivage automatique d'un thread.
+func scheduleThreadArchive(threadID gocql.UUID, autoArchiveAfter int) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	deadline := time.Now().Add(time.Duration(autoArchiveAfter) * time.Second).Unix()
+	if err := utils.RedisZAdd(ctx, threadArchiveKey, float64(deadline), threadID.String()); err != nil {
+		utils.Error("Erreur planification de l'archivage du thread " + threadID.String() + ": " + err.Error())
+	}
+}
+
+// unscheduleThreadArchives retire des threads supprimés de la planification d'archivage.
+func unscheduleThreadArchives(threadIDs []gocql.UUID) {
+	if len(threadIDs) == 0 {
+		return
+	}
+	members := make([]interface{}, len(threadIDs))
+	for i, threadID := range threadIDs {
+		members[i] = threadID.String()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := utils.RedisZRem(ctx, threadArchiveKey, members...); err != nil {
+		utils.Error("Erreur retrait de l'archivage des threads supprimés: " + err.Error())
+	}
+}
+
+// touchThread enregistre l'activité d'un thread lors d'un nouveau message :
+// un thread archivé est réactivé et son échéance d'archivage est repoussée.
+func touchThread(serverID string, threadID gocql.UUID) {
+	thread, err := dbTools.GetChannelByID(threadID.String())
+	if err != nil || !thread.IsThread() {
+		return
+	}
+
+	if thread.Archived {
+		if err := dbTools.SetThreadArchived(thread, false); err != nil {
+			utils.Error("Erreur désarchivage du thread " + threadID.String() + ": " + err.Error())
+			return
+		}
+		publishThreadUpdate(serverID, thread, "active")
+	}
+	if err := dbTools.TouchThread(threadID, time.Now()); err != nil {
+		utils.Error("Erreur mise à jour de l'activité du thread " + threadID.String() + ": " + err.Error())
+	}
+	scheduleThreadArchive(threadID, thread.AutoArchiveAfter)
+}
+
+// publishThreadUpdate notifie le salon parent et le thread d'un changement d'état (archived/active).
+func publishThreadUpdate(serverID string, thread *models.Channel, status string) {
+	event := Message{
+		Type:        "thread_update",
+		ServerID:    serverID,
+		ThreadID:    thread.ChannelID.String(),
+		ChannelName: thread.Name,
+		Status:      status,
+		Timestamp:   time.Now().UnixNano() / int64(time.Millisecond),
+	}
+	for _, channelID := range []gocql.UUID{thread.ParentChannelID, thread.ChannelID} {
+		event.ChannelID = channelID.String()
+		publishChannelEvent(event)
+	}
+}
+
+// StartThreadArchiver archive périodiquement les threads inactifs dont l'échéance est dépassée.
+func StartThreadArchiver() {
+	go func() {
+		ticker := time.NewTicker(threadArchiverInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			archiveExpiredThreads()
+		}
+	}()
+	utils.Info("Archivage automatique des threads démarré.")
+}
+
+func archiveExpiredThreads() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	expired, err := utils.RedisZRangeByMaxScore(ctx, threadArchiveKey, float64(time.Now().Unix()))
+	if err != nil {
+		utils.Error("Erreur lecture des threads à archiver: " + err.Error())
+		return
+	}
+
+	for _, id := range expired {
+		// ZREM sert de verrou : seule l'instance qui retire le thread l'archive.
+		removed, err := utils.RedisZRem(ctx, threadArchiveKey, id)
+		if err != nil || removed == 0 {
+			continue
+		}
+		thread, err := dbTools.GetChannelByID(id)
+		if err != nil || !thread.IsThread() || thread.Archived {
+			continue
+		}
+		if err := dbTools.SetThreadArchived(thread, true); err != nil {
+			utils.Error("Erreur archivage du thread " + id + ": " + err.Error())
+			continue
+		}
+		publishThreadUpdate(thread.ServerID.String(), thread, "archived")
+	}
+}
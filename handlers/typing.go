@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils"
+	"github.com/gocql/gocql"
+)
+
+const (
+	// Durée de vie d'un indicateur de saisie : sans nouveau typing_start, il disparaît seul.
+	typingTTL = 8 * time.Second
+	// Intervalle minimal entre deux typing_start d'une même connexion.
+	typingRateLimit = 3 * time.Second
+)
+
+// typingKey est l'ensemble trié des utilisateurs en train d'écrire dans un salon,
+// avec pour score l'échéance (en ms) de leur indicateur.
+func typingKey(channelID string) string {
+	return "typing:" + channelID
+}
+
+// handleTypingStart traite l'opération typing_start : l'indicateur est enregistré avec un
+// TTL dans Redis puis diffusé aux autres utilisateurs présents sur le salon actif.
+func handleTypingStart(currentClient *Client, incomingMessage Message) error {
+	hub.mu.RLock()
+	serverID, channelID := currentClient.CurrentServerID, currentClient.CurrentChannelID
+	member := currentClient.Permissions
+	hub.mu.RUnlock()
+	if channelID == "" || incomingMessage.ChannelID != channelID {
+		return fmt.Errorf("le client n'est pas dans le canal %s", incomingMessage.ChannelID)
+	}
+
+	now := time.Now()
+	if now.Sub(currentClient.LastTypingAt) < typingRateLimit {
+		return nil // Répétition trop rapprochée : l'indicateur en cours suffit.
+	}
+
+	// Comme pour handleChatMessage, les surcharges du salon ont pu changer depuis le join_channel.
+	parsedChannelID, err := gocql.ParseUUID(channelID)
+	if err != nil {
+		return fmt.Errorf("ID de salon invalide: %s", channelID)
+	}
+	channel, permissions, _, errMsg := loadServerChannel(member, parsedChannelID)
+	if channel == nil {
+		return fmt.Errorf("salon %s inaccessible: %s", channelID, errMsg)
+	}
+	if !permissions.Has(models.PermSendMessages) {
+		return fmt.Errorf("permission %s manquante sur le salon %s", models.PermSendMessages, channelID)
+	}
+	// Seul un typing_start valide consomme la fenêtre de limitation.
+	currentClient.LastTypingAt = now
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := utils.RedisZAddExpiring(ctx, typingKey(channelID), currentClient.UserID.String(), typingTTL); err != nil {
+		return fmt.Errorf("erreur enregistrement de la saisie: %w", err)
+	}
+
+	publishChannelEvent(Message{
+		Type:      "typing_start",
+		ServerID:  serverID,
+		ChannelID: channelID,
+		UserID:    currentClient.UserID.String(),
+		Username:  currentClient.Username,
+		Avatar:    currentClient.Avatar,
+		Timestamp: now.UnixNano() / int64(time.Millisecond),
+	})
+	return nil
+}
+
+// typingSnapshot retourne les utilisateurs dont l'indicateur de saisie est encore actif sur
+// un salon, hors excludeUserID.
+func typingSnapshot(channelID, excludeUserID string) []string {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	userIDs, err := utils.RedisZRangeByMinScore(ctx, typingKey(channelID), float64(time.Now().UnixMilli()))
+	if err != nil {
+		utils.Warn("Lecture des indicateurs de saisie impossible pour " + channelID + ": " + err.Error())
+		return nil
+	}
+
+	typing := make([]string, 0, len(userIDs))
+	for _, userID := range userIDs {
+		if userID != excludeUserID {
+			typing = append(typing, userID)
+		}
+	}
+	return typing
+}
+
+// clearTyping retire l'indicateur de saisie d'un utilisateur après l'envoi de son message.
+func clearTyping(channelID, userID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := utils.RedisZRem(ctx, typingKey(channelID), userID); err != nil {
+		utils.Warn("Suppression de l'indicateur de saisie impossible: " + err.Error())
+	}
+}
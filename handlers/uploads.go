@@ -0,0 +1,431 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Romain-GUILLEMOT/WhispyrBack/config"
+	middlewares "github.com/Romain-GUILLEMOT/WhispyrBack/middleware"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils/dbTools"
+	"github.com/goccy/go-json"
+	"github.com/gocql/gocql"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+)
+
+const (
+	maxDirectUploadSize = 100 * 1024 * 1024 // 100 MB : le fichier ne transite jamais par l'API
+	maxAvatarUploadSize = 5 * 1024 * 1024
+	uploadURLExpiry     = 15 * time.Minute
+	uploadSessionTTL    = time.Hour // Laisse le temps d'envoyer un gros fichier avant la finalisation
+	sniffLength         = 512       // Octets lus pour détecter le type réel (http.DetectContentType)
+
+	// uploadDeadlinesKey est l'ensemble trié Redis des objets non finalisés, avec pour score
+	// l'échéance (timestamp Unix) après laquelle ils sont supprimés de MinIO.
+	uploadDeadlinesKey    = "uploads:pending_deadlines"
+	uploadJanitorInterval = 5 * time.Minute
+)
+
+var avatarUploadTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/webp": true,
+	"image/gif":  true,
+}
+
+type createUploadInput struct {
+	Filename    string `json:"filename" validate:"required,max=255"`
+	ContentType string `json:"content_type" validate:"required,max=127"`
+	Size        int64  `json:"size" validate:"required,min=1"`
+}
+
+type finalizeUploadInput struct {
+	Content string `json:"content"`
+	ReplyTo string `json:"reply_to"`
+	Nonce   string `json:"nonce"`
+}
+
+func uploadSessionKey(id string) string {
+	return "upload:session:" + id
+}
+
+// ----------------------
+// 📌 Démarrer l'upload direct d'une pièce jointe
+// ----------------------
+func CreateAttachmentUpload(c *fiber.Ctx) error {
+	member := middlewares.GetMember(c)
+
+	channelID, err := gocql.ParseUUID(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID de salon invalide."})
+	}
+	channel, permissions, status, msg := loadServerChannel(member, channelID)
+	if channel == nil {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+	if !permissions.Has(models.PermSendMessages) || !permissions.Has(models.PermAttachFiles) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Permission manquante."})
+	}
+
+	input, status, msg := parseUploadInput(c, maxDirectUploadSize)
+	if input == nil {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+	if !attachmentTypeAllowed(input.ContentType) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Type de fichier non autorisé."})
+	}
+
+	session := &models.UploadSession{
+		ID:          gocql.TimeUUID(),
+		UserID:      member.UserID,
+		Purpose:     models.UploadPurposeAttachment,
+		ServerID:    member.ServerID,
+		ChannelID:   channelID,
+		Filename:    sanitizeFilename(input.Filename),
+		ContentType: input.ContentType,
+		Size:        input.Size,
+	}
+	session.ObjectKey = fmt.Sprintf("attachments/%s/%s/%s", channelID, session.ID, session.Filename)
+	return startUploadSession(c, session)
+}
+
+// ----------------------
+// 📌 Démarrer l'upload direct d'un avatar
+// ----------------------
+func CreateAvatarUpload(c *fiber.Ctx) error {
+	rawUserID := c.Locals("user_id").(*uuid.UUID)
+	userID := gocql.UUID(*rawUserID)
+
+	input, status, msg := parseUploadInput(c, maxAvatarUploadSize)
+	if input == nil {
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+	if !avatarUploadTypes[input.ContentType] {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "L'avatar doit être une image PNG, JPEG, WebP ou GIF."})
+	}
+
+	session := &models.UploadSession{
+		ID:          gocql.TimeUUID(),
+		UserID:      userID,
+		Purpose:     models.UploadPurposeAvatar,
+		Filename:    sanitizeFilename(input.Filename),
+		ContentType: input.ContentType,
+		Size:        input.Size,
+	}
+	session.ObjectKey = fmt.Sprintf("uploads/avatars/%s/%s", userID, session.ID)
+	return startUploadSession(c, session)
+}
+
+// ----------------------
+// 📌 Finaliser un upload direct : vérifie l'objet puis le rattache à un message ou à l'avatar
+// ----------------------
+func FinalizeUpload(c *fiber.Ctx) error {
+	rawUserID := c.Locals("user_id").(*uuid.UUID)
+	userID := gocql.UUID(*rawUserID)
+
+	var input finalizeUploadInput
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Données invalides."})
+		}
+	}
+	input.Content = strings.TrimSpace(input.Content)
+	if len(input.Content) > maxMessageLength {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Message trop long."})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// GETDEL réserve la session : une finalisation concurrente ne la trouvera plus.
+	raw, err := utils.RedisGetDel(ctx, uploadSessionKey(c.Params("uploadId")))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Session d'upload introuvable ou expirée."})
+	}
+	var session models.UploadSession
+	if err := json.Unmarshal([]byte(raw), &session); err != nil || session.UserID != userID {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Session d'upload introuvable ou expirée."})
+	}
+	if _, err := utils.RedisZRem(ctx, uploadDeadlinesKey, session.ObjectKey); err != nil {
+		utils.Warn("Erreur retrait de l'upload de la file de nettoyage: " + err.Error())
+	}
+
+	attachment, err := verifyUploadedObject(ctx, &session)
+	if err != nil {
+		go utils.DeleteObject(session.ObjectKey)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+	}
+
+	if session.Purpose == models.UploadPurposeAvatar {
+		return bindAvatarUpload(ctx, c, &session)
+	}
+	return bindAttachmentUpload(c, &session, attachment, input)
+}
+
+// parseUploadInput lit et valide la description du fichier à envoyer.
+func parseUploadInput(c *fiber.Ctx, maxSize int64) (*createUploadInput, int, string) {
+	var input createUploadInput
+	if err := c.BodyParser(&input); err != nil {
+		return nil, fiber.StatusBadRequest, "Données invalides."
+	}
+	input.ContentType = strings.ToLower(strings.TrimSpace(strings.Split(input.ContentType, ";")[0]))
+	if err := validate.Struct(input); err != nil {
+		return nil, fiber.StatusBadRequest, "Champs invalides."
+	}
+	if input.Size > maxSize {
+		return nil, fiber.StatusRequestEntityTooLarge, fmt.Sprintf("Le fichier dépasse la taille maximale de %d Mo.", maxSize/(1024*1024))
+	}
+	return &input, 0, ""
+}
+
+// startUploadSession enregistre la session dans Redis et retourne l'URL présignée au client.
+func startUploadSession(c *fiber.Ctx, session *models.UploadSession) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	uploadURL, headers, err := utils.PresignPutObject(ctx, session.ObjectKey, session.ContentType, session.Size, uploadURLExpiry)
+	if err != nil {
+		utils.Error("Presign MinIO impossible", "object", session.ObjectKey, "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de la préparation de l'upload."})
+	}
+	session.ExpiresAt = time.Now().Add(uploadURLExpiry)
+
+	payload, err := json.Marshal(session)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur interne."})
+	}
+	if err := utils.RedisSetWithTTL(ctx, uploadSessionKey(session.ID.String()), payload, uploadSessionTTL); err != nil {
+		utils.Error("Enregistrement de la session d'upload impossible", "err", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de la préparation de l'upload."})
+	}
+	// Si l'upload n'est jamais finalisé, le janitor supprimera l'objet à l'expiration de la session.
+	deadline := time.Now().Add(uploadSessionTTL).Unix()
+	if err := utils.RedisZAdd(ctx, uploadDeadlinesKey, float64(deadline), session.ObjectKey); err != nil {
+		utils.Warn("Erreur planification du nettoyage de l'upload: " + err.Error())
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"upload_id":  session.ID,
+		"url":        uploadURL.String(),
+		"method":     http.MethodPut,
+		"headers":    fiber.Map{"Content-Type": headers.Get("Content-Type"), "Content-Length": headers.Get("Content-Length")},
+		"expires_at": session.ExpiresAt,
+	})
+}
+
+// verifyUploadedObject contrôle l'objet envoyé par le client : présence (HEAD), taille annoncée
+// et type réel détecté à partir des premiers octets. Les dimensions des images sont lues
+// depuis leur en-tête, sans télécharger le fichier complet.
+func verifyUploadedObject(ctx context.Context, session *models.UploadSession) (*models.Attachment, error) {
+	info, err := utils.StatObject(ctx, session.ObjectKey)
+	if err != nil {
+		if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("aucun fichier n'a été envoyé pour cette session")
+		}
+		utils.Error("HEAD MinIO impossible", "object", session.ObjectKey, "err", err)
+		return nil, fmt.Errorf("vérification du fichier impossible")
+	}
+	if info.Size != session.Size {
+		return nil, fmt.Errorf("la taille du fichier ne correspond pas à celle annoncée")
+	}
+
+	head, err := utils.ReadObjectHead(ctx, session.ObjectKey, sniffLength)
+	if err != nil {
+		return nil, fmt.Errorf("vérification du fichier impossible")
+	}
+	if !sniffedTypeMatches(session.ContentType, strings.Split(http.DetectContentType(head), ";")[0]) {
+		return nil, fmt.Errorf("le contenu du fichier ne correspond pas au type %s", session.ContentType)
+	}
+
+	cfg := config.GetConfig()
+	attachment := &models.Attachment{
+		ID:          session.ID,
+		ObjectKey:   session.ObjectKey,
+		Filename:    session.Filename,
+		ContentType: session.ContentType,
+		Size:        info.Size,
+		URL:         fmt.Sprintf("%s/%s", cfg.MinioURL, session.ObjectKey),
+	}
+	if strings.HasPrefix(session.ContentType, "image/") {
+		if object, err := utils.GetObject(ctx, session.ObjectKey); err == nil {
+			if imgCfg, _, err := image.DecodeConfig(object); err == nil {
+				attachment.Width, attachment.Height = imgCfg.Width, imgCfg.Height
+			}
+			object.Close()
+		}
+	}
+	return attachment, nil
+}
+
+// sniffedTypeMatches compare le type annoncé au type détecté par http.DetectContentType.
+// Les images doivent correspondre exactement (elles sont affichées directement) ; pour les
+// autres fichiers, un type non reconnu est accepté mais jamais du HTML.
+func sniffedTypeMatches(declared, sniffed string) bool {
+	if declared == sniffed {
+		return true
+	}
+	if sniffed == "text/html" || sniffed == "text/xml" {
+		return false
+	}
+	if strings.HasPrefix(declared, "image/") {
+		return false
+	}
+	if sniffed == "application/octet-stream" {
+		return true
+	}
+	// DetectContentType ne distingue pas les formats texte (JSON, CSV, Markdown...).
+	return sniffed == "text/plain" && (strings.HasPrefix(declared, "text/") || declared == "application/json")
+}
+
+// bindAttachmentUpload crée le message portant la pièce jointe finalisée.
+func bindAttachmentUpload(c *fiber.Ctx, session *models.UploadSession, attachment *models.Attachment, input finalizeUploadInput) error {
+	// Les permissions ont pu changer depuis le début de l'upload.
+	member, err := dbTools.GetMemberPermissions(session.ServerID, session.UserID)
+	if err != nil {
+		go utils.DeleteObject(session.ObjectKey)
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Permission manquante."})
+	}
+
+	channel, permissions, status, msg := loadServerChannel(member, session.ChannelID)
+	if channel == nil {
+		go utils.DeleteObject(session.ObjectKey)
+		return c.Status(status).JSON(fiber.Map{"message": msg})
+	}
+	if !permissions.Has(models.PermSendMessages) || !permissions.Has(models.PermAttachFiles) {
+		go utils.DeleteObject(session.ObjectKey)
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Permission manquante."})
+	}
+
+	replyTo, errMsg := resolveReplyTo(session.ChannelID, input.ReplyTo)
+	if errMsg != "" {
+		go utils.DeleteObject(session.ObjectKey)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": errMsg})
+	}
+
+	authorID := uuid.UUID(session.UserID)
+	author, err := dbTools.GetUserByID(&authorID)
+	if err != nil {
+		go utils.DeleteObject(session.ObjectKey)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur interne."})
+	}
+
+	message := &models.MessageByChannel{
+		ChannelID:      session.ChannelID,
+		SenderID:       session.UserID,
+		SenderUsername: author.Username,
+		SenderAvatar:   author.Avatar,
+		Content:        input.Content,
+		ReplyTo:        replyTo,
+		Attachments:    []models.Attachment{*attachment},
+	}
+	mentioned, err := resolveMentions(member, message)
+	if err != nil {
+		utils.Error("Résolution des mentions impossible", "err", err)
+	}
+
+	event, err := createChannelMessage(session.ServerID.String(), nil, message, input.Nonce)
+	if err != nil {
+		go utils.DeleteObject(session.ObjectKey)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Le message n'a pas pu être enregistré."})
+	}
+	notifyMentions(event, session.ServerID, message, mentioned)
+
+	if channel.IsThread() {
+		touchThread(session.ServerID.String(), session.ChannelID)
+	}
+	return c.Status(fiber.StatusCreated).JSON(event)
+}
+
+// bindAvatarUpload convertit l'image envoyée au format de l'avatar (rond, WebP ou GIF)
+// puis remplace l'avatar de l'utilisateur. L'image brute est supprimée.
+func bindAvatarUpload(ctx context.Context, c *fiber.Ctx, session *models.UploadSession) error {
+	defer func() { go utils.DeleteObject(session.ObjectKey) }()
+
+	userID := uuid.UUID(session.UserID)
+	user, err := dbTools.GetUserByID(&userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur interne."})
+	}
+
+	object, err := utils.GetObject(ctx, session.ObjectKey)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Lecture de l'image impossible."})
+	}
+	defer object.Close()
+
+	// La taille est bornée par maxAvatarUploadSize : la conversion en mémoire reste raisonnable.
+	cfg := config.GetConfig()
+	var converted *bytes.Buffer
+	contentType, extension := "image/webp", ".webp"
+	if session.ContentType == "image/gif" {
+		converted, err = utils.ConvertToRoundedGIF(object)
+		contentType, extension = "image/gif", ".gif"
+	} else {
+		converted, err = utils.ConvertToRoundedWebP(object, session.ContentType)
+	}
+	if err != nil {
+		utils.Error("Avatar conversion failed", "err", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Erreur de traitement de l'image."})
+	}
+
+	randStr, _ := utils.RandomString64()
+	fileName := randStr + extension
+	if _, err := utils.MinioClient.PutObject(ctx, cfg.MinioBucket, fileName, converted, int64(converted.Len()), minio.PutObjectOptions{
+		ContentType: contentType,
+	}); err != nil {
+		utils.Error("MinIO avatar upload failed", "err", err, "fileName", fileName)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur d'upload de l'avatar."})
+	}
+	avatarURL := fmt.Sprintf("%s/%s", cfg.MinioURL, fileName)
+
+	if err := dbTools.UpdateUserAvatar(session.UserID, user, avatarURL); err != nil {
+		utils.Error("Avatar update failed", "err", err)
+		go utils.DeleteObject(fileName)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur lors de la mise à jour de l'avatar."})
+	}
+	if oldKey := utils.ObjectKeyFromURL(user.Avatar); oldKey != "" {
+		go utils.DeleteObject(oldKey)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Avatar mis à jour.", "avatar": avatarURL})
+}
+
+// StartUploadJanitor supprime périodiquement de MinIO les objets dont l'upload n'a jamais été finalisé.
+func StartUploadJanitor() {
+	go func() {
+		ticker := time.NewTicker(uploadJanitorInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			removeAbandonedUploads()
+		}
+	}()
+	utils.Info("Nettoyage des uploads abandonnés démarré.")
+}
+
+func removeAbandonedUploads() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	expired, err := utils.RedisZRangeByMaxScore(ctx, uploadDeadlinesKey, float64(time.Now().Unix()))
+	if err != nil {
+		utils.Error("Erreur lecture des uploads abandonnés: " + err.Error())
+		return
+	}
+
+	var objectKeys []string
+	for _, key := range expired {
+		// ZREM sert de verrou : seule l'instance qui retire l'entrée supprime l'objet.
+		if removed, err := utils.RedisZRem(ctx, uploadDeadlinesKey, key); err == nil && removed > 0 {
+			objectKeys = append(objectKeys, key)
+		}
+	}
+	utils.DeleteObjects(ctx, objectKeys)
+}
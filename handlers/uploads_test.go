@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSniffedTypeMatches(t *testing.T) {
+	tests := []struct {
+		name     string
+		declared string
+		sniffed  string
+		want     bool
+	}{
+		{name: "image identique", declared: "image/png", sniffed: "image/png", want: true},
+		{name: "image d'un autre format", declared: "image/png", sniffed: "image/jpeg", want: false},
+		{name: "image non reconnue", declared: "image/png", sniffed: "application/octet-stream", want: false},
+		{name: "image en texte", declared: "image/svg+xml", sniffed: "text/plain", want: false},
+		{name: "pdf identique", declared: "application/pdf", sniffed: "application/pdf", want: true},
+		{name: "archive non reconnue", declared: "application/x-7z-compressed", sniffed: "application/octet-stream", want: true},
+		{name: "html déguisé en pdf", declared: "application/pdf", sniffed: "text/html", want: false},
+		{name: "json en texte", declared: "application/json", sniffed: "text/plain", want: true},
+		{name: "csv en texte", declared: "text/csv", sniffed: "text/plain", want: true},
+		{name: "xml déguisé en texte", declared: "text/plain", sniffed: "text/xml", want: false},
+		{name: "texte déguisé en zip", declared: "application/zip", sniffed: "text/plain", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sniffedTypeMatches(tt.declared, tt.sniffed); got != tt.want {
+				t.Errorf("sniffedTypeMatches(%q, %q) = %v, attendu %v", tt.declared, tt.sniffed, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSniffedTypeMatchesDetectContentType(t *testing.T) {
+	// Comme verifyUploadedObject, le type détecté est comparé sans ses paramètres (charset).
+	sniff := func(content string) string {
+		return strings.Split(http.DetectContentType([]byte(content)), ";")[0]
+	}
+	html := sniff("<!DOCTYPE html><html><script>alert(1)</script></html>")
+	if sniffedTypeMatches("text/plain", html) {
+		t.Errorf("un document HTML (%s) est accepté comme text/plain", html)
+	}
+	png := sniff("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	if !sniffedTypeMatches("image/png", png) {
+		t.Errorf("une image PNG (%s) est refusée", png)
+	}
+}
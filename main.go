@@ -40,9 +40,13 @@ func main() {
 	db.ConnectDB()
 	db.ApplyMigrations(db.Session)
 	utils.MinioInit()
+	utils.SearchInit()
 	utils.InitRedis()
 	utils.InitMailer()
 	handlers.StartBroadcaster()
+	handlers.StartHeartbeatReaper()
+	handlers.StartThreadArchiver()
+	handlers.StartUploadJanitor()
 
 	api.SetupRoutes(app)
 
@@ -0,0 +1,55 @@
+package middlewares
+
+import (
+	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils/dbTools"
+	"github.com/gocql/gocql"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// RequirePermission résout le rôle de l'appelant sur le serveur :serverId et
+// vérifie qu'il possède toutes les permissions demandées.
+// Doit être placé après RequireAuth. Les permissions résolues sont exposées
+// aux handlers via c.Locals("member").
+func RequirePermission(permissions ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		serverID, err := gocql.ParseUUID(c.Params("serverId"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID de serveur invalide."})
+		}
+
+		rawUserID, ok := c.Locals("user_id").(*uuid.UUID)
+		if !ok || rawUserID == nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Non authentifié."})
+		}
+
+		member, err := dbTools.GetMemberPermissions(serverID, gocql.UUID(*rawUserID))
+		if err != nil {
+			if err == gocql.ErrNotFound {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Vous n'êtes pas membre de ce serveur."})
+			}
+			utils.Error("Résolution des permissions impossible", "serverId", serverID, "err", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Erreur interne."})
+		}
+
+		for _, permission := range permissions {
+			if !member.Has(permission) {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"message":    "Permission manquante.",
+					"permission": permission,
+				})
+			}
+		}
+
+		c.Locals("member", member)
+		return c.Next()
+	}
+}
+
+// GetMember récupère les permissions résolues par RequirePermission.
+func GetMember(c *fiber.Ctx) *models.MemberPermissions {
+	member, _ := c.Locals("member").(*models.MemberPermissions)
+	return member
+}
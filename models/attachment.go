@@ -0,0 +1,16 @@
+package models
+
+import "github.com/gocql/gocql"
+
+// Attachment est une pièce jointe stockée dans MinIO. Elle correspond au type
+// CQL "attachment" de la colonne messages_by_channel.attachments.
+type Attachment struct {
+	ID          gocql.UUID `cql:"id" json:"id"`
+	ObjectKey   string     `cql:"object_key" json:"-"`
+	Filename    string     `cql:"filename" json:"filename"`
+	ContentType string     `cql:"content_type" json:"content_type"`
+	Size        int64      `cql:"size" json:"size"`
+	Width       int        `cql:"width" json:"width,omitempty"` // Images uniquement
+	Height      int        `cql:"height" json:"height,omitempty"`
+	URL         string     `cql:"url" json:"url"`
+}
@@ -10,10 +10,38 @@ type Channel struct {
 	ServerID   gocql.UUID `json:"server_id"`
 	CategoryID gocql.UUID `json:"category_id"`
 	Name       string     `json:"name" validate:"required"`
-	Type       string     `json:"type" validate:"required,oneof=text voice dm"`
+	Type       string     `json:"type" validate:"required,oneof=text voice dm group_dm"`
 	IsPrivate  bool       `json:"is_private"`
 	Position   int        `json:"position"`
 	CreatedAt  time.Time  `json:"created_at"`
+	// Champs propres aux threads (vides pour un salon classique)
+	ParentChannelID  gocql.UUID `json:"parent_channel_id,omitempty"`
+	ParentMessageID  gocql.UUID `json:"parent_message_id,omitempty"`
+	Archived         bool       `json:"archived,omitempty"`
+	AutoArchiveAfter int        `json:"auto_archive_after,omitempty"` // En secondes
+	LastActivityAt   time.Time  `json:"last_activity_at,omitempty"`
+	// Champs propres aux messages privés
+	OwnerID       gocql.UUID `json:"owner_id,omitempty"` // Créateur d'un groupe
+	LastMessageID gocql.UUID `json:"last_message_id,omitempty"`
+}
+
+// Types de salons privés (hors serveur).
+const (
+	ChannelTypeDM      = "dm"       // Conversation 1:1
+	ChannelTypeGroupDM = "group_dm" // Groupe privé (10 membres maximum)
+)
+
+// MaxGroupDMMembers est le nombre maximal de membres d'un groupe privé.
+const MaxGroupDMMembers = 10
+
+// IsPrivateMessage indique si le salon est une conversation privée hors serveur.
+func (c *Channel) IsPrivateMessage() bool {
+	return c.Type == ChannelTypeDM || c.Type == ChannelTypeGroupDM
+}
+
+// IsThread indique si le salon est un fil de discussion rattaché à un autre salon.
+func (c *Channel) IsThread() bool {
+	return c.ParentChannelID != gocql.UUID{}
 }
 
 type ChannelByServer struct {
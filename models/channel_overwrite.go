@@ -0,0 +1,38 @@
+package models
+
+import "github.com/gocql/gocql"
+
+// Cibles d'une surcharge de permissions de salon.
+const (
+	OverwriteRole   = "role"   // Target est le nom du rôle (@everyone inclus)
+	OverwriteMember = "member" // Target est l'ID du membre
+)
+
+// OverwritablePermissions liste les permissions qu'une surcharge de salon peut autoriser ou refuser.
+var OverwritablePermissions = []string{
+	PermViewChannel,
+	PermSendMessages,
+	PermManageMessages,
+	PermManageChannels,
+	PermAttachFiles,
+}
+
+// PermissionOverwrite autorise ou refuse des permissions à un rôle ou à un membre sur un salon.
+type PermissionOverwrite struct {
+	ServerID   gocql.UUID `json:"server_id"`
+	ChannelID  gocql.UUID `json:"channel_id"`
+	TargetType string     `json:"target_type" validate:"required,oneof=role member"`
+	Target     string     `json:"target" validate:"required"`
+	Allow      []string   `json:"allow"`
+	Deny       []string   `json:"deny"`
+}
+
+// IsOverwritablePermission vérifie qu'une permission fait partie de OverwritablePermissions.
+func IsOverwritablePermission(permission string) bool {
+	for _, p := range OverwritablePermissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"github.com/gocql/gocql"
+	"time"
+)
+
+type Invite struct {
+	Code      string     `json:"code" validate:"required"`
+	ServerID  gocql.UUID `json:"server_id" validate:"required"`
+	InviterID gocql.UUID `json:"inviter_id" validate:"required"`
+	MaxUses   int        `json:"max_uses" validate:"min=0"`
+	Uses      int        `json:"uses"`
+	ExpiresAt time.Time  `json:"expires_at,omitempty"`
+	Temporary bool       `json:"temporary"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// IsExpired indique si l'invitation a dépassé sa date d'expiration ou son nombre d'utilisations.
+func (i *Invite) IsExpired() bool {
+	if !i.ExpiresAt.IsZero() && time.Now().After(i.ExpiresAt) {
+		return true
+	}
+	return i.MaxUses > 0 && i.Uses >= i.MaxUses
+}
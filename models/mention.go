@@ -0,0 +1,11 @@
+package models
+
+import "github.com/gocql/gocql"
+
+// MentionByUser est une entrée de la boîte de réception des mentions d'un utilisateur.
+type MentionByUser struct {
+	UserID    gocql.UUID `json:"user_id" validate:"required"`
+	MessageID gocql.UUID `json:"message_id" validate:"required"`
+	ChannelID gocql.UUID `json:"channel_id" validate:"required"`
+	ServerID  gocql.UUID `json:"server_id" validate:"required"`
+}
@@ -6,9 +6,24 @@ import (
 )
 
 type MessageByChannel struct {
-	ChannelID gocql.UUID `json:"channel_id" validate:"required"`
-	DayBucket time.Time  `json:"day_bucket" validate:"required"` // YYYY-MM-DD
-	SentAt    gocql.UUID `json:"sent_at" validate:"required"`
-	SenderID  gocql.UUID `json:"sender_id" validate:"required"`
-	Content   string     `json:"content" validate:"required"`
+	ChannelID      gocql.UUID   `json:"channel_id" validate:"required"`
+	DayBucket      time.Time    `json:"day_bucket" validate:"required"` // YYYY-MM-DD
+	SentAt         gocql.UUID   `json:"sent_at" validate:"required"`
+	SenderID       gocql.UUID   `json:"sender_id" validate:"required"`
+	Content        string       `json:"content" validate:"required"`
+	SenderUsername string       `json:"sender_username"`
+	SenderAvatar   string       `json:"sender_avatar"`
+	EditedAt       time.Time    `json:"edited_at,omitempty"`
+	ReplyTo        gocql.UUID   `json:"reply_to,omitempty"`  // Message auquel celui-ci répond
+	ThreadID       gocql.UUID   `json:"thread_id,omitempty"` // Thread ouvert depuis ce message
+	Attachments    []Attachment `json:"attachments,omitempty"`
+	// Mentions résolues à l'envoi et à chaque modification : utilisateurs (<@id>), rôles (<@&nom>) et @everyone/@here
+	Mentions        []gocql.UUID `json:"mentions,omitempty"`
+	MentionRoles    []string     `json:"mention_roles,omitempty"`
+	MentionEveryone bool         `json:"mention_everyone,omitempty"`
+}
+
+// DayBucketOf retourne le bucket journalier (partition) d'un message à partir de son TimeUUID.
+func DayBucketOf(messageID gocql.UUID) string {
+	return messageID.Time().UTC().Format("2006-01-02")
 }
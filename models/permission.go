@@ -0,0 +1,139 @@
+package models
+
+import "github.com/gocql/gocql"
+
+// Permissions nommées stockées dans server_roles.permissions.
+const (
+	PermAdministrator   = "ADMINISTRATOR" // Donne toutes les permissions
+	PermManageServer    = "MANAGE_SERVER"
+	PermManageRoles     = "MANAGE_ROLES"
+	PermManageChannels  = "MANAGE_CHANNELS"
+	PermKickMembers     = "KICK_MEMBERS"
+	PermBanMembers      = "BAN_MEMBERS"
+	PermCreateInvite    = "CREATE_INVITE"
+	PermManageMessages  = "MANAGE_MESSAGES"
+	PermSendMessages    = "SEND_MESSAGES"
+	PermAttachFiles     = "ATTACH_FILES"
+	PermMentionEveryone = "MENTION_EVERYONE" // Autorise @everyone et @here à notifier les membres
+	// Lecture d'un salon : implicite au niveau du serveur, elle n'apparaît que dans les
+	// surcharges de salon. Un salon privé la retire à tous les membres non autorisés.
+	PermViewChannel = "VIEW_CHANNEL"
+)
+
+// Rôles réservés présents dans server_members.role.
+const (
+	RoleOwner    = "owner"
+	RoleMember   = "member"
+	RoleEveryone = "@everyone" // Rôle de base appliqué à tous les membres
+	RoleAdmin    = "admin"     // Rôle attribué à l'ancien propriétaire après un transfert
+)
+
+// AllPermissions liste les permissions reconnues par le serveur.
+var AllPermissions = []string{
+	PermAdministrator,
+	PermManageServer,
+	PermManageRoles,
+	PermManageChannels,
+	PermKickMembers,
+	PermBanMembers,
+	PermCreateInvite,
+	PermManageMessages,
+	PermSendMessages,
+	PermAttachFiles,
+	PermMentionEveryone,
+}
+
+// DefaultEveryonePermissions est le jeu de permissions du rôle @everyone à la création d'un serveur.
+var DefaultEveryonePermissions = []string{
+	PermCreateInvite,
+	PermSendMessages,
+	PermAttachFiles,
+}
+
+// MemberPermissions est le résultat de la résolution des permissions d'un membre sur un serveur.
+type MemberPermissions struct {
+	ServerID    gocql.UUID      `json:"server_id"`
+	UserID      gocql.UUID      `json:"user_id"`
+	Role        string          `json:"role"`
+	IsOwner     bool            `json:"is_owner"`
+	Position    int             `json:"position"` // Position du rôle du membre dans la hiérarchie
+	Permissions map[string]bool `json:"permissions"`
+}
+
+// Has indique si le membre dispose de la permission demandée.
+// Le propriétaire et les administrateurs ont toutes les permissions.
+func (m *MemberPermissions) Has(permission string) bool {
+	if m == nil {
+		return false
+	}
+	if m.IsOwner || m.Permissions[PermAdministrator] {
+		return true
+	}
+	return m.Permissions[permission]
+}
+
+// ForChannel applique les surcharges d'un salon aux permissions du membre, dans l'ordre
+// @everyone, rôle du membre puis membre (refus avant autorisations à chaque étape).
+// Le propriétaire et les administrateurs ne sont pas concernés. Sans VIEW_CHANNEL, le
+// membre n'a aucune permission sur le salon.
+func (m *MemberPermissions) ForChannel(isPrivate bool, overwrites []PermissionOverwrite) *MemberPermissions {
+	if m == nil || m.IsOwner || m.Permissions[PermAdministrator] {
+		return m
+	}
+
+	resolved := *m
+	resolved.Permissions = make(map[string]bool, len(m.Permissions)+1)
+	for permission, granted := range m.Permissions {
+		resolved.Permissions[permission] = granted
+	}
+	resolved.Permissions[PermViewChannel] = !isPrivate
+
+	apply := func(targetType, target string) {
+		for _, overwrite := range overwrites {
+			if overwrite.TargetType != targetType || overwrite.Target != target {
+				continue
+			}
+			for _, permission := range overwrite.Deny {
+				resolved.Permissions[permission] = false
+			}
+			for _, permission := range overwrite.Allow {
+				resolved.Permissions[permission] = true
+			}
+		}
+	}
+	apply(OverwriteRole, RoleEveryone)
+	if m.Role != RoleEveryone {
+		apply(OverwriteRole, m.Role)
+	}
+	apply(OverwriteMember, m.UserID.String())
+
+	if !resolved.Permissions[PermViewChannel] {
+		resolved.Permissions = map[string]bool{}
+	}
+	return &resolved
+}
+
+// Outranks indique si le membre est strictement au-dessus d'un rôle de la position donnée.
+// Le propriétaire est au-dessus de tous les rôles.
+func (m *MemberPermissions) Outranks(position int) bool {
+	if m == nil {
+		return false
+	}
+	return m.IsOwner || m.Position > position
+}
+
+// IsReservedRole indique si le nom de rôle est réservé par le système. Le rôle "admin"
+// n'est créé et attribué que par le transfert de propriété.
+func IsReservedRole(role string) bool {
+	return role == RoleOwner || role == RoleMember || role == RoleEveryone || role == RoleAdmin
+}
+
+// IsValidPermission vérifie qu'une permission fait partie de AllPermissions.
+func IsValidPermission(permission string) bool {
+	for _, p := range AllPermissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
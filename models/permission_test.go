@@ -0,0 +1,163 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/gocql/gocql"
+)
+
+func TestForChannel(t *testing.T) {
+	userID := gocql.MustRandomUUID()
+	member := func(role string, permissions ...string) *MemberPermissions {
+		m := &MemberPermissions{UserID: userID, Role: role, Permissions: map[string]bool{}}
+		for _, permission := range permissions {
+			m.Permissions[permission] = true
+		}
+		return m
+	}
+	overwrite := func(targetType, target string, allow, deny []string) PermissionOverwrite {
+		return PermissionOverwrite{TargetType: targetType, Target: target, Allow: allow, Deny: deny}
+	}
+
+	tests := []struct {
+		name       string
+		member     *MemberPermissions
+		isPrivate  bool
+		overwrites []PermissionOverwrite
+		want       map[string]bool // Résultat attendu de Has pour chaque permission
+	}{
+		{
+			name:   "salon public sans surcharge",
+			member: member("modos", PermSendMessages),
+			want:   map[string]bool{PermViewChannel: true, PermSendMessages: true, PermManageMessages: false},
+		},
+		{
+			name:      "salon privé sans surcharge",
+			member:    member("modos", PermSendMessages),
+			isPrivate: true,
+			want:      map[string]bool{PermViewChannel: false, PermSendMessages: false},
+		},
+		{
+			name:       "salon privé ouvert au rôle",
+			member:     member("modos", PermSendMessages),
+			isPrivate:  true,
+			overwrites: []PermissionOverwrite{overwrite(OverwriteRole, "modos", []string{PermViewChannel}, nil)},
+			want:       map[string]bool{PermViewChannel: true, PermSendMessages: true},
+		},
+		{
+			name:       "salon privé ouvert à un autre rôle",
+			member:     member("modos", PermSendMessages),
+			isPrivate:  true,
+			overwrites: []PermissionOverwrite{overwrite(OverwriteRole, "devs", []string{PermViewChannel}, nil)},
+			want:       map[string]bool{PermViewChannel: false, PermSendMessages: false},
+		},
+		{
+			name:   "le rôle l'emporte sur @everyone",
+			member: member("modos", PermSendMessages),
+			overwrites: []PermissionOverwrite{
+				overwrite(OverwriteRole, "modos", []string{PermSendMessages}, nil),
+				overwrite(OverwriteRole, RoleEveryone, nil, []string{PermSendMessages}),
+			},
+			want: map[string]bool{PermViewChannel: true, PermSendMessages: true},
+		},
+		{
+			name:   "le membre l'emporte sur son rôle",
+			member: member("modos", PermSendMessages),
+			overwrites: []PermissionOverwrite{
+				overwrite(OverwriteMember, userID.String(), nil, []string{PermSendMessages}),
+				overwrite(OverwriteRole, "modos", []string{PermSendMessages}, nil),
+			},
+			want: map[string]bool{PermViewChannel: true, PermSendMessages: false},
+		},
+		{
+			name:       "l'autorisation l'emporte sur le refus d'une même surcharge",
+			member:     member("modos"),
+			overwrites: []PermissionOverwrite{overwrite(OverwriteRole, "modos", []string{PermAttachFiles}, []string{PermAttachFiles})},
+			want:       map[string]bool{PermAttachFiles: true},
+		},
+		{
+			name:       "sans VIEW_CHANNEL, aucune permission",
+			member:     member("modos", PermSendMessages, PermManageMessages),
+			overwrites: []PermissionOverwrite{overwrite(OverwriteRole, RoleEveryone, nil, []string{PermViewChannel})},
+			want:       map[string]bool{PermViewChannel: false, PermSendMessages: false, PermManageMessages: false},
+		},
+		{
+			name:       "l'administrateur ignore les surcharges",
+			member:     member("modos", PermAdministrator),
+			isPrivate:  true,
+			overwrites: []PermissionOverwrite{overwrite(OverwriteRole, "modos", nil, []string{PermViewChannel, PermSendMessages})},
+			want:       map[string]bool{PermViewChannel: true, PermSendMessages: true},
+		},
+		{
+			name:       "le propriétaire ignore les surcharges",
+			member:     &MemberPermissions{UserID: userID, Role: RoleOwner, IsOwner: true},
+			isPrivate:  true,
+			overwrites: []PermissionOverwrite{overwrite(OverwriteMember, userID.String(), nil, []string{PermViewChannel})},
+			want:       map[string]bool{PermViewChannel: true, PermManageChannels: true},
+		},
+		{
+			name:       "membre nil",
+			member:     nil,
+			overwrites: []PermissionOverwrite{overwrite(OverwriteRole, RoleEveryone, []string{PermViewChannel}, nil)},
+			want:       map[string]bool{PermViewChannel: false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolved := tt.member.ForChannel(tt.isPrivate, tt.overwrites)
+			for permission, want := range tt.want {
+				if got := resolved.Has(permission); got != want {
+					t.Errorf("Has(%s) = %v, attendu %v", permission, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestForChannelDoesNotMutateMember(t *testing.T) {
+	member := &MemberPermissions{Role: "modos", Permissions: map[string]bool{PermSendMessages: true}}
+	member.ForChannel(true, nil)
+	if len(member.Permissions) != 1 || !member.Permissions[PermSendMessages] {
+		t.Errorf("les permissions du membre ont été modifiées : %v", member.Permissions)
+	}
+}
+
+func TestOutranks(t *testing.T) {
+	tests := []struct {
+		name     string
+		member   *MemberPermissions
+		position int
+		want     bool
+	}{
+		{name: "position supérieure", member: &MemberPermissions{Position: 3}, position: 2, want: true},
+		{name: "même position", member: &MemberPermissions{Position: 2}, position: 2, want: false},
+		{name: "position inférieure", member: &MemberPermissions{Position: 1}, position: 2, want: false},
+		{name: "propriétaire", member: &MemberPermissions{IsOwner: true}, position: 100, want: true},
+		{name: "administrateur sans rang", member: &MemberPermissions{Permissions: map[string]bool{PermAdministrator: true}}, position: 1, want: false},
+		{name: "membre nil", member: nil, position: -1, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.member.Outranks(tt.position); got != tt.want {
+				t.Errorf("Outranks(%d) = %v, attendu %v", tt.position, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsReservedRole(t *testing.T) {
+	for role, want := range map[string]bool{
+		RoleOwner:    true,
+		RoleMember:   true,
+		RoleEveryone: true,
+		RoleAdmin:    true,
+		"modos":      false,
+		"Admin":      false,
+	} {
+		if got := IsReservedRole(role); got != want {
+			t.Errorf("IsReservedRole(%q) = %v, attendu %v", role, got, want)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// MaxPinsPerChannel est le nombre maximal de messages épinglés dans un salon.
+const MaxPinsPerChannel = 50
+
+// Pin est une ligne de pins_by_channel.
+type Pin struct {
+	ChannelID gocql.UUID `json:"channel_id"`
+	MessageID gocql.UUID `json:"message_id"`
+	PinnedBy  gocql.UUID `json:"pinned_by"`
+	PinnedAt  time.Time  `json:"pinned_at"`
+}
@@ -0,0 +1,8 @@
+package models
+
+// ReactionCount agrège les réactions d'un emoji sur un message.
+type ReactionCount struct {
+	Emoji string `json:"emoji"`
+	Count int64  `json:"count"`
+	Me    bool   `json:"me"` // L'utilisateur courant a réagi avec cet emoji
+}
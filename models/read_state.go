@@ -0,0 +1,23 @@
+package models
+
+import "github.com/gocql/gocql"
+
+type ReadState struct {
+	UserID            gocql.UUID `json:"user_id" validate:"required"`
+	ChannelID         gocql.UUID `json:"channel_id" validate:"required"`
+	ServerID          gocql.UUID `json:"server_id,omitempty"`
+	LastReadMessageID gocql.UUID `json:"last_read_message_id"`
+	MentionCount      int        `json:"mention_count"`
+}
+
+// IsUnread indique si lastMessageID est postérieur au dernier message lu. Un état nil
+// (salon jamais acquitté) est non lu dès qu'un message existe.
+func (r *ReadState) IsUnread(lastMessageID gocql.UUID) bool {
+	if lastMessageID == (gocql.UUID{}) {
+		return false
+	}
+	if r == nil || r.LastReadMessageID == (gocql.UUID{}) {
+		return true
+	}
+	return lastMessageID != r.LastReadMessageID && lastMessageID.Time().After(r.LastReadMessageID.Time())
+}
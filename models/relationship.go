@@ -0,0 +1,21 @@
+package models
+
+import (
+	"github.com/gocql/gocql"
+	"time"
+)
+
+// Types de relation, vus depuis UserID.
+const (
+	RelationshipFriend   = "friend"
+	RelationshipIncoming = "incoming" // TargetID a envoyé une demande à UserID
+	RelationshipOutgoing = "outgoing" // UserID a envoyé une demande à TargetID
+	RelationshipBlocked  = "blocked"  // UserID a bloqué TargetID
+)
+
+type Relationship struct {
+	UserID    gocql.UUID `json:"user_id" validate:"required"`
+	TargetID  gocql.UUID `json:"target_id" validate:"required"`
+	Type      string     `json:"type" validate:"required,oneof=friend incoming outgoing blocked"`
+	CreatedAt time.Time  `json:"created_at"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// SearchDocument est la forme indexée d'un message de serveur. AccessChannelID est le
+// salon dont dépend la visibilité : le salon lui-même, ou le salon parent pour un thread.
+type SearchDocument struct {
+	ServerID        string    `json:"server_id"`
+	ChannelID       string    `json:"channel_id"`
+	AccessChannelID string    `json:"access_channel_id"`
+	AuthorID        string    `json:"author_id"`
+	Content         string    `json:"content"`
+	SentAt          time.Time `json:"sent_at"`
+	HasAttachment   bool      `json:"has_attachment"`
+	Mentions        []string  `json:"mentions"`
+}
+
+// SearchQuery regroupe les filtres d'une recherche de messages. Les champs vides sont ignorés.
+type SearchQuery struct {
+	ServerID         string
+	AccessChannelIDs []string // Salons visibles par l'appelant (obligatoire)
+	Text             string
+	AuthorID         string
+	ChannelID        string
+	After            time.Time
+	Before           time.Time
+	HasAttachment    *bool
+	MentionsUserID   string
+	Offset, Limit    int
+}
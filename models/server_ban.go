@@ -0,0 +1,20 @@
+package models
+
+import (
+	"github.com/gocql/gocql"
+	"time"
+)
+
+type ServerBan struct {
+	ServerID  gocql.UUID `json:"server_id" validate:"required"`
+	UserID    gocql.UUID `json:"user_id" validate:"required"`
+	Reason    string     `json:"reason" validate:"max=512"`
+	BannedBy  gocql.UUID `json:"banned_by" validate:"required"`
+	BannedAt  time.Time  `json:"banned_at"`
+	ExpiresAt time.Time  `json:"expires_at,omitempty"`
+}
+
+// IsExpired indique si un bannissement temporaire est arrivé à échéance.
+func (b *ServerBan) IsExpired() bool {
+	return !b.ExpiresAt.IsZero() && time.Now().After(b.ExpiresAt)
+}
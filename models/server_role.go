@@ -5,5 +5,7 @@ import "github.com/gocql/gocql"
 type ServerRole struct {
 	ServerID    gocql.UUID `json:"server_id" validate:"required"`
 	Role        string     `json:"role" validate:"required"`
+	Color       string     `json:"color" validate:"omitempty,hexcolor"`
+	Position    int        `json:"position" validate:"min=0"`
 	Permissions []string   `json:"permissions" validate:"dive,required"`
 }
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"github.com/gocql/gocql"
+)
+
+// DefaultThreadAutoArchive est le délai d'inactivité (en secondes) avant l'archivage d'un thread.
+const DefaultThreadAutoArchive = 86400
+
+type ThreadByChannel struct {
+	ParentChannelID  gocql.UUID `json:"parent_channel_id"`
+	ThreadID         gocql.UUID `json:"thread_id"`
+	ParentMessageID  gocql.UUID `json:"parent_message_id"`
+	Name             string     `json:"name" validate:"required"`
+	CreatorID        gocql.UUID `json:"creator_id"`
+	Archived         bool       `json:"archived"`
+	AutoArchiveAfter int        `json:"auto_archive_after"` // En secondes
+}
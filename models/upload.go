@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// Usages possibles d'une session d'upload direct vers MinIO.
+const (
+	UploadPurposeAttachment = "attachment" // Pièce jointe d'un message
+	UploadPurposeAvatar     = "avatar"     // Avatar de l'utilisateur
+)
+
+// UploadSession décrit un upload direct (URL présignée) en attente de finalisation.
+// Elle est stockée dans Redis le temps que le client envoie le fichier à MinIO.
+type UploadSession struct {
+	ID          gocql.UUID `json:"id"`
+	UserID      gocql.UUID `json:"user_id"`
+	Purpose     string     `json:"purpose"`
+	ServerID    gocql.UUID `json:"server_id,omitempty"`  // Pièces jointes uniquement
+	ChannelID   gocql.UUID `json:"channel_id,omitempty"` // Pièces jointes uniquement
+	ObjectKey   string     `json:"object_key"`
+	Filename    string     `json:"filename"`
+	ContentType string     `json:"content_type"`
+	Size        int64      `json:"size"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+}
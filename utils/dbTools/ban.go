@@ -0,0 +1,60 @@
+package dbTools
+
+import (
+	"github.com/Romain-GUILLEMOT/WhispyrBack/db"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
+	"github.com/gocql/gocql"
+)
+
+// GetActiveBan récupère le bannissement en cours d'un utilisateur sur un serveur.
+// Retourne gocql.ErrNotFound s'il n'est pas banni ; un bannissement expiré est supprimé au passage.
+func GetActiveBan(serverID, userID gocql.UUID) (*models.ServerBan, error) {
+	ban := models.ServerBan{ServerID: serverID, UserID: userID}
+	if err := db.Session.Query(
+		`SELECT reason, banned_by, banned_at, expires_at FROM server_bans WHERE server_id = ? AND user_id = ? LIMIT 1`, serverID, userID,
+	).Scan(&ban.Reason, &ban.BannedBy, &ban.BannedAt, &ban.ExpiresAt); err != nil {
+		return nil, err
+	}
+	if ban.IsExpired() {
+		_ = UnbanMember(serverID, userID)
+		return nil, gocql.ErrNotFound
+	}
+	return &ban, nil
+}
+
+// GetServerBans liste les bannissements en cours d'un serveur.
+func GetServerBans(serverID gocql.UUID) ([]models.ServerBan, error) {
+	bans := make([]models.ServerBan, 0)
+	iter := db.Session.Query(`SELECT user_id, reason, banned_by, banned_at, expires_at FROM server_bans WHERE server_id = ?`, serverID).Iter()
+	ban := models.ServerBan{ServerID: serverID}
+	for iter.Scan(&ban.UserID, &ban.Reason, &ban.BannedBy, &ban.BannedAt, &ban.ExpiresAt) {
+		if !ban.IsExpired() {
+			bans = append(bans, ban)
+		}
+		ban = models.ServerBan{ServerID: serverID}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return bans, nil
+}
+
+// BanMember enregistre le bannissement et retire l'utilisateur du serveur dans le même batch.
+func BanMember(ban models.ServerBan) error {
+	var expiresAt interface{}
+	if !ban.ExpiresAt.IsZero() {
+		expiresAt = ban.ExpiresAt
+	}
+
+	batch := db.Session.NewBatch(gocql.LoggedBatch)
+	batch.Query(`INSERT INTO server_bans (server_id, user_id, reason, banned_by, banned_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		ban.ServerID, ban.UserID, ban.Reason, ban.BannedBy, ban.BannedAt, expiresAt)
+	batch.Query(`DELETE FROM user_servers WHERE user_id = ? AND server_id = ?`, ban.UserID, ban.ServerID)
+	batch.Query(`DELETE FROM server_members WHERE server_id = ? AND user_id = ?`, ban.ServerID, ban.UserID)
+	return db.Session.ExecuteBatch(batch)
+}
+
+// UnbanMember lève le bannissement d'un utilisateur.
+func UnbanMember(serverID, userID gocql.UUID) error {
+	return db.Session.Query(`DELETE FROM server_bans WHERE server_id = ? AND user_id = ?`, serverID, userID).Exec()
+}
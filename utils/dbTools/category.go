@@ -0,0 +1,162 @@
+package dbTools
+
+import (
+	"sort"
+	"time"
+
+	"github.com/Romain-GUILLEMOT/WhispyrBack/db"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
+	"github.com/gocql/gocql"
+)
+
+// GetServerCategories retourne les catégories d'un serveur, triées par position.
+func GetServerCategories(serverID gocql.UUID) ([]models.CategoryByServer, error) {
+	categories := make([]models.CategoryByServer, 0)
+	iter := db.Session.Query(`SELECT category_id, name, position FROM categories_by_server WHERE server_id = ?`, serverID).Iter()
+	category := models.CategoryByServer{ServerID: serverID}
+	for iter.Scan(&category.CategoryID, &category.Name, &category.Position) {
+		categories = append(categories, category)
+		category = models.CategoryByServer{ServerID: serverID}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(categories, func(i, j int) bool { return categories[i].Position < categories[j].Position })
+	return categories, nil
+}
+
+// GetCategory récupère une catégorie d'un serveur.
+func GetCategory(serverID, categoryID gocql.UUID) (*models.CategoryByServer, error) {
+	category := models.CategoryByServer{ServerID: serverID, CategoryID: categoryID}
+	if err := db.Session.Query(
+		`SELECT name, position FROM categories_by_server WHERE server_id = ? AND category_id = ?`,
+		serverID, categoryID,
+	).Scan(&category.Name, &category.Position); err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+// CreateCategory ajoute une catégorie en dernière position.
+func CreateCategory(serverID gocql.UUID, name string) (*models.CategoryByServer, error) {
+	categories, err := GetServerCategories(serverID)
+	if err != nil {
+		return nil, err
+	}
+	category := models.CategoryByServer{ServerID: serverID, CategoryID: gocql.TimeUUID(), Name: name}
+	if len(categories) > 0 {
+		category.Position = categories[len(categories)-1].Position + 1
+	}
+
+	if err := db.Session.Query(
+		`INSERT INTO categories_by_server (server_id, category_id, name, position) VALUES (?, ?, ?, ?)`,
+		serverID, category.CategoryID, category.Name, category.Position,
+	).Exec(); err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+// RenameCategory modifie le nom d'une catégorie.
+func RenameCategory(serverID, categoryID gocql.UUID, name string) error {
+	return db.Session.Query(
+		`UPDATE categories_by_server SET name = ? WHERE server_id = ? AND category_id = ?`,
+		name, serverID, categoryID,
+	).Exec()
+}
+
+// SetCategoryPositions réécrit la position de chaque catégorie (category_id -> position).
+func SetCategoryPositions(serverID gocql.UUID, positions map[gocql.UUID]int) error {
+	batch := db.Session.NewBatch(gocql.LoggedBatch)
+	for categoryID, position := range positions {
+		batch.Query(`UPDATE categories_by_server SET position = ? WHERE server_id = ? AND category_id = ?`, position, serverID, categoryID)
+	}
+	return db.Session.ExecuteBatch(batch)
+}
+
+// DeleteCategory supprime une catégorie. Ses salons deviennent non catégorisés
+// (category_id nul) et sont placés après les salons déjà sans catégorie.
+func DeleteCategory(serverID, categoryID gocql.UUID) error {
+	channels, err := GetServerChannels(serverID)
+	if err != nil {
+		return err
+	}
+
+	next := 0
+	for _, channel := range channels {
+		if channel.CategoryID == (gocql.UUID{}) && channel.Position >= next {
+			next = channel.Position + 1
+		}
+	}
+	moved := make([]models.ChannelByServer, 0)
+	for _, channel := range channels {
+		if channel.CategoryID != categoryID {
+			continue
+		}
+		channel.CategoryID = gocql.UUID{}
+		channel.Position = next
+		next++
+		moved = append(moved, channel)
+	}
+
+	if err := MoveChannels(serverID, channels, moved); err != nil {
+		return err
+	}
+	return db.Session.Query(`DELETE FROM categories_by_server WHERE server_id = ? AND category_id = ?`, serverID, categoryID).Exec()
+}
+
+// channelMoveBatchSize borne le nombre de salons déplacés par batch (trois requêtes par
+// salon) pour rester sous le seuil de taille des batchs de Scylla.
+const channelMoveBatchSize = 25
+
+// MoveChannels applique de nouveaux emplacements (catégorie, position) à des salons.
+// current est la disposition actuelle lue dans channels_by_server : (category_id, position)
+// étant la clé de clustering, chaque salon déplacé voit sa ligne supprimée puis réécrite.
+// Les insertions sont horodatées après les suppressions pour qu'une ligne réécrite à
+// l'emplacement libéré par un autre salon ne soit pas masquée par sa tombe. Les horodatages
+// étant communs à tout le déplacement, l'ordre des batchs successifs est sans effet.
+func MoveChannels(serverID gocql.UUID, current, moved []models.ChannelByServer) error {
+	if len(moved) == 0 {
+		return nil
+	}
+	previous := make(map[gocql.UUID]models.ChannelByServer, len(current))
+	for _, channel := range current {
+		previous[channel.ChannelID] = channel
+	}
+
+	now := time.Now().UnixMicro()
+	for start := 0; start < len(moved); start += channelMoveBatchSize {
+		chunk := moved[start:min(start+channelMoveBatchSize, len(moved))]
+		batch := db.Session.NewBatch(gocql.LoggedBatch)
+		for _, channel := range chunk {
+			if old, ok := previous[channel.ChannelID]; ok {
+				batch.Query(`DELETE FROM channels_by_server USING TIMESTAMP ? WHERE server_id = ? AND category_id = ? AND position = ?`,
+					now, serverID, old.CategoryID, old.Position)
+			}
+			batch.Query(`INSERT INTO channels_by_server (server_id, category_id, position, channel_id, name, type, is_private) VALUES (?, ?, ?, ?, ?, ?, ?) USING TIMESTAMP ?`,
+				serverID, channel.CategoryID, channel.Position, channel.ChannelID, channel.Name, channel.Type, channel.IsPrivate, now+1)
+			batch.Query(`UPDATE channels USING TIMESTAMP ? SET category_id = ?, position = ? WHERE channel_id = ?`,
+				now+1, channel.CategoryID, channel.Position, channel.ChannelID)
+		}
+		if err := db.Session.ExecuteBatch(batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nextChannelPosition retourne la position suivant le dernier salon d'une catégorie.
+func nextChannelPosition(serverID, categoryID gocql.UUID) (int, error) {
+	var position int
+	err := db.Session.Query(
+		`SELECT position FROM channels_by_server WHERE server_id = ? AND category_id = ? ORDER BY category_id DESC, position DESC LIMIT 1`,
+		serverID, categoryID,
+	).Scan(&position)
+	if err == gocql.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return position + 1, nil
+}
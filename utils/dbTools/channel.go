@@ -1,13 +1,15 @@
 package dbTools
 
 import (
+	"errors"
+
 	"github.com/Romain-GUILLEMOT/WhispyrBack/db"
 	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
 	"github.com/gocql/gocql"
 	"time"
 )
 
-// GetChannelByID récupère un salon et son nom par son ID.
+// GetChannelByID récupère un salon (serveur, catégorie, nom, type et informations de thread) par son ID.
 func GetChannelByID(id string) (*models.Channel, error) {
 	var channel models.Channel
 
@@ -17,11 +19,26 @@ func GetChannelByID(id string) (*models.Channel, error) {
 		return nil, err
 	}
 
-	query := `SELECT channel_id, name FROM channels WHERE channel_id = ? LIMIT 1`
+	query := `SELECT channel_id, server_id, category_id, name, type, is_private, position, created_at,
+		parent_channel_id, parent_message_id, archived, auto_archive_after, last_activity_at, owner_id, last_message_id
+		FROM channels WHERE channel_id = ? LIMIT 1`
 
 	if err := db.Session.Query(query, parsedID).Scan(
 		&channel.ChannelID,
+		&channel.ServerID,
+		&channel.CategoryID,
 		&channel.Name,
+		&channel.Type,
+		&channel.IsPrivate,
+		&channel.Position,
+		&channel.CreatedAt,
+		&channel.ParentChannelID,
+		&channel.ParentMessageID,
+		&channel.Archived,
+		&channel.AutoArchiveAfter,
+		&channel.LastActivityAt,
+		&channel.OwnerID,
+		&channel.LastMessageID,
 	); err != nil {
 		return nil, err
 	}
@@ -29,27 +46,76 @@ func GetChannelByID(id string) (*models.Channel, error) {
 	return &channel, nil
 }
 
-// CreateChannelInDB insère un nouveau salon dans toutes les tables nécessaires.
-func CreateChannelInDB(serverIDStr, categoryIDStr, name, channelType string) error {
+// GetServerChannelIDs retourne les IDs des salons d'un serveur (hors threads).
+func GetServerChannelIDs(serverID gocql.UUID) ([]gocql.UUID, error) {
+	channelIDs := make([]gocql.UUID, 0)
+	iter := db.Session.Query(`SELECT channel_id FROM channels_by_server WHERE server_id = ?`, serverID).Iter()
+	var channelID gocql.UUID
+	for iter.Scan(&channelID) {
+		channelIDs = append(channelIDs, channelID)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return channelIDs, nil
+}
+
+// GetServerChannels retourne les salons d'un serveur tels que listés dans channels_by_server (hors threads).
+func GetServerChannels(serverID gocql.UUID) ([]models.ChannelByServer, error) {
+	channels := make([]models.ChannelByServer, 0)
+	iter := db.Session.Query(`SELECT category_id, position, channel_id, name, type, is_private FROM channels_by_server WHERE server_id = ?`, serverID).Iter()
+	channel := models.ChannelByServer{ServerID: serverID}
+	for iter.Scan(&channel.CategoryID, &channel.Position, &channel.ChannelID, &channel.Name, &channel.Type, &channel.IsPrivate) {
+		channels = append(channels, channel)
+		channel = models.ChannelByServer{ServerID: serverID}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return channels, nil
+}
+
+// CreateChannelInDB insère un nouveau salon en dernière position de sa catégorie.
+// (category_id, position) étant la clé de clustering de channels_by_server, l'emplacement
+// est réservé par IF NOT EXISTS : deux créations simultanées ne s'écrasent pas, la seconde
+// prend la position suivante.
+func CreateChannelInDB(serverIDStr, categoryIDStr, name, channelType string, isPrivate bool) error {
 	serverID, _ := gocql.ParseUUID(serverIDStr)
 	categoryID, _ := gocql.ParseUUID(categoryIDStr)
 	channelID := gocql.TimeUUID()
 
-	// TODO: Calculer la position dynamiquement
-	position := 1
-
-	batch := db.Session.NewBatch(gocql.LoggedBatch)
-	batch.Query(`INSERT INTO channels (channel_id, server_id, category_id, name, type, is_private, position, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
-		channelID, serverID, categoryID, name, channelType, false, position, time.Now())
-
-	batch.Query(`INSERT INTO channels_by_server (server_id, category_id, position, channel_id, name, type, is_private) VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		serverID, categoryID, position, channelID, name, channelType, false)
+	position, err := nextChannelPosition(serverID, categoryID)
+	if err != nil {
+		return err
+	}
 
-	return db.Session.ExecuteBatch(batch)
+	for attempt := 0; attempt < 5; attempt++ {
+		existing := map[string]interface{}{}
+		applied, err := db.Session.Query(
+			`INSERT INTO channels_by_server (server_id, category_id, position, channel_id, name, type, is_private) VALUES (?, ?, ?, ?, ?, ?, ?) IF NOT EXISTS`,
+			serverID, categoryID, position, channelID, name, channelType, isPrivate,
+		).MapScanCAS(existing)
+		if err != nil {
+			return err
+		}
+		if !applied {
+			position++
+			continue
+		}
+
+		if err := db.Session.Query(`INSERT INTO channels (channel_id, server_id, category_id, name, type, is_private, position, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			channelID, serverID, categoryID, name, channelType, isPrivate, position, time.Now()).Exec(); err != nil {
+			// L'emplacement réservé ne doit pas pointer vers un salon inexistant.
+			db.Session.Query(`DELETE FROM channels_by_server WHERE server_id = ? AND category_id = ? AND position = ?`, serverID, categoryID, position).Exec()
+			return err
+		}
+		return nil
+	}
+	return errors.New("impossible de réserver une position pour le salon")
 }
 
-// UpdateChannelInDB met à jour le nom d'un salon.
-func UpdateChannelInDB(channelIDStr, newName string) error {
+// UpdateChannelInDB met à jour le nom et la confidentialité d'un salon.
+func UpdateChannelInDB(channelIDStr, newName string, isPrivate bool) error {
 	channelID, _ := gocql.ParseUUID(channelIDStr)
 
 	// Il faut d'abord lire pour avoir les clés primaires des autres tables
@@ -60,27 +126,71 @@ func UpdateChannelInDB(channelIDStr, newName string) error {
 	}
 
 	batch := db.Session.NewBatch(gocql.LoggedBatch)
-	batch.Query(`UPDATE channels SET name = ? WHERE channel_id = ?`, newName, channelID)
-	batch.Query(`UPDATE channels_by_server SET name = ? WHERE server_id = ? AND category_id = ? AND position = ?`, newName, serverID, categoryID, position)
+	batch.Query(`UPDATE channels SET name = ?, is_private = ? WHERE channel_id = ?`, newName, isPrivate, channelID)
+	batch.Query(`UPDATE channels_by_server SET name = ?, is_private = ? WHERE server_id = ? AND category_id = ? AND position = ?`, newName, isPrivate, serverID, categoryID, position)
 
 	return db.Session.ExecuteBatch(batch)
 }
 
-// DeleteChannelFromDB supprime un salon de toutes les tables.
-func DeleteChannelFromDB(channelIDStr string) error {
+// threadDeleteBatchSize borne le nombre de threads supprimés par batch (quatre requêtes par thread).
+const threadDeleteBatchSize = 25
+
+// DeleteChannelFromDB supprime un salon de toutes les tables, avec ses threads. Retourne les
+// identifiants des threads supprimés (le salon lui-même s'il s'agit d'un thread) pour que
+// l'appelant les retire de la planification d'archivage.
+func DeleteChannelFromDB(channelIDStr string) ([]gocql.UUID, error) {
 	channelID, _ := gocql.ParseUUID(channelIDStr)
 
-	var serverID, categoryID gocql.UUID
+	var serverID, categoryID, parentChannelID gocql.UUID
 	var position int
-	if err := db.Session.Query(`SELECT server_id, category_id, position FROM channels WHERE channel_id = ?`, channelID).Scan(&serverID, &categoryID, &position); err != nil {
-		return err
+	if err := db.Session.Query(`SELECT server_id, category_id, position, parent_channel_id FROM channels WHERE channel_id = ?`, channelID).Scan(&serverID, &categoryID, &position, &parentChannelID); err != nil {
+		return nil, err
+	}
+
+	// Un thread n'a pas de ligne dans channels_by_server : il est listé par son salon parent.
+	if parentChannelID != (gocql.UUID{}) {
+		batch := db.Session.NewBatch(gocql.LoggedBatch)
+		queueThreadDeletion(batch, parentChannelID, channelID)
+		return []gocql.UUID{channelID}, db.Session.ExecuteBatch(batch)
+	}
+
+	var threadIDs []gocql.UUID
+	iter := db.Session.Query(`SELECT thread_id FROM threads_by_channel WHERE parent_channel_id = ?`, channelID).Iter()
+	var threadID gocql.UUID
+	for iter.Scan(&threadID) {
+		threadIDs = append(threadIDs, threadID)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	for start := 0; start < len(threadIDs); start += threadDeleteBatchSize {
+		batch := db.Session.NewBatch(gocql.LoggedBatch)
+		for _, id := range threadIDs[start:min(start+threadDeleteBatchSize, len(threadIDs))] {
+			queueThreadDeletion(batch, channelID, id)
+		}
+		if err := db.Session.ExecuteBatch(batch); err != nil {
+			return nil, err
+		}
 	}
 
 	batch := db.Session.NewBatch(gocql.LoggedBatch)
 	batch.Query(`DELETE FROM channels WHERE channel_id = ?`, channelID)
 	batch.Query(`DELETE FROM channels_by_server WHERE server_id = ? AND category_id = ? AND position = ?`, serverID, categoryID, position)
+	batch.Query(`DELETE FROM channel_last_messages WHERE server_id = ? AND channel_id = ?`, serverID, channelID)
+	batch.Query(`DELETE FROM pins_by_channel WHERE channel_id = ?`, channelID)
+	batch.Query(`DELETE FROM pin_counts WHERE channel_id = ?`, channelID)
+	batch.Query(`DELETE FROM channel_permission_overwrites WHERE server_id = ? AND channel_id = ?`, serverID, channelID)
+	batch.Query(`DELETE FROM threads_by_channel WHERE parent_channel_id = ?`, channelID)
 	// IMPORTANT : Il faudra aussi supprimer les messages de ce salon
 	// batch.Query(`DELETE FROM messages_by_channel WHERE channel_id = ?`, channelID)
 
-	return db.Session.ExecuteBatch(batch)
+	return threadIDs, db.Session.ExecuteBatch(batch)
+}
+
+// queueThreadDeletion ajoute au batch la suppression d'un thread et de ses épingles.
+func queueThreadDeletion(batch *gocql.Batch, parentChannelID, threadID gocql.UUID) {
+	batch.Query(`DELETE FROM channels WHERE channel_id = ?`, threadID)
+	batch.Query(`DELETE FROM threads_by_channel WHERE parent_channel_id = ? AND thread_id = ?`, parentChannelID, threadID)
+	batch.Query(`DELETE FROM pins_by_channel WHERE channel_id = ?`, threadID)
+	batch.Query(`DELETE FROM pin_counts WHERE channel_id = ?`, threadID)
 }
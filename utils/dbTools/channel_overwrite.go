@@ -0,0 +1,81 @@
+package dbTools
+
+import (
+	"github.com/Romain-GUILLEMOT/WhispyrBack/db"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
+	"github.com/gocql/gocql"
+)
+
+// GetChannelOverwrites retourne les surcharges de permissions d'un salon.
+func GetChannelOverwrites(serverID, channelID gocql.UUID) ([]models.PermissionOverwrite, error) {
+	overwrites := make([]models.PermissionOverwrite, 0)
+	iter := db.Session.Query(
+		`SELECT target_type, target, allow, deny FROM channel_permission_overwrites WHERE server_id = ? AND channel_id = ?`,
+		serverID, channelID,
+	).Iter()
+	overwrite := models.PermissionOverwrite{ServerID: serverID, ChannelID: channelID}
+	for iter.Scan(&overwrite.TargetType, &overwrite.Target, &overwrite.Allow, &overwrite.Deny) {
+		overwrites = append(overwrites, overwrite)
+		overwrite = models.PermissionOverwrite{ServerID: serverID, ChannelID: channelID}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return overwrites, nil
+}
+
+// GetServerOverwrites retourne les surcharges de tous les salons d'un serveur, par salon.
+func GetServerOverwrites(serverID gocql.UUID) (map[gocql.UUID][]models.PermissionOverwrite, error) {
+	overwrites := make(map[gocql.UUID][]models.PermissionOverwrite)
+	iter := db.Session.Query(
+		`SELECT channel_id, target_type, target, allow, deny FROM channel_permission_overwrites WHERE server_id = ?`,
+		serverID,
+	).Iter()
+	overwrite := models.PermissionOverwrite{ServerID: serverID}
+	for iter.Scan(&overwrite.ChannelID, &overwrite.TargetType, &overwrite.Target, &overwrite.Allow, &overwrite.Deny) {
+		overwrites[overwrite.ChannelID] = append(overwrites[overwrite.ChannelID], overwrite)
+		overwrite = models.PermissionOverwrite{ServerID: serverID}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return overwrites, nil
+}
+
+// SaveChannelOverwrite crée ou remplace la surcharge d'une cible sur un salon.
+func SaveChannelOverwrite(overwrite models.PermissionOverwrite) error {
+	return db.Session.Query(
+		`INSERT INTO channel_permission_overwrites (server_id, channel_id, target_type, target, allow, deny) VALUES (?, ?, ?, ?, ?, ?)`,
+		overwrite.ServerID, overwrite.ChannelID, overwrite.TargetType, overwrite.Target, overwrite.Allow, overwrite.Deny,
+	).Exec()
+}
+
+// DeleteChannelOverwrite supprime la surcharge d'une cible sur un salon.
+func DeleteChannelOverwrite(serverID, channelID gocql.UUID, targetType, target string) error {
+	return db.Session.Query(
+		`DELETE FROM channel_permission_overwrites WHERE server_id = ? AND channel_id = ? AND target_type = ? AND target = ?`,
+		serverID, channelID, targetType, target,
+	).Exec()
+}
+
+// DeleteRoleOverwrites supprime les surcharges visant un rôle sur tous les salons du serveur,
+// pour qu'un rôle recréé sous le même nom n'en hérite pas.
+func DeleteRoleOverwrites(serverID gocql.UUID, role string) error {
+	overwrites, err := GetServerOverwrites(serverID)
+	if err != nil {
+		return err
+	}
+	batch := db.Session.NewBatch(gocql.LoggedBatch)
+	for channelID, channelOverwrites := range overwrites {
+		for _, overwrite := range channelOverwrites {
+			if overwrite.TargetType == models.OverwriteRole && overwrite.Target == role {
+				batch.Query(`DELETE FROM channel_permission_overwrites WHERE server_id = ? AND channel_id = ? AND target_type = ? AND target = ?`,
+					serverID, channelID, models.OverwriteRole, role)
+			}
+		}
+	}
+	if batch.Size() == 0 {
+		return nil
+	}
+	return db.Session.ExecuteBatch(batch)
+}
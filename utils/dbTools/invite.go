@@ -0,0 +1,119 @@
+package dbTools
+
+import (
+	"errors"
+
+	"github.com/Romain-GUILLEMOT/WhispyrBack/db"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/utils"
+	"github.com/gocql/gocql"
+)
+
+// ErrInviteExhausted est retournée quand une invitation a atteint son nombre maximal d'utilisations.
+var ErrInviteExhausted = errors.New("invitation épuisée")
+
+const inviteCodeLength = 8
+
+// CreateInvite génère un code unique et enregistre l'invitation.
+func CreateInvite(invite *models.Invite) error {
+	for attempt := 0; attempt < 5; attempt++ {
+		code, err := utils.RandomCode(inviteCodeLength)
+		if err != nil {
+			return err
+		}
+
+		var expiresAt interface{}
+		if !invite.ExpiresAt.IsZero() {
+			expiresAt = invite.ExpiresAt
+		}
+
+		// IF NOT EXISTS protège contre une collision de code (très improbable).
+		existing := map[string]interface{}{}
+		applied, err := db.Session.Query(
+			`INSERT INTO invites (code, server_id, inviter_id, max_uses, uses, expires_at, temporary, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?) IF NOT EXISTS`,
+			code, invite.ServerID, invite.InviterID, invite.MaxUses, 0, expiresAt, invite.Temporary, invite.CreatedAt,
+		).MapScanCAS(existing)
+		if err != nil {
+			return err
+		}
+		if !applied {
+			continue
+		}
+
+		invite.Code = code
+		return db.Session.Query(`INSERT INTO invites_by_server (server_id, code) VALUES (?, ?)`, invite.ServerID, code).Exec()
+	}
+	return errors.New("impossible de générer un code d'invitation unique")
+}
+
+// GetInvite récupère une invitation par son code. Retourne gocql.ErrNotFound si elle n'existe pas.
+func GetInvite(code string) (*models.Invite, error) {
+	invite := models.Invite{Code: code}
+	if err := db.Session.Query(
+		`SELECT server_id, inviter_id, max_uses, uses, expires_at, temporary, created_at FROM invites WHERE code = ? LIMIT 1`, code,
+	).Scan(&invite.ServerID, &invite.InviterID, &invite.MaxUses, &invite.Uses, &invite.ExpiresAt, &invite.Temporary, &invite.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+// GetServerInvites récupère les invitations d'un serveur. Les invitations expirées sont supprimées au passage.
+func GetServerInvites(serverID gocql.UUID) ([]models.Invite, error) {
+	var codes []string
+	iter := db.Session.Query(`SELECT code FROM invites_by_server WHERE server_id = ?`, serverID).Iter()
+	var code string
+	for iter.Scan(&code) {
+		codes = append(codes, code)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	invites := make([]models.Invite, 0, len(codes))
+	for _, c := range codes {
+		invite, err := GetInvite(c)
+		if err != nil {
+			if err == gocql.ErrNotFound {
+				continue
+			}
+			return nil, err
+		}
+		if invite.IsExpired() {
+			_ = DeleteInvite(serverID, c)
+			continue
+		}
+		invites = append(invites, *invite)
+	}
+	return invites, nil
+}
+
+// DeleteInvite supprime une invitation.
+func DeleteInvite(serverID gocql.UUID, code string) error {
+	batch := db.Session.NewBatch(gocql.LoggedBatch)
+	batch.Query(`DELETE FROM invites WHERE code = ?`, code)
+	batch.Query(`DELETE FROM invites_by_server WHERE server_id = ? AND code = ?`, serverID, code)
+	return db.Session.ExecuteBatch(batch)
+}
+
+// UseInvite incrémente le compteur d'utilisations via une LWT pour respecter
+// max_uses même en cas d'acceptations concurrentes.
+func UseInvite(invite *models.Invite) error {
+	uses := invite.Uses
+	for attempt := 0; attempt < 5; attempt++ {
+		if invite.MaxUses > 0 && uses >= invite.MaxUses {
+			return ErrInviteExhausted
+		}
+
+		var currentUses int
+		applied, err := db.Session.Query(`UPDATE invites SET uses = ? WHERE code = ? IF uses = ?`, uses+1, invite.Code, uses).ScanCAS(&currentUses)
+		if err != nil {
+			return err
+		}
+		if applied {
+			invite.Uses = uses + 1
+			return nil
+		}
+		uses = currentUses
+	}
+	return errors.New("conflit lors de l'utilisation de l'invitation")
+}
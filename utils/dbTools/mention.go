@@ -0,0 +1,78 @@
+package dbTools
+
+import (
+	"github.com/Romain-GUILLEMOT/WhispyrBack/db"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
+	"github.com/gocql/gocql"
+)
+
+// RecordMention ajoute le message à la boîte de réception des mentions de userID et
+// incrémente son compteur de mentions non lues sur le salon. Retourne false si la mention
+// était déjà enregistrée (message modifié qui mentionnait déjà l'utilisateur).
+func RecordMention(mention models.MentionByUser) (bool, error) {
+	existing := map[string]interface{}{}
+	applied, err := db.Session.Query(`INSERT INTO mentions_by_user (user_id, message_id, channel_id, server_id) VALUES (?, ?, ?, ?) IF NOT EXISTS`,
+		mention.UserID, mention.MessageID, mention.ChannelID, mention.ServerID).MapScanCAS(existing)
+	if err != nil || !applied {
+		return false, err
+	}
+
+	// mention_count n'est pas un COUNTER (il cohabite avec l'état de lecture) : lecture puis écriture.
+	count := 0
+	if state, err := GetReadState(mention.UserID, mention.ChannelID); err == nil {
+		count = state.MentionCount
+	} else if err != gocql.ErrNotFound {
+		return true, err
+	}
+	return true, db.Session.Query(`UPDATE read_states SET server_id = ?, mention_count = ? WHERE user_id = ? AND channel_id = ?`,
+		mention.ServerID, count+1, mention.UserID, mention.ChannelID).Exec()
+}
+
+// RemoveMention retire le message de la boîte de réception des mentions de userID. Si le
+// message n'a pas encore été lu, le compteur de mentions non lues du salon est décrémenté.
+func RemoveMention(mention models.MentionByUser) error {
+	existing := map[string]interface{}{}
+	applied, err := db.Session.Query(`DELETE FROM mentions_by_user WHERE user_id = ? AND message_id = ? IF EXISTS`,
+		mention.UserID, mention.MessageID).MapScanCAS(existing)
+	if err != nil || !applied {
+		return err
+	}
+
+	state, err := GetReadState(mention.UserID, mention.ChannelID)
+	if err != nil {
+		if err == gocql.ErrNotFound {
+			return nil
+		}
+		return err
+	}
+	if state.MentionCount == 0 || !state.IsUnread(mention.MessageID) {
+		return nil
+	}
+	return db.Session.Query(`UPDATE read_states SET mention_count = ? WHERE user_id = ? AND channel_id = ?`,
+		state.MentionCount-1, mention.UserID, mention.ChannelID).Exec()
+}
+
+// GetUserMentions retourne jusqu'à limit mentions reçues, de la plus récente à la plus
+// ancienne, strictement antérieures au curseur s'il est fourni.
+func GetUserMentions(userID gocql.UUID, before *gocql.UUID, limit int) ([]models.MentionByUser, error) {
+	query := `SELECT message_id, channel_id, server_id FROM mentions_by_user WHERE user_id = ?`
+	args := []interface{}{userID}
+	if before != nil {
+		query += ` AND message_id < ?`
+		args = append(args, *before)
+	}
+	query += ` LIMIT ?`
+	args = append(args, limit)
+
+	mentions := make([]models.MentionByUser, 0, limit)
+	iter := db.Session.Query(query, args...).Iter()
+	mention := models.MentionByUser{UserID: userID}
+	for iter.Scan(&mention.MessageID, &mention.ChannelID, &mention.ServerID) {
+		mentions = append(mentions, mention)
+		mention = models.MentionByUser{UserID: userID}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return mentions, nil
+}
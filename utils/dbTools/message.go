@@ -4,48 +4,208 @@ package dbTools
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/Romain-GUILLEMOT/WhispyrBack/db"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
 	"github.com/Romain-GUILLEMOT/WhispyrBack/utils"
 	"github.com/gocql/gocql"
 )
 
 // SaveMessageToScylla enregistre un message de chat dans la base de données,
 // incluant les informations dénormalisées de l'expéditeur (pseudo et avatar).
-// La fonction génère son propre timestamp pour être la source de vérité.
-func SaveMessageToScylla(ctx context.Context, serverID, channelID, userID, content, senderUsername, senderAvatar string) {
-	channelUUID, err := gocql.ParseUUID(channelID)
-	if err != nil {
-		utils.Error("SaveMessageToScylla: ID de salon invalide", "channelId", channelID, "error", err)
-		return
-	}
-	senderUUID, err := gocql.ParseUUID(userID)
-	if err != nil {
-		utils.Error("SaveMessageToScylla: ID utilisateur invalide", "userId", userID, "error", err)
-		return
-	}
-
-	now := time.Now()
-	dayBucket := now.UTC().Format("2006-01-02")
-	messageUUID := gocql.UUIDFromTime(now)
-
-	// ✅ La requête INSERT inclut maintenant sender_username et sender_avatar
+// Le TimeUUID (message.SentAt) est généré par l'appelant afin que le message diffusé
+// en temps réel et la ligne persistée partagent le même ID et le même horodatage.
+// ReplyTo vaut l'UUID nul lorsque le message ne répond à aucun autre.
+func SaveMessageToScylla(ctx context.Context, message *models.MessageByChannel) error {
 	query := `
         INSERT INTO messages_by_channel (
-            channel_id, day_bucket, sent_at, sender_id, content, sender_username, sender_avatar
-        ) VALUES (?, ?, ?, ?, ?, ?, ?)`
+            channel_id, day_bucket, sent_at, sender_id, content, sender_username, sender_avatar, reply_to, attachments,
+            mentions, mention_roles, mention_everyone
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	var replyTo interface{}
+	if message.ReplyTo != (gocql.UUID{}) {
+		replyTo = message.ReplyTo
+	}
+
+	dayBucket := models.DayBucketOf(message.SentAt)
+	if err := RecordChannelBucket(ctx, message.ChannelID, dayBucket); err != nil {
+		utils.Error("Erreur lors de l'indexation du bucket du message", "error", err)
+		return err
+	}
 
 	if err := db.Session.Query(
 		query,
-		channelUUID,
+		message.ChannelID,
 		dayBucket,
-		messageUUID,
-		senderUUID,
-		content,
-		senderUsername, // On ajoute le pseudo
-		senderAvatar,   // et l'avatar
+		message.SentAt,
+		message.SenderID,
+		message.Content,
+		message.SenderUsername,
+		message.SenderAvatar,
+		replyTo,
+		message.Attachments,
+		message.Mentions,
+		message.MentionRoles,
+		message.MentionEveryone,
 	).WithContext(ctx).Exec(); err != nil {
 		utils.Error("Erreur lors de la sauvegarde du message dans ScyllaDB", "error", err)
+		return err
+	}
+	return nil
+}
+
+// messageColumns liste les colonnes lues pour un message ; l'ordre doit
+// correspondre à messageScanDest.
+const messageColumns = `day_bucket, sent_at, sender_id, content, sender_username, sender_avatar, edited_at, reply_to, thread_id, attachments,
+	mentions, mention_roles, mention_everyone`
+
+func messageScanDest(m *models.MessageByChannel) []interface{} {
+	return []interface{}{&m.DayBucket, &m.SentAt, &m.SenderID, &m.Content, &m.SenderUsername, &m.SenderAvatar, &m.EditedAt, &m.ReplyTo, &m.ThreadID, &m.Attachments,
+		&m.Mentions, &m.MentionRoles, &m.MentionEveryone}
+}
+
+// scanMessages lit toutes les lignes d'un itérateur de messages.
+func scanMessages(iter *gocql.Iter, channelID gocql.UUID) ([]models.MessageByChannel, error) {
+	messages := make([]models.MessageByChannel, 0)
+	var message models.MessageByChannel
+	for iter.Scan(messageScanDest(&message)...) {
+		message.ChannelID = channelID
+		messages = append(messages, message)
+		message = models.MessageByChannel{}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// GetMessage récupère un message par son salon et son TimeUUID (sent_at).
+// Le day_bucket est déduit du TimeUUID. Retourne gocql.ErrNotFound s'il n'existe pas.
+func GetMessage(channelID, messageID gocql.UUID) (*models.MessageByChannel, error) {
+	message := models.MessageByChannel{ChannelID: channelID}
+	if err := db.Session.Query(
+		`SELECT `+messageColumns+` FROM messages_by_channel WHERE channel_id = ? AND day_bucket = ? AND sent_at = ? LIMIT 1`,
+		channelID, models.DayBucketOf(messageID), messageID,
+	).Scan(messageScanDest(&message)...); err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// GetMessagesBefore retourne jusqu'à limit messages strictement antérieurs au curseur,
+// du plus récent au plus ancien. Sans curseur, retourne les messages les plus récents.
+// Les buckets sont parcourus à rebours via channel_buckets : la pagination ne dépend
+// donc pas de l'ancienneté des messages.
+func GetMessagesBefore(channelID gocql.UUID, cursor *gocql.UUID, limit int) ([]models.MessageByChannel, error) {
+	bucketQuery := `SELECT day_bucket FROM channel_buckets WHERE channel_id = ?`
+	bucketArgs := []interface{}{channelID}
+	if cursor != nil {
+		bucketQuery += ` AND day_bucket <= ?`
+		bucketArgs = append(bucketArgs, models.DayBucketOf(*cursor))
+	}
+	bucketQuery += ` ORDER BY day_bucket DESC`
+
+	return walkBuckets(bucketQuery, bucketArgs, limit, func(bucket string, remaining int) ([]models.MessageByChannel, error) {
+		if cursor != nil && bucket == models.DayBucketOf(*cursor) {
+			return scanMessages(db.Session.Query(
+				`SELECT `+messageColumns+` FROM messages_by_channel WHERE channel_id = ? AND day_bucket = ? AND sent_at < ? ORDER BY sent_at DESC LIMIT ?`,
+				channelID, bucket, *cursor, remaining,
+			).Iter(), channelID)
+		}
+		return scanMessages(db.Session.Query(
+			`SELECT `+messageColumns+` FROM messages_by_channel WHERE channel_id = ? AND day_bucket = ? ORDER BY sent_at DESC LIMIT ?`,
+			channelID, bucket, remaining,
+		).Iter(), channelID)
+	})
+}
+
+// GetMessagesAfter retourne jusqu'à limit messages strictement postérieurs au curseur,
+// du plus ancien au plus récent.
+func GetMessagesAfter(channelID gocql.UUID, cursor gocql.UUID, limit int) ([]models.MessageByChannel, error) {
+	cursorBucket := models.DayBucketOf(cursor)
+	bucketQuery := `SELECT day_bucket FROM channel_buckets WHERE channel_id = ? AND day_bucket >= ? ORDER BY day_bucket ASC`
+
+	return walkBuckets(bucketQuery, []interface{}{channelID, cursorBucket}, limit, func(bucket string, remaining int) ([]models.MessageByChannel, error) {
+		if bucket == cursorBucket {
+			return scanMessages(db.Session.Query(
+				`SELECT `+messageColumns+` FROM messages_by_channel WHERE channel_id = ? AND day_bucket = ? AND sent_at > ? ORDER BY sent_at ASC LIMIT ?`,
+				channelID, bucket, cursor, remaining,
+			).Iter(), channelID)
+		}
+		return scanMessages(db.Session.Query(
+			`SELECT `+messageColumns+` FROM messages_by_channel WHERE channel_id = ? AND day_bucket = ? ORDER BY sent_at ASC LIMIT ?`,
+			channelID, bucket, remaining,
+		).Iter(), channelID)
+	})
+}
+
+// walkBuckets parcourt les buckets retournés par bucketQuery et accumule les
+// messages lus par fetch jusqu'à atteindre limit.
+func walkBuckets(bucketQuery string, bucketArgs []interface{}, limit int, fetch func(bucket string, remaining int) ([]models.MessageByChannel, error)) ([]models.MessageByChannel, error) {
+	messages := make([]models.MessageByChannel, 0, limit)
+	iter := db.Session.Query(bucketQuery, bucketArgs...).PageSize(16).Iter()
+	var bucket string
+	for len(messages) < limit && iter.Scan(&bucket) {
+		page, err := fetch(bucket, limit-len(messages))
+		if err != nil {
+			_ = iter.Close()
+			return nil, err
+		}
+		messages = append(messages, page...)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// knownBuckets évite de réécrire channel_buckets à chaque message d'un même jour.
+var knownBuckets sync.Map
+
+// RecordChannelBucket référence un day_bucket non vide dans l'index channel_buckets.
+func RecordChannelBucket(ctx context.Context, channelID gocql.UUID, dayBucket string) error {
+	key := channelID.String() + ":" + dayBucket
+	if _, ok := knownBuckets.Load(key); ok {
+		return nil
+	}
+	if err := db.Session.Query(`INSERT INTO channel_buckets (channel_id, day_bucket) VALUES (?, ?)`, channelID, dayBucket).WithContext(ctx).Exec(); err != nil {
+		return err
+	}
+	knownBuckets.Store(key, struct{}{})
+	return nil
+}
+
+// UpdateMessageContent remplace le contenu d'un message et ses mentions résolues, et
+// renseigne edited_at.
+func UpdateMessageContent(message *models.MessageByChannel, editedAt time.Time) error {
+	return db.Session.Query(
+		`UPDATE messages_by_channel SET content = ?, mentions = ?, mention_roles = ?, mention_everyone = ?, edited_at = ? WHERE channel_id = ? AND day_bucket = ? AND sent_at = ?`,
+		message.Content, message.Mentions, message.MentionRoles, message.MentionEveryone, editedAt,
+		message.ChannelID, models.DayBucketOf(message.SentAt), message.SentAt,
+	).Exec()
+}
+
+// DeleteMessage supprime un message ainsi que ses réactions et son épingle. Retourne true si
+// le message était épinglé : sa place est alors libérée dans pin_counts.
+func DeleteMessage(channelID, messageID gocql.UUID) (bool, error) {
+	batch := db.Session.NewBatch(gocql.LoggedBatch)
+	batch.Query(`DELETE FROM messages_by_channel WHERE channel_id = ? AND day_bucket = ? AND sent_at = ?`,
+		channelID, models.DayBucketOf(messageID), messageID)
+	batch.Query(`DELETE FROM message_reactions WHERE channel_id = ? AND message_id = ?`, channelID, messageID)
+	if err := db.Session.ExecuteBatch(batch); err != nil {
+		return false, err
+	}
+	if err := db.Session.Query(`DELETE FROM message_reaction_counts WHERE channel_id = ? AND message_id = ?`, channelID, messageID).Exec(); err != nil {
+		return false, err
+	}
+
+	// Le message est supprimé : un échec sur l'épingle est seulement signalé.
+	unpinned, err := UnpinMessage(channelID, messageID)
+	if err != nil {
+		utils.Warn("Retrait de l'épingle impossible pour le message " + messageID.String() + ": " + err.Error())
 	}
+	return unpinned, nil
 }
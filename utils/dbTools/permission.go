@@ -0,0 +1,117 @@
+package dbTools
+
+import (
+	"github.com/Romain-GUILLEMOT/WhispyrBack/db"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
+	"github.com/gocql/gocql"
+)
+
+// GetMemberPermissions résout le rôle d'un membre (server_members.role) et
+// fusionne ses permissions avec celles du rôle @everyone du serveur.
+// Retourne gocql.ErrNotFound si l'utilisateur n'est pas membre du serveur.
+func GetMemberPermissions(serverID, userID gocql.UUID) (*models.MemberPermissions, error) {
+	var role string
+	if err := db.Session.Query(`SELECT role FROM server_members WHERE server_id = ? AND user_id = ? LIMIT 1`, serverID, userID).Scan(&role); err != nil {
+		return nil, err
+	}
+
+	ownerID, err := getServerOwnerID(serverID)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := make([]models.ServerRole, 0, 2)
+	iter := db.Session.Query(`SELECT role, permissions, position FROM server_roles WHERE server_id = ? AND role IN ?`,
+		serverID, []string{models.RoleEveryone, role}).Iter()
+	serverRole := models.ServerRole{ServerID: serverID}
+	for iter.Scan(&serverRole.Role, &serverRole.Permissions, &serverRole.Position) {
+		roles = append(roles, serverRole)
+		serverRole = models.ServerRole{ServerID: serverID}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	return buildMemberPermissions(serverID, userID, ownerID, role, roles), nil
+}
+
+// GetMembersPermissions résout les permissions de plusieurs membres (user_id -> rôle,
+// tel que retourné par GetServerMemberRoles) en ne lisant les rôles du serveur qu'une fois.
+func GetMembersPermissions(serverID gocql.UUID, memberRoles map[gocql.UUID]string) (map[gocql.UUID]*models.MemberPermissions, error) {
+	ownerID, err := getServerOwnerID(serverID)
+	if err != nil {
+		return nil, err
+	}
+	roles, err := GetServerRoles(serverID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[gocql.UUID]*models.MemberPermissions, len(memberRoles))
+	for userID, role := range memberRoles {
+		result[userID] = buildMemberPermissions(serverID, userID, ownerID, role, roles)
+	}
+	return result, nil
+}
+
+// GetChannelPermissions applique à un membre les surcharges d'un salon de serveur.
+// Un thread hérite de la confidentialité et des surcharges de son salon parent.
+func GetChannelPermissions(member *models.MemberPermissions, channel *models.Channel) (*models.MemberPermissions, error) {
+	if member.Has(models.PermAdministrator) {
+		return member, nil
+	}
+	if channel.IsThread() {
+		parent, err := GetChannelByID(channel.ParentChannelID.String())
+		if err != nil {
+			return nil, err
+		}
+		channel = parent
+	}
+	overwrites, err := GetChannelOverwrites(channel.ServerID, channel.ChannelID)
+	if err != nil {
+		return nil, err
+	}
+	return member.ForChannel(channel.IsPrivate, overwrites), nil
+}
+
+func getServerOwnerID(serverID gocql.UUID) (gocql.UUID, error) {
+	var ownerID gocql.UUID
+	err := db.Session.Query(`SELECT owner_id FROM servers WHERE server_id = ? LIMIT 1`, serverID).Scan(&ownerID)
+	return ownerID, err
+}
+
+// buildMemberPermissions fusionne les permissions de @everyone et du rôle du membre parmi roles.
+func buildMemberPermissions(serverID, userID, ownerID gocql.UUID, role string, roles []models.ServerRole) *models.MemberPermissions {
+	result := &models.MemberPermissions{
+		ServerID:    serverID,
+		UserID:      userID,
+		Role:        role,
+		IsOwner:     ownerID == userID || role == models.RoleOwner,
+		Permissions: make(map[string]bool),
+	}
+
+	// Les serveurs créés avant l'introduction des rôles n'ont pas de ligne @everyone :
+	// on applique alors les permissions par défaut.
+	foundEveryone := false
+	for _, serverRole := range roles {
+		switch serverRole.Role {
+		case models.RoleEveryone:
+			foundEveryone = true
+		case role:
+			result.Position = serverRole.Position
+		default:
+			continue
+		}
+		for _, p := range serverRole.Permissions {
+			result.Permissions[p] = true
+		}
+	}
+
+	if !foundEveryone {
+		for _, p := range models.DefaultEveryonePermissions {
+			result.Permissions[p] = true
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,144 @@
+package dbTools
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/Romain-GUILLEMOT/WhispyrBack/db"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
+	"github.com/gocql/gocql"
+)
+
+// ErrTooManyPins est retournée quand un salon a atteint le nombre maximal de messages épinglés.
+var ErrTooManyPins = errors.New("trop de messages épinglés dans ce salon")
+
+// PinMessage épingle un message. Retourne false s'il l'était déjà, même si le salon a
+// atteint MaxPinsPerChannel.
+func PinMessage(channelID, messageID, userID gocql.UUID) (bool, error) {
+	var pinnedID gocql.UUID
+	err := db.Session.Query(`SELECT message_id FROM pins_by_channel WHERE channel_id = ? AND message_id = ?`, channelID, messageID).Scan(&pinnedID)
+	if err == nil {
+		return false, nil
+	}
+	if err != gocql.ErrNotFound {
+		return false, err
+	}
+
+	if err := reservePinSlot(channelID); err != nil {
+		return false, err
+	}
+	existing := map[string]interface{}{}
+	applied, err := db.Session.Query(
+		`INSERT INTO pins_by_channel (channel_id, message_id, pinned_by, pinned_at) VALUES (?, ?, ?, ?) IF NOT EXISTS`,
+		channelID, messageID, userID, time.Now(),
+	).MapScanCAS(existing)
+	if err != nil || !applied {
+		// Épinglé entre-temps par une autre requête, ou échec : la place réservée est rendue.
+		if releaseErr := releasePinSlot(channelID); releaseErr != nil && err == nil {
+			err = releaseErr
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// UnpinMessage retire un message des épingles. Retourne false s'il n'était pas épinglé.
+func UnpinMessage(channelID, messageID gocql.UUID) (bool, error) {
+	existing := map[string]interface{}{}
+	applied, err := db.Session.Query(
+		`DELETE FROM pins_by_channel WHERE channel_id = ? AND message_id = ? IF EXISTS`,
+		channelID, messageID,
+	).MapScanCAS(existing)
+	if err != nil || !applied {
+		return false, err
+	}
+	return true, releasePinSlot(channelID)
+}
+
+// reservePinSlot incrémente le compteur d'épingles du salon via une LWT pour respecter
+// MaxPinsPerChannel même en cas d'épinglages concurrents.
+func reservePinSlot(channelID gocql.UUID) error {
+	pins, err := getPinCount(channelID)
+	if err != nil {
+		return err
+	}
+	for attempt := 0; attempt < 5; attempt++ {
+		if pins >= models.MaxPinsPerChannel {
+			return ErrTooManyPins
+		}
+		var currentPins int
+		applied, err := db.Session.Query(`UPDATE pin_counts SET pins = ? WHERE channel_id = ? IF pins = ?`, pins+1, channelID, pins).ScanCAS(&currentPins)
+		if err != nil {
+			return err
+		}
+		if applied {
+			return nil
+		}
+		pins = currentPins
+	}
+	return errors.New("conflit lors de l'épinglage du message")
+}
+
+// releasePinSlot décrémente le compteur d'épingles du salon via une LWT.
+func releasePinSlot(channelID gocql.UUID) error {
+	pins, err := getPinCount(channelID)
+	if err != nil {
+		return err
+	}
+	for attempt := 0; attempt < 5; attempt++ {
+		if pins <= 0 {
+			return nil
+		}
+		var currentPins int
+		applied, err := db.Session.Query(`UPDATE pin_counts SET pins = ? WHERE channel_id = ? IF pins = ?`, pins-1, channelID, pins).ScanCAS(&currentPins)
+		if err != nil {
+			return err
+		}
+		if applied {
+			return nil
+		}
+		pins = currentPins
+	}
+	return errors.New("conflit lors du retrait de l'épingle")
+}
+
+// getPinCount lit le compteur d'épingles du salon. Absent (salon antérieur au compteur),
+// il est initialisé depuis pins_by_channel.
+func getPinCount(channelID gocql.UUID) (int, error) {
+	var pins int
+	err := db.Session.Query(`SELECT pins FROM pin_counts WHERE channel_id = ?`, channelID).Scan(&pins)
+	if err != gocql.ErrNotFound {
+		return pins, err
+	}
+
+	if err := db.Session.Query(`SELECT COUNT(*) FROM pins_by_channel WHERE channel_id = ?`, channelID).Scan(&pins); err != nil {
+		return 0, err
+	}
+	existing := map[string]interface{}{}
+	applied, err := db.Session.Query(`INSERT INTO pin_counts (channel_id, pins) VALUES (?, ?) IF NOT EXISTS`, channelID, pins).MapScanCAS(existing)
+	if err != nil {
+		return 0, err
+	}
+	if !applied {
+		// Initialisé entre-temps par une autre requête.
+		pins, _ = existing["pins"].(int)
+	}
+	return pins, nil
+}
+
+// GetPins retourne les épingles d'un salon, de la plus récente à la plus ancienne.
+func GetPins(channelID gocql.UUID) ([]models.Pin, error) {
+	pins := make([]models.Pin, 0)
+	iter := db.Session.Query(`SELECT message_id, pinned_by, pinned_at FROM pins_by_channel WHERE channel_id = ?`, channelID).Iter()
+	pin := models.Pin{ChannelID: channelID}
+	for iter.Scan(&pin.MessageID, &pin.PinnedBy, &pin.PinnedAt) {
+		pins = append(pins, pin)
+		pin = models.Pin{ChannelID: channelID}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	sort.Slice(pins, func(i, j int) bool { return pins[i].PinnedAt.After(pins[j].PinnedAt) })
+	return pins, nil
+}
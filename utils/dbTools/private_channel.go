@@ -0,0 +1,154 @@
+package dbTools
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/Romain-GUILLEMOT/WhispyrBack/db"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
+	"github.com/gocql/gocql"
+)
+
+// GetChannelMembers récupère les membres d'un salon privé.
+func GetChannelMembers(channelID gocql.UUID) ([]models.ChannelMember, error) {
+	members := make([]models.ChannelMember, 0)
+	iter := db.Session.Query(`SELECT user_id, joined_at FROM channel_members WHERE channel_id = ?`, channelID).Iter()
+	var member models.ChannelMember
+	for iter.Scan(&member.UserID, &member.JoinedAt) {
+		member.ChannelID = channelID
+		members = append(members, member)
+		member = models.ChannelMember{}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// IsChannelMember vérifie si un utilisateur fait partie d'un salon privé.
+func IsChannelMember(channelID, userID gocql.UUID) (bool, error) {
+	var found gocql.UUID
+	if err := db.Session.Query(`SELECT user_id FROM channel_members WHERE channel_id = ? AND user_id = ? LIMIT 1`, channelID, userID).Scan(&found); err != nil {
+		if err == gocql.ErrNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// OpenDirectChannel retourne la conversation 1:1 entre deux utilisateurs, en la créant
+// si besoin. dm_by_pair (LWT) garantit une seule conversation par paire, même en cas
+// d'ouvertures concurrentes. created indique si la conversation vient d'être créée.
+func OpenDirectChannel(userID, recipientID gocql.UUID) (channelID gocql.UUID, created bool, err error) {
+	low, high := userID, recipientID
+	if bytes.Compare(low[:], high[:]) > 0 {
+		low, high = high, low
+	}
+
+	now := time.Now()
+	channelID = gocql.UUIDFromTime(now)
+	var existing gocql.UUID
+	applied, err := db.Session.Query(`INSERT INTO dm_by_pair (user_low, user_high, channel_id) VALUES (?, ?, ?) IF NOT EXISTS`,
+		low, high, channelID).ScanCAS(&low, &high, &existing)
+	if err != nil {
+		return channelID, false, err
+	}
+	if !applied {
+		return existing, false, nil
+	}
+
+	return channelID, true, createPrivateChannel(channelID, models.ChannelTypeDM, "", gocql.UUID{}, []gocql.UUID{userID, recipientID}, now)
+}
+
+// CreateGroupChannel crée un groupe privé dont ownerID est le propriétaire.
+func CreateGroupChannel(ownerID gocql.UUID, name string, memberIDs []gocql.UUID) (gocql.UUID, error) {
+	now := time.Now()
+	channelID := gocql.UUIDFromTime(now)
+	return channelID, createPrivateChannel(channelID, models.ChannelTypeGroupDM, name, ownerID, append([]gocql.UUID{ownerID}, memberIDs...), now)
+}
+
+// createPrivateChannel insère le salon, ses membres et leur entrée de sidebar. L'ID du
+// salon (TimeUUID) sert de dernier message initial pour le tri de private_channels_by_user.
+func createPrivateChannel(channelID gocql.UUID, channelType, name string, ownerID gocql.UUID, memberIDs []gocql.UUID, now time.Time) error {
+	var owner interface{}
+	if ownerID != (gocql.UUID{}) {
+		owner = ownerID
+	}
+
+	batch := db.Session.NewBatch(gocql.LoggedBatch)
+	batch.Query(`INSERT INTO channels (channel_id, name, type, is_private, position, created_at, owner_id, last_message_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		channelID, name, channelType, true, 0, now, owner, channelID)
+	for _, memberID := range memberIDs {
+		batch.Query(`INSERT INTO channel_members (channel_id, user_id, joined_at) VALUES (?, ?, ?)`, channelID, memberID, now)
+		batch.Query(`INSERT INTO private_channels_by_user (user_id, last_msg_at, channel_id) VALUES (?, ?, ?)`, memberID, channelID, channelID)
+	}
+	return db.Session.ExecuteBatch(batch)
+}
+
+// AddChannelMember ajoute un membre à un groupe privé.
+func AddChannelMember(channel *models.Channel, userID gocql.UUID) error {
+	batch := db.Session.NewBatch(gocql.LoggedBatch)
+	batch.Query(`INSERT INTO channel_members (channel_id, user_id, joined_at) VALUES (?, ?, ?)`, channel.ChannelID, userID, time.Now())
+	batch.Query(`INSERT INTO private_channels_by_user (user_id, last_msg_at, channel_id) VALUES (?, ?, ?)`, userID, lastMessageKey(channel), channel.ChannelID)
+	return db.Session.ExecuteBatch(batch)
+}
+
+// RemoveChannelMember retire un membre d'un groupe privé. newOwnerID, s'il n'est pas nul,
+// devient propriétaire du groupe (départ du propriétaire).
+func RemoveChannelMember(channel *models.Channel, userID, newOwnerID gocql.UUID) error {
+	batch := db.Session.NewBatch(gocql.LoggedBatch)
+	batch.Query(`DELETE FROM channel_members WHERE channel_id = ? AND user_id = ?`, channel.ChannelID, userID)
+	batch.Query(`DELETE FROM private_channels_by_user WHERE user_id = ? AND last_msg_at = ? AND channel_id = ?`, userID, lastMessageKey(channel), channel.ChannelID)
+	if newOwnerID != (gocql.UUID{}) {
+		batch.Query(`UPDATE channels SET owner_id = ? WHERE channel_id = ?`, newOwnerID, channel.ChannelID)
+	}
+	return db.Session.ExecuteBatch(batch)
+}
+
+// TouchPrivateChannel remonte un salon privé en tête de la sidebar de ses membres après
+// un nouveau message : last_msg_at étant une clé de clustering, l'ancienne ligne est
+// remplacée. En cas de messages concurrents, un doublon peut subsister ; il est ignoré
+// à la lecture par GetPrivateChannels.
+func TouchPrivateChannel(channel *models.Channel, memberIDs []gocql.UUID, messageID gocql.UUID) error {
+	previous := lastMessageKey(channel)
+	batch := db.Session.NewBatch(gocql.LoggedBatch)
+	batch.Query(`UPDATE channels SET last_message_id = ? WHERE channel_id = ?`, messageID, channel.ChannelID)
+	for _, memberID := range memberIDs {
+		batch.Query(`DELETE FROM private_channels_by_user WHERE user_id = ? AND last_msg_at = ? AND channel_id = ?`, memberID, previous, channel.ChannelID)
+		batch.Query(`INSERT INTO private_channels_by_user (user_id, last_msg_at, channel_id) VALUES (?, ?, ?)`, memberID, messageID, channel.ChannelID)
+	}
+	if err := db.Session.ExecuteBatch(batch); err != nil {
+		return err
+	}
+	channel.LastMessageID = messageID
+	return nil
+}
+
+// GetPrivateChannels liste les salons privés d'un utilisateur, du plus récemment actif au plus ancien.
+func GetPrivateChannels(userID gocql.UUID, limit int) ([]models.PrivateChannelByUser, error) {
+	channels := make([]models.PrivateChannelByUser, 0)
+	seen := make(map[gocql.UUID]bool)
+	iter := db.Session.Query(`SELECT last_msg_at, channel_id FROM private_channels_by_user WHERE user_id = ?`, userID).PageSize(limit).Iter()
+	var entry models.PrivateChannelByUser
+	for len(channels) < limit && iter.Scan(&entry.LastMsgAt, &entry.ChannelID) {
+		if !seen[entry.ChannelID] {
+			seen[entry.ChannelID] = true
+			entry.UserID = userID
+			channels = append(channels, entry)
+		}
+		entry = models.PrivateChannelByUser{}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return channels, nil
+}
+
+// lastMessageKey retourne la valeur courante de last_msg_at d'un salon privé.
+func lastMessageKey(channel *models.Channel) gocql.UUID {
+	if channel.LastMessageID != (gocql.UUID{}) {
+		return channel.LastMessageID
+	}
+	return channel.ChannelID
+}
@@ -0,0 +1,119 @@
+package dbTools
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Romain-GUILLEMOT/WhispyrBack/db"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
+	"github.com/gocql/gocql"
+)
+
+// ErrTooManyReactions est retournée quand un message a atteint le nombre maximal d'emojis distincts.
+var ErrTooManyReactions = errors.New("trop de réactions différentes sur ce message")
+
+const maxReactionsPerMessage = 20
+
+// AddReaction enregistre la réaction d'un utilisateur. Retourne false si elle existait déjà.
+// La LWT garantit que le compteur n'est incrémenté qu'une fois par utilisateur et par emoji.
+func AddReaction(channelID, messageID, userID gocql.UUID, emoji string) (bool, error) {
+	counts, err := getReactionCounts(channelID, messageID)
+	if err != nil {
+		return false, err
+	}
+	if _, known := counts[emoji]; !known && len(counts) >= maxReactionsPerMessage {
+		return false, ErrTooManyReactions
+	}
+
+	existing := map[string]interface{}{}
+	applied, err := db.Session.Query(
+		`INSERT INTO message_reactions (channel_id, message_id, emoji, user_id, reacted_at) VALUES (?, ?, ?, ?, ?) IF NOT EXISTS`,
+		channelID, messageID, emoji, userID, time.Now(),
+	).MapScanCAS(existing)
+	if err != nil || !applied {
+		return false, err
+	}
+
+	// Les compteurs ne peuvent pas être mis à jour dans un batch avec des tables classiques.
+	return true, db.Session.Query(
+		`UPDATE message_reaction_counts SET count = count + 1 WHERE channel_id = ? AND message_id = ? AND emoji = ?`,
+		channelID, messageID, emoji,
+	).Exec()
+}
+
+// RemoveReaction retire la réaction d'un utilisateur. Retourne false si elle n'existait pas.
+func RemoveReaction(channelID, messageID, userID gocql.UUID, emoji string) (bool, error) {
+	existing := map[string]interface{}{}
+	applied, err := db.Session.Query(
+		`DELETE FROM message_reactions WHERE channel_id = ? AND message_id = ? AND emoji = ? AND user_id = ? IF EXISTS`,
+		channelID, messageID, emoji, userID,
+	).MapScanCAS(existing)
+	if err != nil || !applied {
+		return false, err
+	}
+
+	return true, db.Session.Query(
+		`UPDATE message_reaction_counts SET count = count - 1 WHERE channel_id = ? AND message_id = ? AND emoji = ?`,
+		channelID, messageID, emoji,
+	).Exec()
+}
+
+// getReactionCounts retourne les compteurs strictement positifs d'un message, par emoji.
+func getReactionCounts(channelID, messageID gocql.UUID) (map[string]int64, error) {
+	counts := make(map[string]int64)
+	iter := db.Session.Query(`SELECT emoji, count FROM message_reaction_counts WHERE channel_id = ? AND message_id = ?`, channelID, messageID).Iter()
+	var emoji string
+	var count int64
+	for iter.Scan(&emoji, &count) {
+		if count > 0 {
+			counts[emoji] = count
+		}
+	}
+	return counts, iter.Close()
+}
+
+// GetReactions agrège les réactions d'une page de messages à partir des compteurs,
+// avec le drapeau "me" pour userID.
+func GetReactions(channelID gocql.UUID, messageIDs []gocql.UUID, userID gocql.UUID) (map[gocql.UUID][]models.ReactionCount, error) {
+	reactions := make(map[gocql.UUID][]models.ReactionCount)
+	if len(messageIDs) == 0 {
+		return reactions, nil
+	}
+
+	mine := make(map[gocql.UUID]map[string]bool)
+	iter := db.Session.Query(
+		`SELECT message_id, emoji FROM message_reactions WHERE channel_id = ? AND message_id IN ? AND user_id = ? ALLOW FILTERING`,
+		channelID, messageIDs, userID,
+	).Iter()
+	var messageID gocql.UUID
+	var emoji string
+	for iter.Scan(&messageID, &emoji) {
+		if mine[messageID] == nil {
+			mine[messageID] = make(map[string]bool)
+		}
+		mine[messageID][emoji] = true
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	iter = db.Session.Query(
+		`SELECT message_id, emoji, count FROM message_reaction_counts WHERE channel_id = ? AND message_id IN ?`,
+		channelID, messageIDs,
+	).Iter()
+	var count int64
+	for iter.Scan(&messageID, &emoji, &count) {
+		if count <= 0 {
+			continue
+		}
+		reactions[messageID] = append(reactions[messageID], models.ReactionCount{
+			Emoji: emoji,
+			Count: count,
+			Me:    mine[messageID][emoji],
+		})
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return reactions, nil
+}
@@ -0,0 +1,73 @@
+package dbTools
+
+import (
+	"github.com/Romain-GUILLEMOT/WhispyrBack/db"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
+	"github.com/gocql/gocql"
+)
+
+// GetReadState retourne l'état de lecture d'un salon pour un utilisateur (gocql.ErrNotFound si jamais acquitté).
+func GetReadState(userID, channelID gocql.UUID) (*models.ReadState, error) {
+	state := models.ReadState{UserID: userID, ChannelID: channelID}
+	if err := db.Session.Query(`SELECT server_id, last_read_message_id, mention_count FROM read_states WHERE user_id = ? AND channel_id = ?`, userID, channelID).
+		Scan(&state.ServerID, &state.LastReadMessageID, &state.MentionCount); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// GetReadStates retourne tous les états de lecture d'un utilisateur, indexés par salon.
+func GetReadStates(userID gocql.UUID) (map[gocql.UUID]*models.ReadState, error) {
+	states := make(map[gocql.UUID]*models.ReadState)
+	iter := db.Session.Query(`SELECT channel_id, server_id, last_read_message_id, mention_count FROM read_states WHERE user_id = ?`, userID).Iter()
+	state := models.ReadState{UserID: userID}
+	for iter.Scan(&state.ChannelID, &state.ServerID, &state.LastReadMessageID, &state.MentionCount) {
+		current := state
+		states[state.ChannelID] = &current
+		state = models.ReadState{UserID: userID}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return states, nil
+}
+
+// AckChannel marque messageID comme dernier message lu et remet les mentions à zéro.
+// serverID est nul pour un salon privé.
+func AckChannel(userID, channelID, serverID, messageID gocql.UUID) error {
+	return db.Session.Query(`INSERT INTO read_states (user_id, channel_id, server_id, last_read_message_id, mention_count) VALUES (?, ?, ?, ?, 0)`,
+		userID, channelID, nullableUUID(serverID), messageID).Exec()
+}
+
+// RecordChannelActivity enregistre messageID comme dernier message du salon (salons de
+// serveur uniquement) et l'acquitte pour son auteur.
+func RecordChannelActivity(serverID, channelID, senderID, messageID gocql.UUID) error {
+	batch := db.Session.NewBatch(gocql.LoggedBatch)
+	if serverID != (gocql.UUID{}) {
+		batch.Query(`INSERT INTO channel_last_messages (server_id, channel_id, last_message_id) VALUES (?, ?, ?)`, serverID, channelID, messageID)
+	}
+	batch.Query(`INSERT INTO read_states (user_id, channel_id, server_id, last_read_message_id, mention_count) VALUES (?, ?, ?, ?, 0)`,
+		senderID, channelID, nullableUUID(serverID), messageID)
+	return db.Session.ExecuteBatch(batch)
+}
+
+// GetChannelLastMessages retourne le dernier message de chaque salon d'un serveur.
+func GetChannelLastMessages(serverID gocql.UUID) (map[gocql.UUID]gocql.UUID, error) {
+	lastMessages := make(map[gocql.UUID]gocql.UUID)
+	iter := db.Session.Query(`SELECT channel_id, last_message_id FROM channel_last_messages WHERE server_id = ?`, serverID).Iter()
+	var channelID, messageID gocql.UUID
+	for iter.Scan(&channelID, &messageID) {
+		lastMessages[channelID] = messageID
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return lastMessages, nil
+}
+
+func nullableUUID(id gocql.UUID) interface{} {
+	if id == (gocql.UUID{}) {
+		return nil
+	}
+	return id
+}
@@ -0,0 +1,110 @@
+package dbTools
+
+import (
+	"time"
+
+	"github.com/Romain-GUILLEMOT/WhispyrBack/db"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
+	"github.com/gocql/gocql"
+)
+
+// GetRelationship retourne la relation de userID envers targetID (gocql.ErrNotFound si aucune).
+func GetRelationship(userID, targetID gocql.UUID) (*models.Relationship, error) {
+	relationship := models.Relationship{UserID: userID, TargetID: targetID}
+	if err := db.Session.Query(`SELECT type, created_at FROM relationships WHERE user_id = ? AND target_id = ?`, userID, targetID).
+		Scan(&relationship.Type, &relationship.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &relationship, nil
+}
+
+// GetRelationships liste toutes les relations d'un utilisateur.
+func GetRelationships(userID gocql.UUID) ([]models.Relationship, error) {
+	relationships := make([]models.Relationship, 0)
+	iter := db.Session.Query(`SELECT target_id, type, created_at FROM relationships WHERE user_id = ?`, userID).Iter()
+	relationship := models.Relationship{UserID: userID}
+	for iter.Scan(&relationship.TargetID, &relationship.Type, &relationship.CreatedAt) {
+		relationships = append(relationships, relationship)
+		relationship = models.Relationship{UserID: userID}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return relationships, nil
+}
+
+// GetFriendIDs retourne les IDs des amis d'un utilisateur.
+func GetFriendIDs(userID gocql.UUID) ([]gocql.UUID, error) {
+	relationships, err := GetRelationships(userID)
+	if err != nil {
+		return nil, err
+	}
+	friends := make([]gocql.UUID, 0, len(relationships))
+	for _, relationship := range relationships {
+		if relationship.Type == models.RelationshipFriend {
+			friends = append(friends, relationship.TargetID)
+		}
+	}
+	return friends, nil
+}
+
+// IsBlocked indique si l'un des deux utilisateurs a bloqué l'autre.
+func IsBlocked(userID, otherID gocql.UUID) (bool, error) {
+	for _, pair := range [][2]gocql.UUID{{userID, otherID}, {otherID, userID}} {
+		relationship, err := GetRelationship(pair[0], pair[1])
+		if err == gocql.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		if relationship.Type == models.RelationshipBlocked {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// SendFriendRequest enregistre une demande d'ami de userID vers targetID (des deux côtés).
+func SendFriendRequest(userID, targetID gocql.UUID) error {
+	return setRelationshipPair(userID, targetID, models.RelationshipOutgoing, models.RelationshipIncoming)
+}
+
+// AcceptFriendRequest transforme une demande en amitié (des deux côtés).
+func AcceptFriendRequest(userID, targetID gocql.UUID) error {
+	return setRelationshipPair(userID, targetID, models.RelationshipFriend, models.RelationshipFriend)
+}
+
+// DeleteRelationship supprime une amitié ou une demande en attente des deux côtés.
+// Ne doit pas être utilisé sur un blocage : la ligne de l'autre côté n'est pas vérifiée.
+func DeleteRelationship(userID, targetID gocql.UUID) error {
+	batch := db.Session.NewBatch(gocql.LoggedBatch)
+	batch.Query(`DELETE FROM relationships WHERE user_id = ? AND target_id = ?`, userID, targetID)
+	batch.Query(`DELETE FROM relationships WHERE user_id = ? AND target_id = ?`, targetID, userID)
+	return db.Session.ExecuteBatch(batch)
+}
+
+// BlockUser bloque targetID. Toute amitié ou demande est supprimée côté cible, sauf si
+// la cible a elle-même bloqué userID (keepTargetSide).
+func BlockUser(userID, targetID gocql.UUID, keepTargetSide bool) error {
+	batch := db.Session.NewBatch(gocql.LoggedBatch)
+	batch.Query(`INSERT INTO relationships (user_id, target_id, type, created_at) VALUES (?, ?, ?, ?)`,
+		userID, targetID, models.RelationshipBlocked, time.Now())
+	if !keepTargetSide {
+		batch.Query(`DELETE FROM relationships WHERE user_id = ? AND target_id = ?`, targetID, userID)
+	}
+	return db.Session.ExecuteBatch(batch)
+}
+
+// UnblockUser lève le blocage de targetID par userID.
+func UnblockUser(userID, targetID gocql.UUID) error {
+	return db.Session.Query(`DELETE FROM relationships WHERE user_id = ? AND target_id = ?`, userID, targetID).Exec()
+}
+
+func setRelationshipPair(userID, targetID gocql.UUID, userSide, targetSide string) error {
+	now := time.Now()
+	batch := db.Session.NewBatch(gocql.LoggedBatch)
+	batch.Query(`INSERT INTO relationships (user_id, target_id, type, created_at) VALUES (?, ?, ?, ?)`, userID, targetID, userSide, now)
+	batch.Query(`INSERT INTO relationships (user_id, target_id, type, created_at) VALUES (?, ?, ?, ?)`, targetID, userID, targetSide, now)
+	return db.Session.ExecuteBatch(batch)
+}
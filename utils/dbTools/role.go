@@ -0,0 +1,81 @@
+package dbTools
+
+import (
+	"sort"
+
+	"github.com/Romain-GUILLEMOT/WhispyrBack/db"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
+	"github.com/gocql/gocql"
+)
+
+// GetServerRoles récupère tous les rôles d'un serveur, triés par position décroissante.
+func GetServerRoles(serverID gocql.UUID) ([]models.ServerRole, error) {
+	roles := make([]models.ServerRole, 0)
+	iter := db.Session.Query(`SELECT role, color, position, permissions FROM server_roles WHERE server_id = ?`, serverID).Iter()
+	var role models.ServerRole
+	for iter.Scan(&role.Role, &role.Color, &role.Position, &role.Permissions) {
+		role.ServerID = serverID
+		roles = append(roles, role)
+		role = models.ServerRole{}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(roles, func(i, j int) bool {
+		return roles[i].Position > roles[j].Position
+	})
+	return roles, nil
+}
+
+// GetServerRole récupère un rôle par son nom. Retourne gocql.ErrNotFound s'il n'existe pas.
+func GetServerRole(serverID gocql.UUID, name string) (*models.ServerRole, error) {
+	role := models.ServerRole{ServerID: serverID}
+	if err := db.Session.Query(`SELECT role, color, position, permissions FROM server_roles WHERE server_id = ? AND role = ? LIMIT 1`,
+		serverID, name).Scan(&role.Role, &role.Color, &role.Position, &role.Permissions); err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// SaveServerRole crée ou remplace un rôle.
+func SaveServerRole(role models.ServerRole) error {
+	return db.Session.Query(`INSERT INTO server_roles (server_id, role, color, position, permissions) VALUES (?, ?, ?, ?, ?)`,
+		role.ServerID, role.Role, role.Color, role.Position, role.Permissions).Exec()
+}
+
+// SetMemberRole change le rôle d'un membre en gardant user_servers et server_members synchronisés.
+// Attribuer un rôle rend une adhésion temporaire définitive.
+func SetMemberRole(serverID, userID gocql.UUID, role string) error {
+	batch := db.Session.NewBatch(gocql.LoggedBatch)
+	batch.Query(`UPDATE user_servers SET role = ?, temporary = false WHERE user_id = ? AND server_id = ?`, role, userID, serverID)
+	batch.Query(`UPDATE server_members SET role = ?, temporary = false WHERE server_id = ? AND user_id = ?`, role, serverID, userID)
+	return db.Session.ExecuteBatch(batch)
+}
+
+// DeleteServerRole supprime un rôle et ses surcharges de salon, et rétrograde ses membres au rôle "member".
+func DeleteServerRole(serverID gocql.UUID, name string) error {
+	var memberIDs []gocql.UUID
+	iter := db.Session.Query(`SELECT user_id, role FROM server_members WHERE server_id = ?`, serverID).Iter()
+	var memberID gocql.UUID
+	var memberRole string
+	for iter.Scan(&memberID, &memberRole) {
+		if memberRole == name {
+			memberIDs = append(memberIDs, memberID)
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return err
+	}
+
+	batch := db.Session.NewBatch(gocql.LoggedBatch)
+	batch.Query(`DELETE FROM server_roles WHERE server_id = ? AND role = ?`, serverID, name)
+	for _, id := range memberIDs {
+		batch.Query(`UPDATE user_servers SET role = ? WHERE user_id = ? AND server_id = ?`, models.RoleMember, id, serverID)
+		batch.Query(`UPDATE server_members SET role = ? WHERE server_id = ? AND user_id = ?`, models.RoleMember, serverID, id)
+	}
+	if err := db.Session.ExecuteBatch(batch); err != nil {
+		return err
+	}
+	return DeleteRoleOverwrites(serverID, name)
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/Romain-GUILLEMOT/WhispyrBack/db"
 	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
 	"github.com/gocql/gocql"
+	"time"
 )
 
 // GetServerByID récupère un serveur et son nom par son ID.
@@ -27,3 +28,155 @@ func GetServerByID(id string) (*models.Server, error) {
 
 	return &server, nil
 }
+
+// IsServerMember vérifie la présence d'un utilisateur dans server_members.
+func IsServerMember(serverID, userID gocql.UUID) (bool, error) {
+	var found gocql.UUID
+	if err := db.Session.Query(`SELECT user_id FROM server_members WHERE server_id = ? AND user_id = ? LIMIT 1`, serverID, userID).Scan(&found); err != nil {
+		if err == gocql.ErrNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// CountServerMembers retourne le nombre de membres d'un serveur.
+func CountServerMembers(serverID gocql.UUID) (int, error) {
+	var count int
+	if err := db.Session.Query(`SELECT count(*) FROM server_members WHERE server_id = ?`, serverID).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// AddServerMember ajoute un utilisateur comme "member" d'un serveur, dans
+// user_servers et server_members (dénormalisés avec pseudo et avatars).
+func AddServerMember(serverID, userID gocql.UUID, serverAvatar string, temporary bool) error {
+	var username, userAvatar string
+	if err := db.Session.Query(`SELECT username, avatar FROM users WHERE id = ?`, userID).Scan(&username, &userAvatar); err != nil {
+		return err
+	}
+
+	joinedAt := time.Now()
+	batch := db.Session.NewBatch(gocql.LoggedBatch)
+	batch.Query(`INSERT INTO user_servers (user_id, server_id, role, joined_at, server_avatar, temporary) VALUES (?, ?, ?, ?, ?, ?)`,
+		userID, serverID, models.RoleMember, joinedAt, serverAvatar, temporary)
+	batch.Query(`INSERT INTO server_members (server_id, user_id, role, joined_at, username, avatar, temporary) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		serverID, userID, models.RoleMember, joinedAt, username, userAvatar, temporary)
+	return db.Session.ExecuteBatch(batch)
+}
+
+// RemoveTemporaryMemberships retire l'utilisateur des serveurs rejoints via une
+// invitation temporaire et où aucun rôle ne lui a été attribué depuis.
+func RemoveTemporaryMemberships(userID gocql.UUID) error {
+	var serverIDs []gocql.UUID
+	iter := db.Session.Query(`SELECT server_id, role, temporary FROM user_servers WHERE user_id = ?`, userID).Iter()
+	var serverID gocql.UUID
+	var role string
+	var temporary bool
+	for iter.Scan(&serverID, &role, &temporary) {
+		if temporary && role == models.RoleMember {
+			serverIDs = append(serverIDs, serverID)
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return err
+	}
+	if len(serverIDs) == 0 {
+		return nil
+	}
+
+	batch := db.Session.NewBatch(gocql.LoggedBatch)
+	for _, id := range serverIDs {
+		batch.Query(`DELETE FROM user_servers WHERE user_id = ? AND server_id = ?`, userID, id)
+		batch.Query(`DELETE FROM server_members WHERE server_id = ? AND user_id = ?`, id, userID)
+	}
+	return db.Session.ExecuteBatch(batch)
+}
+
+// RemoveServerMember retire un utilisateur d'un serveur (user_servers + server_members).
+func RemoveServerMember(serverID, userID gocql.UUID) error {
+	batch := db.Session.NewBatch(gocql.LoggedBatch)
+	batch.Query(`DELETE FROM user_servers WHERE user_id = ? AND server_id = ?`, userID, serverID)
+	batch.Query(`DELETE FROM server_members WHERE server_id = ? AND user_id = ?`, serverID, userID)
+	return db.Session.ExecuteBatch(batch)
+}
+
+// TransferOwnership transfère la propriété d'un serveur dans un batch unique :
+// servers.owner_id est mis à jour et les rôles sont échangés dans user_servers
+// et server_members. L'ancien propriétaire est rétrogradé au rôle "admin",
+// créé avec la permission ADMINISTRATOR s'il n'existe pas encore. Un rôle "admin"
+// existant se voit ajouter ADMINISTRATOR.
+func TransferOwnership(serverID, oldOwnerID, newOwnerID gocql.UUID) error {
+	batch := db.Session.NewBatch(gocql.LoggedBatch)
+
+	if _, err := GetServerRole(serverID, models.RoleAdmin); err == nil {
+		batch.Query(`UPDATE server_roles SET permissions = permissions + ? WHERE server_id = ? AND role = ?`,
+			[]string{models.PermAdministrator}, serverID, models.RoleAdmin)
+	} else {
+		if err != gocql.ErrNotFound {
+			return err
+		}
+		roles, err := GetServerRoles(serverID)
+		if err != nil {
+			return err
+		}
+		position := 1
+		if len(roles) > 0 && roles[0].Position >= position {
+			position = roles[0].Position + 1
+		}
+		batch.Query(`INSERT INTO server_roles (server_id, role, color, position, permissions) VALUES (?, ?, ?, ?, ?)`,
+			serverID, models.RoleAdmin, "", position, []string{models.PermAdministrator})
+	}
+
+	batch.Query(`UPDATE servers SET owner_id = ? WHERE server_id = ?`, newOwnerID, serverID)
+	batch.Query(`UPDATE user_servers SET role = ?, temporary = false WHERE user_id = ? AND server_id = ?`, models.RoleOwner, newOwnerID, serverID)
+	batch.Query(`UPDATE server_members SET role = ?, temporary = false WHERE server_id = ? AND user_id = ?`, models.RoleOwner, serverID, newOwnerID)
+	batch.Query(`UPDATE user_servers SET role = ? WHERE user_id = ? AND server_id = ?`, models.RoleAdmin, oldOwnerID, serverID)
+	batch.Query(`UPDATE server_members SET role = ? WHERE server_id = ? AND user_id = ?`, models.RoleAdmin, serverID, oldOwnerID)
+	return db.Session.ExecuteBatch(batch)
+}
+
+// GetUserServerIDs retourne les serveurs dont l'utilisateur est membre.
+func GetUserServerIDs(userID gocql.UUID) ([]gocql.UUID, error) {
+	serverIDs := make([]gocql.UUID, 0)
+	iter := db.Session.Query(`SELECT server_id FROM user_servers WHERE user_id = ?`, userID).Iter()
+	var serverID gocql.UUID
+	for iter.Scan(&serverID) {
+		serverIDs = append(serverIDs, serverID)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return serverIDs, nil
+}
+
+// GetServerMemberIDs retourne les IDs des membres d'un serveur.
+func GetServerMemberIDs(serverID gocql.UUID) ([]gocql.UUID, error) {
+	memberIDs := make([]gocql.UUID, 0)
+	iter := db.Session.Query(`SELECT user_id FROM server_members WHERE server_id = ?`, serverID).Iter()
+	var userID gocql.UUID
+	for iter.Scan(&userID) {
+		memberIDs = append(memberIDs, userID)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return memberIDs, nil
+}
+
+// GetServerMemberRoles retourne le rôle (server_members.role) de chaque membre d'un serveur.
+func GetServerMemberRoles(serverID gocql.UUID) (map[gocql.UUID]string, error) {
+	roles := make(map[gocql.UUID]string)
+	iter := db.Session.Query(`SELECT user_id, role FROM server_members WHERE server_id = ?`, serverID).Iter()
+	var userID gocql.UUID
+	var role string
+	for iter.Scan(&userID, &role) {
+		roles[userID] = role
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
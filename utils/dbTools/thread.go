@@ -0,0 +1,89 @@
+package dbTools
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Romain-GUILLEMOT/WhispyrBack/db"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
+	"github.com/gocql/gocql"
+)
+
+// ErrThreadExists est retournée quand un thread a déjà été ouvert depuis le message.
+var ErrThreadExists = errors.New("un thread existe déjà pour ce message")
+
+// CreateThread ouvre un thread depuis un message du salon parent. Le thread est un salon
+// à part entière (ses messages ont leurs propres partitions) mais n'apparaît pas dans
+// channels_by_server : il est listé via threads_by_channel.
+func CreateThread(parent *models.Channel, parentMessageID, creatorID gocql.UUID, name string, autoArchiveAfter int) (*models.ThreadByChannel, error) {
+	now := time.Now()
+	threadID := gocql.UUIDFromTime(now)
+
+	// La LWT garantit qu'un message n'ouvre qu'un seul thread, même en cas de requêtes concurrentes.
+	var currentThreadID gocql.UUID
+	applied, err := db.Session.Query(
+		`UPDATE messages_by_channel SET thread_id = ? WHERE channel_id = ? AND day_bucket = ? AND sent_at = ? IF thread_id = null`,
+		threadID, parent.ChannelID, models.DayBucketOf(parentMessageID), parentMessageID,
+	).ScanCAS(&currentThreadID)
+	if err != nil {
+		return nil, err
+	}
+	if !applied {
+		return nil, ErrThreadExists
+	}
+
+	batch := db.Session.NewBatch(gocql.LoggedBatch)
+	batch.Query(`INSERT INTO channels (channel_id, server_id, category_id, name, type, is_private, position, created_at,
+		parent_channel_id, parent_message_id, archived, auto_archive_after, last_activity_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		threadID, parent.ServerID, parent.CategoryID, name, "text", parent.IsPrivate, 0, now,
+		parent.ChannelID, parentMessageID, false, autoArchiveAfter, now)
+	batch.Query(`INSERT INTO threads_by_channel (parent_channel_id, thread_id, parent_message_id, name, creator_id, archived, auto_archive_after) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		parent.ChannelID, threadID, parentMessageID, name, creatorID, false, autoArchiveAfter)
+	if err := db.Session.ExecuteBatch(batch); err != nil {
+		return nil, err
+	}
+
+	return &models.ThreadByChannel{
+		ParentChannelID:  parent.ChannelID,
+		ThreadID:         threadID,
+		ParentMessageID:  parentMessageID,
+		Name:             name,
+		CreatorID:        creatorID,
+		AutoArchiveAfter: autoArchiveAfter,
+	}, nil
+}
+
+// GetChannelThreads liste les threads d'un salon, du plus récent au plus ancien,
+// filtrés selon leur état d'archivage.
+func GetChannelThreads(parentChannelID gocql.UUID, archived bool) ([]models.ThreadByChannel, error) {
+	threads := make([]models.ThreadByChannel, 0)
+	iter := db.Session.Query(
+		`SELECT thread_id, parent_message_id, name, creator_id, archived, auto_archive_after FROM threads_by_channel WHERE parent_channel_id = ?`,
+		parentChannelID,
+	).Iter()
+	var thread models.ThreadByChannel
+	for iter.Scan(&thread.ThreadID, &thread.ParentMessageID, &thread.Name, &thread.CreatorID, &thread.Archived, &thread.AutoArchiveAfter) {
+		if thread.Archived == archived {
+			thread.ParentChannelID = parentChannelID
+			threads = append(threads, thread)
+		}
+		thread = models.ThreadByChannel{}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return threads, nil
+}
+
+// SetThreadArchived archive ou désarchive un thread dans channels et threads_by_channel.
+func SetThreadArchived(thread *models.Channel, archived bool) error {
+	batch := db.Session.NewBatch(gocql.LoggedBatch)
+	batch.Query(`UPDATE channels SET archived = ? WHERE channel_id = ?`, archived, thread.ChannelID)
+	batch.Query(`UPDATE threads_by_channel SET archived = ? WHERE parent_channel_id = ? AND thread_id = ?`, archived, thread.ParentChannelID, thread.ChannelID)
+	return db.Session.ExecuteBatch(batch)
+}
+
+// TouchThread enregistre la dernière activité d'un thread.
+func TouchThread(threadID gocql.UUID, at time.Time) error {
+	return db.Session.Query(`UPDATE channels SET last_activity_at = ? WHERE channel_id = ?`, at, threadID).Exec()
+}
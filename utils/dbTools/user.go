@@ -28,3 +28,21 @@ func GetUserByID(id *uuid.UUID) (*models.User, error) {
 
 	return &user, nil
 }
+
+// UpdateUserAvatar change l'avatar d'un utilisateur dans users et dans les tables de lookup.
+func UpdateUserAvatar(userID gocql.UUID, user *models.User, avatarURL string) error {
+	batch := db.Session.NewBatch(gocql.LoggedBatch)
+	batch.Query(`UPDATE users SET avatar = ? WHERE id = ?`, avatarURL, userID)
+	batch.Query(`UPDATE users_by_email SET avatar = ? WHERE email = ?`, avatarURL, user.Email)
+	batch.Query(`UPDATE users_by_username SET avatar = ? WHERE username = ?`, avatarURL, user.Username)
+	return db.Session.ExecuteBatch(batch)
+}
+
+// GetUserByUsername récupère un utilisateur via la table de lookup users_by_username.
+func GetUserByUsername(username string) (*models.UserByUsername, error) {
+	user := models.UserByUsername{Username: username}
+	if err := db.Session.Query(`SELECT id, avatar FROM users_by_username WHERE username = ? LIMIT 1`, username).Scan(&user.ID, &user.Avatar); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
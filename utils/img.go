@@ -53,7 +53,10 @@ func ConvertToWebP(file multipart.File, contentType string) (*bytes.Buffer, erro
 		img = imaging.Rotate90(img)
 	}
 
-	img = imaging.Resize(img, 1280, 0, imaging.Lanczos)
+	// On réduit les images trop larges, sans jamais agrandir les petites.
+	if img.Bounds().Dx() > 1280 {
+		img = imaging.Resize(img, 1280, 0, imaging.Lanczos)
+	}
 
 	out := new(bytes.Buffer)
 	if err := webp.Encode(out, img, &webp.Options{
@@ -1,16 +1,43 @@
 package utils
 
 import (
+	_ "embed"
 	"errors"
 	"fmt"
 	"github.com/Romain-GUILLEMOT/WhispyrBack/config"
-	"github.com/disposable/disposable"
 	"gopkg.in/gomail.v2"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
+// Liste des domaines d'emails jetables, embarquée dans le binaire pour ne pas dépendre
+// du répertoire de travail. Elle n'est analysée qu'à la première vérification.
+//
+//go:embed domains.txt
+var disposableDomainsList string
+
+var (
+	disposableDomains     map[string]struct{}
+	disposableDomainsOnce sync.Once
+)
+
+// isDisposableDomain indique si le domaine fait partie de la liste des emails jetables.
+func isDisposableDomain(domain string) bool {
+	disposableDomainsOnce.Do(func() {
+		lines := strings.Split(disposableDomainsList, "\n")
+		disposableDomains = make(map[string]struct{}, len(lines))
+		for _, line := range lines {
+			if line = strings.TrimSpace(line); line != "" {
+				disposableDomains[line] = struct{}{}
+			}
+		}
+	})
+	_, ok := disposableDomains[domain]
+	return ok
+}
+
 func InitMailer() {
 	cfg := config.GetConfig()
 	num, err := strconv.Atoi(cfg.SmtpPort)
@@ -63,7 +90,7 @@ func GetEmailDomain(email string) error {
 	}
 
 	domain := strings.ToLower(email[atIndex+1:])
-	if disposable.Domain(domain) {
+	if isDisposableDomain(domain) {
 		return errors.New("Les adresses email jetables ne sont pas autorisées.")
 	}
 	return nil
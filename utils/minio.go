@@ -2,6 +2,13 @@ package utils
 
 import (
 	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/Romain-GUILLEMOT/WhispyrBack/config"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
@@ -78,3 +85,47 @@ func DeleteObjects(ctx context.Context, objectNames []string) {
 	}
 	Info("Finished bulk deletion process.", "attempted_count", len(objectNames))
 }
+
+// PresignPutObject génère une URL PUT présignée dont la signature couvre le Content-Type
+// et le Content-Length : le client doit envoyer exactement ces en-têtes, ce qui impose
+// le type et la taille du fichier sans le faire transiter par l'API.
+func PresignPutObject(ctx context.Context, objectName, contentType string, size int64, expires time.Duration) (*url.URL, http.Header, error) {
+	headers := http.Header{}
+	headers.Set("Content-Type", contentType)
+	headers.Set("Content-Length", strconv.FormatInt(size, 10))
+	u, err := MinioClient.PresignHeader(ctx, http.MethodPut, config.GetConfig().MinioBucket, objectName, expires, nil, headers)
+	return u, headers, err
+}
+
+// StatObject récupère les métadonnées d'un objet (requête HEAD).
+func StatObject(ctx context.Context, objectName string) (minio.ObjectInfo, error) {
+	return MinioClient.StatObject(ctx, config.GetConfig().MinioBucket, objectName, minio.StatObjectOptions{})
+}
+
+// ReadObjectHead lit au plus les n premiers octets d'un objet (requête Range).
+func ReadObjectHead(ctx context.Context, objectName string, n int64) ([]byte, error) {
+	opts := minio.GetObjectOptions{}
+	if err := opts.SetRange(0, n-1); err != nil {
+		return nil, err
+	}
+	object, err := MinioClient.GetObject(ctx, config.GetConfig().MinioBucket, objectName, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+	return io.ReadAll(io.LimitReader(object, n))
+}
+
+// GetObject ouvre un objet en lecture. L'appelant doit le fermer.
+func GetObject(ctx context.Context, objectName string) (*minio.Object, error) {
+	return MinioClient.GetObject(ctx, config.GetConfig().MinioBucket, objectName, minio.GetObjectOptions{})
+}
+
+// ObjectKeyFromURL retrouve la clé d'un objet à partir de son URL publique (vide si l'URL n'est pas servie par MinIO).
+func ObjectKeyFromURL(objectURL string) string {
+	prefix := config.GetConfig().MinioURL + "/"
+	if !strings.HasPrefix(objectURL, prefix) {
+		return ""
+	}
+	return strings.TrimPrefix(objectURL, prefix)
+}
@@ -91,6 +91,97 @@ func RedisSetWithTTL(ctx context.Context, key string, value interface{}, ttl tim
 	return Redis.Set(ctx, key, value, ttl).Err()
 }
 
+// RedisZAdd ajoute (ou met à jour le score d') un membre d'un ensemble trié.
+func RedisZAdd(ctx context.Context, key string, score float64, member string) error {
+	return Redis.ZAdd(ctx, key, redis.Z{Score: score, Member: member}).Err()
+}
+
+// RedisZAddGT ajoute un membre à un ensemble trié, ou relève son score s'il est supérieur
+// au score actuel (jamais abaissé).
+func RedisZAddGT(ctx context.Context, key string, score float64, member string) error {
+	return Redis.ZAddGT(ctx, key, redis.Z{Score: score, Member: member}).Err()
+}
+
+// RedisZRangeByMaxScore retourne les membres d'un ensemble trié dont le score est inférieur ou égal à max.
+func RedisZRangeByMaxScore(ctx context.Context, key string, max float64) ([]string, error) {
+	return Redis.ZRangeByScore(ctx, key, &redis.ZRangeBy{Min: "-inf", Max: strconv.FormatFloat(max, 'f', -1, 64)}).Result()
+}
+
+// RedisZRem retire des membres d'un ensemble trié et retourne le nombre de membres effectivement retirés.
+func RedisZRem(ctx context.Context, key string, members ...interface{}) (int64, error) {
+	return Redis.ZRem(ctx, key, members...).Result()
+}
+
+// RedisZRangeByMinScore retourne les membres d'un ensemble trié dont le score est strictement supérieur à min.
+func RedisZRangeByMinScore(ctx context.Context, key string, min float64) ([]string, error) {
+	return Redis.ZRangeByScore(ctx, key, &redis.ZRangeBy{Min: "(" + strconv.FormatFloat(min, 'f', -1, 64), Max: "+inf"}).Result()
+}
+
+// RedisZAddExpiring ajoute un membre à un ensemble trié avec pour score son échéance
+// (maintenant + ttl), purge les membres échus et repousse l'expiration de la clé.
+func RedisZAddExpiring(ctx context.Context, key, member string, ttl time.Duration) error {
+	now := time.Now()
+	pipe := Redis.TxPipeline()
+	pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(now.UnixMilli(), 10))
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(now.Add(ttl).UnixMilli()), Member: member})
+	pipe.Expire(ctx, key, ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// RedisGetDel lit puis supprime une clé de manière atomique.
+func RedisGetDel(ctx context.Context, key string) (string, error) {
+	return Redis.GetDel(ctx, key).Result()
+}
+
+// RedisSMembers retourne les membres d'un ensemble (vide si la clé n'existe pas).
+func RedisSMembers(ctx context.Context, key string) ([]string, error) {
+	return Redis.SMembers(ctx, key).Result()
+}
+
+// RedisSAddWithTTL remplit un ensemble et fixe sa durée de vie de manière atomique.
+func RedisSAddWithTTL(ctx context.Context, key string, ttl time.Duration, members ...interface{}) error {
+	pipe := Redis.TxPipeline()
+	pipe.SAdd(ctx, key, members...)
+	pipe.Expire(ctx, key, ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// RedisRPushCapped ajoute des valeurs en fin de liste, ne garde que les max dernières et
+// repousse l'expiration de la clé.
+func RedisRPushCapped(ctx context.Context, key string, max int64, ttl time.Duration, values ...interface{}) error {
+	pipe := Redis.TxPipeline()
+	pipe.RPush(ctx, key, values...)
+	pipe.LTrim(ctx, key, -max, -1)
+	pipe.Expire(ctx, key, ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// RedisLRangeAll retourne tous les éléments d'une liste (vide si la clé n'existe pas).
+func RedisLRangeAll(ctx context.Context, key string) ([]string, error) {
+	return Redis.LRange(ctx, key, 0, -1).Result()
+}
+
+// RedisZCountByMinScore compte, pour chaque ensemble trié, les membres dont le score est
+// strictement supérieur à min (une seule aller-retour).
+func RedisZCountByMinScore(ctx context.Context, keys []string, min float64) ([]int64, error) {
+	pipe := Redis.Pipeline()
+	cmds := make([]*redis.IntCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.ZCount(ctx, key, "("+strconv.FormatFloat(min, 'f', -1, 64), "+inf")
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	counts := make([]int64, len(keys))
+	for i, cmd := range cmds {
+		counts[i] = cmd.Val()
+	}
+	return counts, nil
+}
+
 func extractTokenFromKey(fullKey string) string {
 	parts := strings.SplitN(fullKey, ":", 2)
 	if len(parts) == 2 {
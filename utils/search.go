@@ -0,0 +1,141 @@
+package utils
+
+import (
+	"github.com/Romain-GUILLEMOT/WhispyrBack/config"
+	"github.com/Romain-GUILLEMOT/WhispyrBack/models"
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+var SearchIndex bleve.Index
+
+// SearchInit ouvre (ou crée) l'index Bleve des messages sur le disque local.
+// Seuls les messages écrits après sa création sont indexés.
+func SearchInit() {
+	path := config.GetConfig().SearchIndexPath
+	if path == "" {
+		path = "data/search.bleve"
+	}
+
+	index, err := bleve.Open(path)
+	if err == bleve.ErrorIndexPathDoesNotExist {
+		index, err = bleve.New(path, searchMapping())
+	}
+	if err != nil {
+		Fatal("❌ Ouverture de l'index de recherche impossible: %v", err)
+	}
+	SearchIndex = index
+}
+
+// searchMapping décrit les champs de models.SearchDocument : identifiants en mots-clés
+// (égalité stricte), contenu analysé pour la recherche plein texte.
+func searchMapping() *mapping.IndexMappingImpl {
+	keyword := bleve.NewKeywordFieldMapping()
+	keyword.Store = false
+	storedKeyword := bleve.NewKeywordFieldMapping() // Relu avec le résultat pour charger le message
+
+	content := bleve.NewTextFieldMapping()
+	content.Analyzer = "standard"
+	content.Store = false
+
+	document := bleve.NewDocumentStaticMapping()
+	document.AddFieldMappingsAt("server_id", keyword)
+	document.AddFieldMappingsAt("channel_id", storedKeyword)
+	document.AddFieldMappingsAt("access_channel_id", keyword)
+	document.AddFieldMappingsAt("author_id", keyword)
+	document.AddFieldMappingsAt("mentions", keyword)
+	document.AddFieldMappingsAt("content", content)
+	document.AddFieldMappingsAt("sent_at", bleve.NewDateTimeFieldMapping())
+	document.AddFieldMappingsAt("has_attachment", bleve.NewBooleanFieldMapping())
+
+	indexMapping := bleve.NewIndexMapping()
+	indexMapping.DefaultMapping = document
+	return indexMapping
+}
+
+// SearchIndexMessage indexe (ou réindexe) un message sous son ID.
+func SearchIndexMessage(messageID string, document models.SearchDocument) error {
+	if SearchIndex == nil {
+		return nil
+	}
+	return SearchIndex.Index(messageID, document)
+}
+
+// SearchDeleteMessage retire un message de l'index.
+func SearchDeleteMessage(messageID string) error {
+	if SearchIndex == nil {
+		return nil
+	}
+	return SearchIndex.Delete(messageID)
+}
+
+// SearchHit identifie un message trouvé.
+type SearchHit struct {
+	MessageID string
+	ChannelID string
+}
+
+// SearchMessages exécute une recherche, du message le plus récent au plus ancien, et
+// retourne la page demandée ainsi que le nombre total de résultats.
+func SearchMessages(q models.SearchQuery) ([]SearchHit, uint64, error) {
+	if SearchIndex == nil || len(q.AccessChannelIDs) == 0 {
+		return nil, 0, nil
+	}
+
+	conjuncts := []query.Query{termQuery("server_id", q.ServerID)}
+
+	access := make([]query.Query, 0, len(q.AccessChannelIDs))
+	for _, channelID := range q.AccessChannelIDs {
+		access = append(access, termQuery("access_channel_id", channelID))
+	}
+	conjuncts = append(conjuncts, bleve.NewDisjunctionQuery(access...))
+
+	if q.Text != "" {
+		match := bleve.NewMatchQuery(q.Text)
+		match.SetField("content")
+		match.SetOperator(query.MatchQueryOperatorAnd)
+		conjuncts = append(conjuncts, match)
+	}
+	if q.AuthorID != "" {
+		conjuncts = append(conjuncts, termQuery("author_id", q.AuthorID))
+	}
+	if q.ChannelID != "" {
+		conjuncts = append(conjuncts, termQuery("channel_id", q.ChannelID))
+	}
+	if q.MentionsUserID != "" {
+		conjuncts = append(conjuncts, termQuery("mentions", q.MentionsUserID))
+	}
+	if !q.After.IsZero() || !q.Before.IsZero() {
+		dates := bleve.NewDateRangeQuery(q.After, q.Before)
+		dates.SetField("sent_at")
+		conjuncts = append(conjuncts, dates)
+	}
+	if q.HasAttachment != nil {
+		hasAttachment := bleve.NewBoolFieldQuery(*q.HasAttachment)
+		hasAttachment.SetField("has_attachment")
+		conjuncts = append(conjuncts, hasAttachment)
+	}
+
+	request := bleve.NewSearchRequestOptions(bleve.NewConjunctionQuery(conjuncts...), q.Limit, q.Offset, false)
+	request.SortBy([]string{"-sent_at"})
+	request.Fields = []string{"channel_id"}
+
+	result, err := SearchIndex.Search(request)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	hits := make([]SearchHit, 0, len(result.Hits))
+	for _, hit := range result.Hits {
+		channelID, _ := hit.Fields["channel_id"].(string)
+		hits = append(hits, SearchHit{MessageID: hit.ID, ChannelID: channelID})
+	}
+	return hits, result.Total, nil
+}
+
+func termQuery(field, term string) query.Query {
+	q := bleve.NewTermQuery(term)
+	q.SetField(field)
+	return q
+}
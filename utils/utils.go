@@ -35,7 +35,7 @@ func DebugScyllaInsert(label string, v interface{}) {
 
 		fmt.Printf("🧩 %s (%s): %v\n", field.Name, field.Type, value)
 	}
-	fmt.Println("✅ Fin du dump struct\n")
+	fmt.Println("✅ Fin du dump struct")
 }
 func DebugCQL(query string, values ...any) {
 	fmt.Println("🟢 Requête CQL (debug approximatif) :")
@@ -51,3 +51,17 @@ func RandomString64() (string, error) {
 	}
 	return hex.EncodeToString(bytes), nil
 }
+
+const codeAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// RandomCode génère un code alphanumérique de n caractères (ex: codes d'invitation).
+func RandomCode(n int) (string, error) {
+	bytes := make([]byte, n)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	for i, b := range bytes {
+		bytes[i] = codeAlphabet[int(b)%len(codeAlphabet)]
+	}
+	return string(bytes), nil
+}